@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -27,15 +28,20 @@ func main() {
 	if err := InitConfig(); err != nil {
 		logrus.Fatalf("config opening error: %s", err.Error())
 	}
+	attendanceSecret := viper.GetString("attendance.secret")
+	if attendanceSecret == "" || attendanceSecret == "change-me-attendance-secret" {
+		logrus.Fatalf("attendance secret is not set, put it in the ATTENDANCE_SECRET environment variable")
+	}
 	auth := smtp.PlainAuth("", viper.GetString("smtp.gmail"), viper.GetString("smtp.password"), viper.GetString("smtp.host"))
-	db, err := repository.NewPostgresDB(repository.PostgresConfig{
+	dbConfig := repository.PostgresConfig{
 		Host:     viper.GetString("db.host"),
 		Port:     viper.GetString("db.port"),
 		User:     viper.GetString("db.user"),
 		Password: viper.GetString("db.password"),
 		DBName:   viper.GetString("db.dbname"),
 		SSLMode:  viper.GetString("db.sslmode"),
-	})
+	}
+	db, err := repository.NewPostgresDB(dbConfig)
 	if err != nil {
 		logrus.Fatalf("database connection error: %s", err.Error())
 	}
@@ -55,9 +61,53 @@ func main() {
 	if err = migrations.Up(); err != nil && err != migrate.ErrNoChange {
 		logrus.Fatalf("Migrations error: %s", err.Error())
 	}
+	location, err := time.LoadLocation(viper.GetString("site.timezone"))
+	if err != nil {
+		logrus.Fatalf("time zone loading error: %s", err.Error())
+	}
 	repo := repository.NewRepository(db)
-	services := service.NewService(repo, auth, viper.GetString("smtp.gmail"), viper.GetString("smtp.host"), viper.GetString("smtp.port"))
-	endp := endpoint.NewEndpoint(services)
+	services := service.NewService(repo, service.Config{
+		SMTPAuth: auth,
+		Gmail:    viper.GetString("smtp.gmail"),
+		SMTPHost: viper.GetString("smtp.host"),
+		SMTPPort: viper.GetString("smtp.port"),
+		Site: service.SiteConfig{
+			URL:              viper.GetString("site.url"),
+			EventLink:        viper.GetString("site.event_link"),
+			RegistrationLink: viper.GetString("site.registration_link"),
+			CalendarLink:     viper.GetString("site.calendar_link"),
+			UnsubscribeLink:  viper.GetString("site.unsubscribe_link"),
+			AttachmentLink:   viper.GetString("site.attachment_link"),
+		},
+		Location: location,
+		Telegram: service.TelegramConfig{
+			Token:   viper.GetString("telegram.token"),
+			BaseURL: viper.GetString("telegram.base_url"),
+			BotName: viper.GetString("telegram.bot_name"),
+		},
+		Storage: service.StorageConfig{
+			Driver: viper.GetString("storage.driver"),
+			Dir:    viper.GetString("storage.dir"),
+			S3: service.S3Config{
+				Endpoint:  viper.GetString("storage.s3.endpoint"),
+				Region:    viper.GetString("storage.s3.region"),
+				Bucket:    viper.GetString("storage.s3.bucket"),
+				AccessKey: viper.GetString("storage.s3.access_key"),
+				SecretKey: viper.GetString("storage.s3.secret_key"),
+				PathStyle: viper.GetBool("storage.s3.path_style"),
+			},
+		},
+		AttendanceSecret: attendanceSecret,
+	})
+	endp := endpoint.NewEndpoint(services, location, viper.GetStringSlice("trusted_proxies"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go services.Registrations.RunWaitlistSweeper(ctx, time.Minute)
+	go services.Reminders.RunReminders(ctx, 5*time.Minute)
+	go services.Telegram.RunTelegramBot(ctx)
+	go services.Webhooks.RunWebhookDispatcher(ctx, 30*time.Second)
+	go services.Stream.RunStreamListener(ctx, dbConfig.DSN())
+	go services.Attachments.RunAttachmentSweeper(ctx, time.Minute)
 	server := &liceum_backend.Server{}
 	go func() {
 		if err := server.Run(viper.GetString("port"), endp.InitRoutes()); err != nil {
@@ -75,5 +125,8 @@ func main() {
 func InitConfig() error {
 	viper.AddConfigPath("configs")
 	viper.SetConfigName("config")
+	if err := viper.BindEnv("attendance.secret", "ATTENDANCE_SECRET"); err != nil {
+		return err
+	}
 	return viper.ReadInConfig()
 }
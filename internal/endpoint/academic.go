@@ -0,0 +1,109 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+func (e *Endpoint) GetAcademicCalendar(c *gin.Context) {
+	periods, err := e.services.Academic.GetAcademicCalendar()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"periods": periods})
+}
+
+type AcademicPeriodInput struct {
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	StartDate model.Date `json:"start_date"`
+	EndDate   model.Date `json:"end_date"`
+}
+
+func (e *Endpoint) PostAcademicPeriod(c *gin.Context) {
+	var input AcademicPeriodInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := e.services.Academic.CreatePeriod(model.AcademicPeriod{
+		Name:      input.Name,
+		Kind:      input.Kind,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (e *Endpoint) PutAcademicPeriod(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input AcademicPeriodInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Academic.EditPeriod(model.AcademicPeriod{
+		ID:        id,
+		Name:      input.Name,
+		Kind:      input.Kind,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+	}); err != nil {
+		abortPeriodError(c, err, http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) DeleteAcademicPeriod(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Academic.DeletePeriod(id); err != nil {
+		abortPeriodError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// abortPeriodError answers 404 for unknown periods and status otherwise.
+func abortPeriodError(c *gin.Context, err error, status int) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// withWarnings adds holiday warnings for blocks to a successful response.
+// Blocks are already saved at this point, so a failed check is only logged.
+func (e *Endpoint) withWarnings(response gin.H, blocks []model.EventBlock) gin.H {
+	warnings, err := e.services.Academic.ScheduleWarnings(blocks)
+	if err != nil {
+		logrus.Errorf("SCHEDULE WARNINGS ERROR: %s", err.Error())
+		return response
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	return response
+}
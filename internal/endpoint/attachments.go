@@ -0,0 +1,140 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+// maxAttachmentsUpload limits a whole upload request, each file is checked
+// against the attachment size limit by the service.
+const maxAttachmentsUpload = 64 << 20
+
+// PostAttachments stores every file sent in "file" fields of a multipart
+// form. Files are saved one by one, a rejected file stops the upload and
+// the response lists what was saved before it.
+func (e *Endpoint) PostAttachments(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentsUpload)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload is too large"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no file"})
+		return
+	}
+	attachments := []model.Attachment{}
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error(), "attachments": attachments})
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error(), "attachments": attachments})
+			return
+		}
+		attachment, err := e.services.Attachments.UploadAttachment(id, header.Filename, data)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, sql.ErrNoRows) {
+				status = http.StatusNotFound
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": header.Filename + ": " + err.Error(), "attachments": attachments})
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+func (e *Endpoint) GetAttachments(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	attachments, err := e.services.Attachments.GetAttachments(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+func (e *Endpoint) DeleteAttachment(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Attachments.DeleteAttachment(id); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) GetAttachmentFile(c *gin.Context) {
+	e.serveAttachment(c, false)
+}
+
+func (e *Endpoint) GetAttachmentThumbnail(c *gin.Context) {
+	e.serveAttachment(c, true)
+}
+
+// serveAttachment streams the file from storage. Images and PDFs open in
+// the browser, other files are downloaded. Stored files never change, so
+// they may be cached for long.
+func (e *Endpoint) serveAttachment(c *gin.Context, thumbnail bool) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	attachment, file, size, err := e.services.Attachments.OpenAttachment(id, thumbnail)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, fs.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") || attachment.ContentType == "application/pdf" {
+		disposition = "inline"
+	}
+	c.DataFromReader(http.StatusOK, size, attachment.ContentType, file, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+		"Cache-Control":          "public, max-age=604800",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,163 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type CheckInInput struct {
+	Name  string  `json:"name"`
+	Grade *int    `json:"grade"`
+	Class *string `json:"class"`
+	Email string  `json:"email"`
+	Code  string  `json:"code"`
+}
+
+func (e *Endpoint) CheckIn(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input CheckInInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	attendanceId, err := e.services.Attendance.CheckIn(model.Attendance{
+		BlockID: id,
+		Name:    input.Name,
+		Grade:   input.Grade,
+		Class:   input.Class,
+		Email:   input.Email,
+	}, input.Code, c.ClientIP())
+	if err != nil {
+		abortAttendanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": attendanceId})
+}
+
+func (e *Endpoint) GetCheckInCode(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	code, err := e.services.Attendance.GetCheckInCode(id)
+	if err != nil {
+		abortAttendanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"check_in": code})
+}
+
+func (e *Endpoint) GetBlockAttendance(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	attendance, err := e.services.Attendance.GetBlockAttendance(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attendance": attendance})
+}
+
+// MarkAttendanceInput names the student and, for recurring blocks, the
+// start of the occurrence. Present false removes the mark.
+type MarkAttendanceInput struct {
+	Name            string     `json:"name"`
+	Grade           *int       `json:"grade"`
+	Class           *string    `json:"class"`
+	Email           string     `json:"email"`
+	OccurrenceStart *time.Time `json:"occurrence_start"`
+	Present         *bool      `json:"present"`
+}
+
+func (e *Endpoint) MarkAttendance(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input MarkAttendanceInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	present := input.Present == nil || *input.Present
+	if c.Request.Method == http.MethodDelete {
+		present = false
+	}
+	if err := e.services.Attendance.MarkAttendance(model.Attendance{
+		BlockID:  id,
+		Name:     input.Name,
+		Grade:    input.Grade,
+		Class:    input.Class,
+		Email:    input.Email,
+		MarkedBy: c.GetString(adminEmailKey),
+	}, input.OccurrenceStart, present); err != nil {
+		abortAttendanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) ExportEventAttendance(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	file, err := e.services.Attendance.EventAttendanceReport(id, c.DefaultQuery("format", "csv"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Body)
+}
+
+func (e *Endpoint) ExportStudentAttendance(c *gin.Context) {
+	file, err := e.services.Attendance.StudentAttendanceReport(c.Query("email"), c.DefaultQuery("format", "csv"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Body)
+}
+
+// abortAttendanceError answers check-ins outside the block and exhausted
+// attempts with 409, wrong codes with 403, unknown blocks and marks with
+// 404 and other failures with 400.
+func abortAttendanceError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrCheckInClosed) || errors.Is(err, model.ErrTooManyAttempts) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, model.ErrWrongCheckInCode) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,44 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const maxBackupSize = 100 << 20
+
+func (e *Endpoint) GetBackup(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"backup-%s.json\"", time.Now().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+	if err := e.services.Backup.Backup(c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		logrus.Errorf("BACKUP ERROR: %s", err.Error())
+		c.Abort()
+	}
+}
+
+func (e *Endpoint) RestoreBackup(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupSize)
+	report, err := e.services.Backup.Restore(body, c.Query("mode"), saveOptions(c))
+	if err != nil {
+		var conflict *model.ConflictError
+		if errors.As(err, &conflict) {
+			abortSaveError(c, err)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
@@ -0,0 +1,42 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type BatchInput struct {
+	Mode       string                 `json:"mode"`
+	Operations []model.BatchOperation `json:"operations"`
+}
+
+// PostBatch runs the operations in order. A failed atomic batch answers
+// 400, or 409 for room conflicts, with the results telling which
+// operation failed. Best-effort batches answer 200 with a result per
+// operation. Batches rejected as a whole, such as an unknown mode, come
+// without results.
+func (e *Endpoint) PostBatch(c *gin.Context) {
+	var input BatchInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results, err := e.services.Batch.RunBatch(input.Mode, input.Operations, saveOptions(c))
+	if err != nil {
+		var conflict *model.ConflictError
+		var failed *model.BatchError
+		switch {
+		case errors.As(err, &conflict):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflict.Conflicts, "results": results})
+		case errors.As(err, &failed), results == nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error(), "results": results})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,48 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+func (e *Endpoint) GetCalendar(c *gin.Context) {
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := e.services.Calendar.EventsICS(loc, requestLocale(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeFeed(c, calendarContentType, feed)
+}
+
+func (e *Endpoint) GetEventCalendar(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := e.services.Calendar.EventICS(id, loc, requestLocale(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeFeed(c, calendarContentType, feed)
+}
@@ -1,52 +1,173 @@
 package endpoint
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
 	"github.com/lavatee/liceum_backend/internal/service"
+	"github.com/sirupsen/logrus"
 )
 
 type Endpoint struct {
-	services *service.Service
+	services       *service.Service
+	school         *time.Location
+	trustedProxies []string
 }
 
-func NewEndpoint(services *service.Service) *Endpoint {
+// NewEndpoint takes the addresses of the proxies in front of the server.
+// Only their X-Real-IP header is trusted for the client address, which
+// sign-in, registration and check-in limits are keyed on.
+func NewEndpoint(services *service.Service, school *time.Location, trustedProxies []string) *Endpoint {
 	return &Endpoint{
-		services: services,
+		services:       services,
+		school:         school,
+		trustedProxies: trustedProxies,
 	}
 }
 
+// location returns the time zone requested with the tz query parameter,
+// the school's time zone by default. It aborts with 400 on unknown zones.
+func (e *Endpoint) location(c *gin.Context) (*time.Location, bool) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return e.school, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+		return nil, false
+	}
+	return loc, true
+}
+
+func (e *Endpoint) localize(events []model.Event, loc *time.Location) []model.Event {
+	result := make([]model.Event, len(events))
+	for i, event := range events {
+		result[i] = event.Localize(loc, e.school)
+	}
+	return result
+}
+
 func (e *Endpoint) InitRoutes() *gin.Engine {
 	router := gin.New()
+	router.RemoteIPHeaders = []string{"X-Real-IP"}
+	if err := router.SetTrustedProxies(e.trustedProxies); err != nil {
+		logrus.Fatalf("invalid trusted proxies: %s", err.Error())
+	}
 	config := cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept-Language"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
 
-	router.Use(cors.New(config))
-	users := router.Group("/users")
+	router.Use(cors.New(config), e.Locale)
+	users := router.Group("/users", e.OptionalAuth)
 	{
 		users.GET("/current-events", e.GetCurrentEvents)
 		users.GET("/all-events", e.GetAllEvents)
+		users.GET("/upcoming", e.GetUpcomingEvents)
+		users.GET("/academic-calendar", e.GetAcademicCalendar)
+		users.GET("/rooms", e.GetRooms)
 		users.GET("/event/:id", e.GetOneEvent)
 		users.GET("/block/:id", e.GetOneBlock)
+		users.GET("/attachments/:id", e.GetAttachmentFile)
+		users.GET("/attachments/:id/thumbnail", e.GetAttachmentThumbnail)
+		users.GET("/block/:id/registration", e.GetRegistrationStatus)
+		users.POST("/block/:id/register", e.Register)
+		users.POST("/block/:id/register/confirm", e.ConfirmRegistration)
+		users.GET("/registrations/:token", e.GetRegistration)
+		users.POST("/registrations/:token/cancel", e.CancelRegistration)
+		users.POST("/registrations/:token/accept", e.AcceptOffer)
+		users.POST("/block/:id/check-in", e.CheckIn)
+		users.GET("/calendar.ics", e.GetCalendar)
+		users.GET("/event/:id/calendar.ics", e.GetEventCalendar)
+		users.GET("/series/:id", e.GetSeries)
+		users.GET("/series/:id/calendar.ics", e.GetSeriesCalendar)
+		users.GET("/series/:id/feed.rss", e.GetSeriesRSSFeed)
+		users.GET("/series/:id/feed.atom", e.GetSeriesAtomFeed)
+		users.GET("/feed.rss", e.GetRSSFeed)
+		users.GET("/feed.atom", e.GetAtomFeed)
+		users.GET("/stream", e.Stream)
 		users.POST("/send-code", e.SendAuthCode)
 		users.POST("/verify-code", e.VerifyCode)
 		users.POST("/refresh-token", e.RefreshToken)
+		users.GET("/me", e.UserAuth, e.GetMe)
+		users.PUT("/me", e.UserAuth, e.PutMe)
+		users.GET("/me/favorites", e.UserAuth, e.GetFavorites)
+		users.POST("/me/favorites/:eventId", e.UserAuth, e.PostFavorite)
+		users.DELETE("/me/favorites/:eventId", e.UserAuth, e.DeleteFavorite)
+		users.GET("/me/schedule", e.UserAuth, e.GetSchedule)
+		users.GET("/me/calendar-link", e.UserAuth, e.GetCalendarLink)
+		users.GET("/me/notifications", e.UserAuth, e.GetNotificationSettings)
+		users.PUT("/me/notifications", e.UserAuth, e.PutNotificationSettings)
+		users.POST("/me/telegram", e.UserAuth, e.PostTelegramLink)
+		users.DELETE("/me/telegram", e.UserAuth, e.DeleteTelegramLink)
+		users.GET("/unsubscribe/:token", e.UnsubscribePage)
+		users.POST("/unsubscribe/:token", e.Unsubscribe)
+		users.GET("/private/:token/calendar.ics", e.GetPrivateCalendar)
 	}
 	admins := router.Group("/admins", e.Middleware)
 	{
 		admins.POST("/events", e.PostEvent)
 		admins.DELETE("/events/:id", e.DeleteEvent)
 		admins.PUT("/events/:id", e.PutEvent)
+		admins.PUT("/events/:id/parent", e.PutEventParent)
+		admins.PUT("/events/:id/blocks/order", e.PutBlockOrder)
+		admins.POST("/events/:id/clone", e.CloneEvent)
+		admins.GET("/templates", e.GetTemplates)
+		admins.POST("/templates", e.PostTemplate)
+		admins.GET("/templates/:id", e.GetTemplate)
+		admins.PUT("/templates/:id", e.PutTemplate)
+		admins.DELETE("/templates/:id", e.DeleteTemplate)
+		admins.POST("/templates/:id/instantiate", e.InstantiateTemplate)
+		admins.GET("/events/:id/attachments", e.GetAttachments)
+		admins.POST("/events/:id/attachments", e.PostAttachments)
+		admins.DELETE("/attachments/:id", e.DeleteAttachment)
+		admins.GET("/events/:id/translations", e.GetTranslations)
+		admins.PUT("/events/:id/translations/:locale", e.PutEventTranslation)
+		admins.DELETE("/events/:id/translations/:locale", e.DeleteEventTranslation)
+		admins.PUT("/blocks/:id/translations/:locale", e.PutBlockTranslation)
+		admins.DELETE("/blocks/:id/translations/:locale", e.DeleteBlockTranslation)
 		admins.POST("/blocks", e.PostEventBlock)
 		admins.DELETE("/blocks/:id", e.DeleteEventBlock)
 		admins.PUT("/blocks/:id", e.PutEventBlock)
+		admins.PUT("/blocks/:id/occurrences", e.PutOccurrence)
+		admins.GET("/blocks/:id/registrations", e.GetRegistrations)
+		admins.GET("/blocks/:id/registrations/export", e.ExportRegistrations)
+		admins.DELETE("/registrations/:id", e.DeleteRegistration)
+		admins.GET("/blocks/:id/check-in-code", e.GetCheckInCode)
+		admins.GET("/blocks/:id/attendance", e.GetBlockAttendance)
+		admins.POST("/blocks/:id/attendance", e.MarkAttendance)
+		admins.DELETE("/blocks/:id/attendance", e.MarkAttendance)
+		admins.GET("/events/:id/attendance/export", e.ExportEventAttendance)
+		admins.GET("/attendance/export", e.ExportStudentAttendance)
+		admins.POST("/academic-periods", e.PostAcademicPeriod)
+		admins.PUT("/academic-periods/:id", e.PutAcademicPeriod)
+		admins.DELETE("/academic-periods/:id", e.DeleteAcademicPeriod)
+		admins.POST("/rooms", e.PostRoom)
+		admins.PUT("/rooms/:id", e.PutRoom)
+		admins.DELETE("/rooms/:id", e.DeleteRoom)
+		admins.GET("/audit-log", e.GetAuditLog)
+		admins.GET("/users", e.GetUsers)
+		admins.PUT("/users/:id", e.PutUser)
+		admins.DELETE("/users/:id", e.DeleteUser)
+		admins.GET("/webhooks", e.GetWebhooks)
+		admins.POST("/webhooks", e.PostWebhook)
+		admins.PUT("/webhooks/:id", e.PutWebhook)
+		admins.DELETE("/webhooks/:id", e.DeleteWebhook)
+		admins.GET("/webhooks/:id/deliveries", e.GetWebhookDeliveries)
+		admins.POST("/webhooks/:id/test", e.TestWebhook)
+		admins.POST("/batch", e.PostBatch)
+		admins.POST("/import/ics", e.ImportICS)
+		admins.POST("/import", e.ImportSpreadsheet)
+		admins.GET("/export", e.ExportEvents)
+		admins.GET("/backup", e.GetBackup)
+		admins.POST("/restore", e.RestoreBackup)
 	}
 	return router
 }
@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,21 +10,35 @@ import (
 )
 
 func (e *Endpoint) GetCurrentEvents(c *gin.Context) {
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
 	events, err := e.services.Events.GetCurrentEvents()
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"events": events})
+	if !e.translate(c, events) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": e.localize(events, loc)})
 }
 
 func (e *Endpoint) GetAllEvents(c *gin.Context) {
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
 	events, err := e.services.Events.GetAllEvents()
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"events": events})
+	if !e.translate(c, events) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": e.localize(events, loc)})
 }
 
 func (e *Endpoint) GetOneEvent(c *gin.Context) {
@@ -33,12 +48,20 @@ func (e *Endpoint) GetOneEvent(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
 	event, err := e.services.Events.GetOneEvent(id)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"event": event})
+	events := []model.Event{event}
+	if !e.translate(c, events) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event": events[0].Localize(loc, e.school)})
 }
 
 func (e *Endpoint) GetOneBlock(c *gin.Context) {
@@ -48,12 +71,20 @@ func (e *Endpoint) GetOneBlock(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
 	block, err := e.services.Events.GetOneBlock(id)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"block": block})
+	events := []model.Event{{EventBlocks: []model.EventBlock{block}}}
+	if !e.translate(c, events) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"block": events[0].EventBlocks[0].Localize(loc, e.school)})
 }
 
 type SendCodeInput struct {
@@ -66,7 +97,11 @@ func (e *Endpoint) SendAuthCode(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := e.services.Events.SendAuthCode(input.Email); err != nil {
+	if err := e.services.Events.SendAuthCode(input.Email, c.ClientIP(), requestLocale(c)); err != nil {
+		if errors.Is(err, model.ErrTooManyCodes) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -99,6 +134,9 @@ type PostEventInput struct {
 	Name        string             `json:"name"`
 	Description string             `json:"description"`
 	EventBlocks []model.EventBlock `json:"event_blocks"`
+	ParentID    *int               `json:"parent_id"`
+	Tags        []string           `json:"tags"`
+	Audience    []string           `json:"audience"`
 }
 
 func (e *Endpoint) PostEvent(c *gin.Context) {
@@ -111,12 +149,15 @@ func (e *Endpoint) PostEvent(c *gin.Context) {
 		Name:        input.Name,
 		Description: input.Description,
 		EventBlocks: input.EventBlocks,
-	})
+		ParentID:    input.ParentID,
+		Tags:        input.Tags,
+		Audience:    input.Audience,
+	}, saveOptions(c))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortSaveError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": createdId})
+	c.JSON(http.StatusOK, e.withWarnings(gin.H{"id": createdId}, input.EventBlocks))
 }
 
 func (e *Endpoint) DeleteEvent(c *gin.Context) {
@@ -133,9 +174,13 @@ func (e *Endpoint) DeleteEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// PutEventInput leaves tags and audience as they are when they are
+// missing, an empty list clears them.
 type PutEventInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Audience    []string `json:"audience"`
 }
 
 func (e *Endpoint) PutEvent(c *gin.Context) {
@@ -154,6 +199,8 @@ func (e *Endpoint) PutEvent(c *gin.Context) {
 		ID:          id,
 		Name:        input.Name,
 		Description: input.Description,
+		Tags:        input.Tags,
+		Audience:    input.Audience,
 	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -171,38 +218,56 @@ func (e *Endpoint) PostEventBlock(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := e.services.Events.CreateEventBlocks(input.Blocks); err != nil {
+	if err := e.services.Events.CreateEventBlocks(input.Blocks, saveOptions(c)); err != nil {
+		abortSaveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, e.withWarnings(gin.H{"status": "ok"}, input.Blocks))
+}
+
+func (e *Endpoint) PutEventBlock(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input model.BlockPatch
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	block, err := e.services.Events.GetOneBlock(id)
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	input.Apply(&block)
+	if err := e.services.Events.EditBlockInfo(block, saveOptions(c)); err != nil {
+		abortSaveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, e.withWarnings(gin.H{"status": "ok"}, []model.EventBlock{block}))
 }
 
-type PutBlockInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Link        string `json:"link"`
+type BlockOrderInput struct {
+	BlockIDs []int `json:"block_ids"`
 }
 
-func (e *Endpoint) PutEventBlock(c *gin.Context) {
+func (e *Endpoint) PutBlockOrder(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	var input PutBlockInput
+	var input BlockOrderInput
 	if err := c.BindJSON(&input); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := e.services.Events.EditBlockInfo(model.EventBlock{
-		ID:          id,
-		Name:        input.Name,
-		Description: input.Description,
-		Link:        input.Link,
-	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := e.services.Events.SetBlockOrder(id, input.BlockIDs); err != nil {
+		abortUserError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -0,0 +1,58 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+const (
+	rssContentType  = "application/rss+xml; charset=utf-8"
+	atomContentType = "application/atom+xml; charset=utf-8"
+)
+
+func (e *Endpoint) GetRSSFeed(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := e.services.Feed.RSS(limit, loc, requestLocale(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeFeed(c, rssContentType, feed)
+}
+
+func (e *Endpoint) GetAtomFeed(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := e.services.Feed.Atom(limit, loc, requestLocale(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeFeed(c, atomContentType, feed)
+}
+
+// writeFeed answers 304 when If-None-Match has the feed's ETag. Last-Modified
+// is only informative: deletions and room or holiday changes do not move
+// it, so If-Modified-Since alone never gets a 304.
+func writeFeed(c *gin.Context, contentType string, feed model.Feed) {
+	c.Header("ETag", feed.ETag)
+	c.Header("Cache-Control", "no-cache")
+	if !feed.LastModified.IsZero() {
+		c.Header("Last-Modified", feed.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if match := c.GetHeader("If-None-Match"); match != "" && match == feed.ETag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, feed.Body)
+}
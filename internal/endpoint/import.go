@@ -0,0 +1,118 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+const maxImportSize = 5 << 20
+
+func (e *Endpoint) ImportICS(c *gin.Context) {
+	data, _, err := readUpload(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	target := model.ImportTarget{
+		EventName:        c.Query("event_name"),
+		EventDescription: c.Query("event_description"),
+	}
+	if idParam := c.Query("event_id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid event_id"})
+			return
+		}
+		target.EventID = id
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	report, err := e.services.Import.ImportICS(data, target, dryRun, saveOptions(c))
+	if err != nil {
+		abortImportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// abortImportError answers 400 for files that cannot be imported, 409 for
+// room conflicts and 500 when they could not be stored.
+func abortImportError(c *gin.Context, err error) {
+	var importErr *model.ImportError
+	if errors.As(err, &importErr) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	abortSaveError(c, err)
+}
+
+// abortExportError answers 400 for unsupported formats, other export
+// errors are failures to read the data.
+func abortExportError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrUnsupportedFormat) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// readUpload accepts either a multipart form with a "file" field or the raw
+// request body, the file name is empty for raw bodies.
+func readUpload(c *gin.Context) ([]byte, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		return data, header.Filename, err
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	return data, "", err
+}
+
+func (e *Endpoint) ImportSpreadsheet(c *gin.Context) {
+	data, filename, err := readUpload(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(path.Ext(filename)), ".")
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	report, err := e.services.Import.ImportSpreadsheet(data, format, dryRun, saveOptions(c))
+	if err != nil {
+		abortImportError(c, err)
+		return
+	}
+	if len(report.Errors) > 0 {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"report": report})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+func (e *Endpoint) ExportEvents(c *gin.Context) {
+	file, err := e.services.Import.ExportEvents(c.DefaultQuery("format", "csv"))
+	if err != nil {
+		abortExportError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Body)
+}
@@ -0,0 +1,204 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const localeKey = "locale"
+
+// negotiateLocale picks the locale asked with ?lang=, then the best one
+// in Accept-Language, then model.DefaultLocale.
+func negotiateLocale(lang string, acceptLanguage string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if model.IsLocale(lang) {
+		return lang
+	}
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var candidates []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > 0 && model.IsLocale(primary) {
+			candidates = append(candidates, weighted{locale: primary, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	if len(candidates) > 0 {
+		return candidates[0].locale
+	}
+	return model.DefaultLocale
+}
+
+// Locale negotiates the language of the response. Error responses get a
+// "message" in that language next to the "error" clients match on.
+func (e *Endpoint) Locale(c *gin.Context) {
+	locale := negotiateLocale(c.Query("lang"), c.GetHeader("Accept-Language"))
+	c.Set(localeKey, locale)
+	c.Header("Content-Language", locale)
+	c.Header("Vary", "Accept-Language")
+	c.Writer = &localizedWriter{ResponseWriter: c.Writer, locale: locale}
+	c.Next()
+}
+
+func requestLocale(c *gin.Context) string {
+	if locale := c.GetString(localeKey); locale != "" {
+		return locale
+	}
+	return model.DefaultLocale
+}
+
+// translate applies the request locale to events in place, aborting with
+// 500 when translations can not be read.
+func (e *Endpoint) translate(c *gin.Context, events []model.Event) bool {
+	if err := e.services.Translations.TranslateEvents(events, requestLocale(c)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// localizedWriter adds a "message" to JSON error bodies. Handlers write
+// those bodies in one call, so each Write is a whole body.
+type localizedWriter struct {
+	gin.ResponseWriter
+	locale string
+}
+
+func (w *localizedWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+	var body map[string]json.RawMessage
+	var message string
+	if err := json.Unmarshal(data, &body); err != nil || json.Unmarshal(body["error"], &message) != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	body["message"], _ = json.Marshal(localizeError(w.locale, message))
+	localized, err := json.Marshal(body)
+	if err != nil {
+		logrus.Errorf("LOCALIZE ERROR: %s", err.Error())
+		return w.ResponseWriter.Write(data)
+	}
+	if _, err := w.ResponseWriter.Write(localized); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *localizedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the connection, the stream
+// clears its write deadline through it.
+func (w *localizedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// errorMessages translates error texts shown to students and guests.
+// Placeholders %s match any text and are carried over in order. Texts
+// not listed are shown as they are.
+var errorMessages = map[string]map[string]string{
+	"invalid id":                          {"ru": "Неверный идентификатор", "en": "Invalid id"},
+	"not found":                           {"ru": "Не найдено", "en": "Not found"},
+	"invalid tz":                          {"ru": "Неизвестный часовой пояс", "en": "Unknown time zone"},
+	"invalid header":                      {"ru": "Требуется вход", "en": "Sign in required"},
+	"invalid token":                       {"ru": "Сессия недействительна, войдите снова", "en": "Session is invalid, sign in again"},
+	"expired token":                       {"ru": "Сессия истекла, войдите снова", "en": "Session expired, sign in again"},
+	"token has no account, sign in again": {"ru": "Войдите снова", "en": "Sign in again"},
+	"notadmin":                            {"ru": "Недостаточно прав", "en": "Not allowed"},
+	"wrongcode":                           {"ru": "Неверный или просроченный код", "en": "Wrong or expired code"},
+	"invalid email":                       {"ru": "Неверный адрес почты", "en": "Invalid email address"},
+	"email is empty":                      {"ru": "Укажите адрес почты", "en": "Email is required"},
+	"name is empty":                       {"ru": "Укажите имя", "en": "Name is required"},
+	"name is too long":                    {"ru": "Слишком длинное имя", "en": "Name is too long"},
+	"invalid class":                       {"ru": "Неверный класс", "en": "Invalid class"},
+	"grade must be between 1 and 11":      {"ru": "Класс должен быть от 1 до 11", "en": "Grade must be between 1 and 11"},
+	"role must be student, parent or teacher":            {"ru": "Роль должна быть: ученик, родитель или учитель", "en": "Role must be student, parent or teacher"},
+	"reminder_hours must be between 1 and %s":            {"ru": "Напоминание можно получить за 1–%s ч.", "en": "Reminder hours must be between 1 and %s"},
+	"registration is closed":                             {"ru": "Запись закрыта", "en": "Registration is closed"},
+	"already registered":                                 {"ru": "Вы уже записаны", "en": "You are already registered"},
+	"no pending offer":                                   {"ru": "Нет предложения места", "en": "There is no pending offer"},
+	"check-in is closed":                                 {"ru": "Отметка закрыта", "en": "Check-in is closed"},
+	"wrong check-in code":                                {"ru": "Неверный код отметки", "en": "Wrong check-in code"},
+	"too many attempts, wait for the next code":          {"ru": "Слишком много попыток, дождитесь нового кода", "en": "Too many attempts, wait for the next code"},
+	"block has no occurrence at this time":               {"ru": "В это время занятия нет", "en": "The block does not take place at this time"},
+	"name is required for students who did not register": {"ru": "Укажите имя, если вы не записывались", "en": "Name is required if you did not register"},
+	"telegram bot is not configured":                     {"ru": "Telegram-бот не настроен", "en": "Telegram bot is not configured"},
+	"invalid last event id":                              {"ru": "Неверный идентификатор события", "en": "Invalid last event id"},
+	"file is empty":                                      {"ru": "Файл пустой", "en": "File is empty"},
+	"file is larger than %s MB":                          {"ru": "Файл больше %s МБ", "en": "File is larger than %s MB"},
+	"file type %s is not allowed":                        {"ru": "Тип файла %s не поддерживается", "en": "File type %s is not allowed"},
+	"description is longer than %s characters":           {"ru": "Описание длиннее %s символов", "en": "Description is longer than %s characters"},
+	"unsupported locale %s":                              {"ru": "Язык %s не поддерживается", "en": "Locale %s is not supported"},
+	"translation is empty":                               {"ru": "Перевод пустой", "en": "Translation is empty"},
+	"event can not be its own parent":                    {"ru": "Мероприятие не может входить само в себя", "en": "Event can not be its own parent"},
+	"parent event not found":                             {"ru": "Родительское мероприятие не найдено", "en": "Parent event not found"},
+	"parent event is a stage of another series":          {"ru": "Родительское мероприятие само является этапом", "en": "Parent event is a stage of another series"},
+	"event has stages of its own":                        {"ru": "У мероприятия есть свои этапы", "en": "Event has stages of its own"},
+}
+
+type errorPattern struct {
+	re           *regexp.Regexp
+	translations map[string]string
+}
+
+var errorPatterns = compileErrorPatterns()
+
+func compileErrorPatterns() []errorPattern {
+	var patterns []errorPattern
+	for text, translations := range errorMessages {
+		if !strings.Contains(text, "%s") {
+			continue
+		}
+		parts := strings.Split(text, "%s")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		patterns = append(patterns, errorPattern{
+			re:           regexp.MustCompile("^" + strings.Join(parts, "(.+)") + "$"),
+			translations: translations,
+		})
+	}
+	return patterns
+}
+
+func localizeError(locale string, text string) string {
+	if translations, ok := errorMessages[text]; ok {
+		return translations[locale]
+	}
+	for _, pattern := range errorPatterns {
+		m := pattern.re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		message := pattern.translations[locale]
+		for _, arg := range m[1:] {
+			message = strings.Replace(message, "%s", arg, 1)
+		}
+		return message
+	}
+	return text
+}
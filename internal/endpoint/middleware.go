@@ -6,23 +6,69 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
 )
 
-func (e *Endpoint) Middleware(c *gin.Context) {
+const (
+	adminEmailKey = "email"
+	userKey       = "user"
+)
+
+// bearerUser reads the holder of the request's bearer token.
+func (e *Endpoint) bearerUser(c *gin.Context) (model.UserClaims, error) {
 	header := c.GetHeader("Authorization")
 	sliceOfHeader := strings.Split(header, " ")
 	if len(sliceOfHeader) != 2 || sliceOfHeader[0] != "Bearer" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Errorf("invalid header")})
+		return model.UserClaims{}, fmt.Errorf("invalid header")
+	}
+	return e.services.ParseUser(sliceOfHeader[1])
+}
+
+func (e *Endpoint) Middleware(c *gin.Context) {
+	user, err := e.bearerUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !e.services.CheckIsAdmin(user.Email) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "notadmin"})
 		return
 	}
-	token := sliceOfHeader[1]
-	claims, err := e.services.ParseToken(token)
+	c.Set(adminEmailKey, user.Email)
+	c.Set(userKey, user)
+}
+
+// OptionalAuth lets public endpoints know who is asking. Requests without
+// a valid token go on anonymously.
+func (e *Endpoint) OptionalAuth(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		return
+	}
+	if user, err := e.bearerUser(c); err == nil {
+		c.Set(userKey, user)
+	}
+}
+
+// UserAuth requires a signed in account.
+func (e *Endpoint) UserAuth(c *gin.Context) {
+	user, err := e.bearerUser(c)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
-	if !e.services.CheckIsAdmin(fmt.Sprint(claims["email"])) {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Errorf("notadmin")})
+	if user.UserID == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has no account, sign in again"})
 		return
 	}
+	c.Set(userKey, user)
+}
+
+// currentUser returns the user set by one of the auth middlewares.
+func currentUser(c *gin.Context) (model.UserClaims, bool) {
+	value, ok := c.Get(userKey)
+	if !ok {
+		return model.UserClaims{}, false
+	}
+	user, ok := value.(model.UserClaims)
+	return user, ok
 }
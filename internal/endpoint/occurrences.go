@@ -0,0 +1,67 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func (e *Endpoint) GetUpcomingEvents(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	events, err := e.services.Recurrence.GetUpcomingEvents(days)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !e.translate(c, events) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": e.localize(events, loc)})
+}
+
+type PutOccurrenceInput struct {
+	RecurrenceID time.Time  `json:"recurrence_id" binding:"required"`
+	Scope        string     `json:"scope" binding:"required,oneof=this following all"`
+	Cancel       bool       `json:"cancel"`
+	Name         *string    `json:"name"`
+	Description  *string    `json:"description"`
+	StartDate    *time.Time `json:"start_date"`
+	EndDate      *time.Time `json:"end_date"`
+	Link         *string    `json:"link"`
+}
+
+func (e *Endpoint) PutOccurrence(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input PutOccurrenceInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Recurrence.EditOccurrence(model.OccurrenceEdit{
+		BlockID:      id,
+		RecurrenceID: input.RecurrenceID,
+		Scope:        input.Scope,
+		Cancel:       input.Cancel,
+		Name:         input.Name,
+		Description:  input.Description,
+		StartDate:    input.StartDate,
+		EndDate:      input.EndDate,
+		Link:         input.Link,
+	}, saveOptions(c)); err != nil {
+		abortSaveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
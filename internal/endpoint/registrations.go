@@ -0,0 +1,190 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type RegisterInput struct {
+	Name  string `json:"name"`
+	Grade int    `json:"grade"`
+	Class string `json:"class"`
+	Email string `json:"email"`
+}
+
+func (e *Endpoint) Register(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input RegisterInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	registration := model.Registration{
+		BlockID: id,
+		Name:    input.Name,
+		Grade:   input.Grade,
+		Class:   input.Class,
+		Email:   input.Email,
+	}
+	e.fillFromProfile(c, &registration)
+	if err := e.services.Registrations.RequestRegistration(registration, c.ClientIP()); err != nil {
+		abortRegistrationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+type ConfirmRegistrationInput struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+func (e *Endpoint) ConfirmRegistration(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input ConfirmRegistrationInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	registration, err := e.services.Registrations.ConfirmRegistration(id, input.Email, input.Code)
+	if err != nil {
+		abortRegistrationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"registration": registration, "token": registration.Token})
+}
+
+func (e *Endpoint) GetRegistration(c *gin.Context) {
+	registration, err := e.services.Registrations.GetRegistration(c.Param("token"))
+	if err != nil {
+		abortRegistrationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"registration": registration})
+}
+
+func (e *Endpoint) CancelRegistration(c *gin.Context) {
+	if err := e.services.Registrations.CancelRegistration(c.Param("token")); err != nil {
+		abortRegistrationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) AcceptOffer(c *gin.Context) {
+	registration, err := e.services.Registrations.AcceptOffer(c.Param("token"))
+	if err != nil {
+		abortRegistrationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"registration": registration})
+}
+
+func (e *Endpoint) GetRegistrationStatus(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	status, err := e.services.Registrations.GetRegistrationStatus(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"registration": status})
+}
+
+func (e *Endpoint) GetRegistrations(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	registrations, err := e.services.Registrations.GetRegistrations(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"registrations": registrations})
+}
+
+func (e *Endpoint) ExportRegistrations(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	file, err := e.services.Registrations.ExportRegistrations(id, c.DefaultQuery("format", "csv"))
+	if err != nil {
+		abortExportError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Body)
+}
+
+func (e *Endpoint) DeleteRegistration(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Registrations.DeleteRegistration(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// abortRegistrationError answers closed and repeated registrations and
+// missing offers with 409, unknown blocks and registrations with 404,
+// requests to correct with 400, too many codes with 429 and other
+// failures with 500.
+func abortRegistrationError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrRegistrationClosed) || errors.Is(err, model.ErrAlreadyRegistered) || errors.Is(err, model.ErrNoOffer) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var registrationErr *model.RegistrationError
+	if errors.As(err, &registrationErr) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, model.ErrTooManyCodes) {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
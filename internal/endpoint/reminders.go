@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (e *Endpoint) GetNotificationSettings(c *gin.Context) {
+	user, _ := currentUser(c)
+	settings, err := e.services.Reminders.GetNotificationSettings(user.UserID)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": settings})
+}
+
+func (e *Endpoint) PutNotificationSettings(c *gin.Context) {
+	user, _ := currentUser(c)
+	settings, err := e.services.Reminders.GetNotificationSettings(user.UserID)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	if err := c.BindJSON(&settings); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Reminders.EditNotificationSettings(user.UserID, settings); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// unsubscribePage asks to confirm the unsubscribe. Link checkers and mail
+// scanners follow links in emails, so opening the link changes nothing; the
+// form posts back to the same address.
+const unsubscribePage = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Отписка от писем</title></head>
+<body>
+<form method="post">
+<p>Отписаться от этих писем?</p>
+<button type="submit">Отписаться</button>
+</form>
+</body>
+</html>
+`
+
+// UnsubscribePage serves the link in reminder emails.
+func (e *Endpoint) UnsubscribePage(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(unsubscribePage))
+}
+
+// Unsubscribe answers the confirmation form and one-click unsubscribe from
+// mail clients, both POST to the link.
+func (e *Endpoint) Unsubscribe(c *gin.Context) {
+	if err := e.services.Reminders.Unsubscribe(c.Param("token"), c.Query("kind")); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func (e *Endpoint) GetRooms(c *gin.Context) {
+	rooms, err := e.services.Rooms.GetRooms()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+}
+
+type RoomInput struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+}
+
+func (e *Endpoint) PostRoom(c *gin.Context) {
+	var input RoomInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := e.services.Rooms.CreateRoom(model.Room{
+		Name:     input.Name,
+		Capacity: input.Capacity,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (e *Endpoint) PutRoom(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input RoomInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Rooms.EditRoom(model.Room{
+		ID:       id,
+		Name:     input.Name,
+		Capacity: input.Capacity,
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) DeleteRoom(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Rooms.DeleteRoom(id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) GetAuditLog(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	entries, err := e.services.Rooms.GetAuditLog(limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// saveOptions reads ?force=true, which saves blocks despite room conflicts
+// on behalf of the signed in admin.
+func saveOptions(c *gin.Context) model.SaveOptions {
+	return model.SaveOptions{
+		Force: c.Query("force") == "true",
+		Actor: c.GetString(adminEmailKey),
+	}
+}
+
+// abortSaveError answers room conflicts with 409 and the colliding blocks.
+func abortSaveError(c *gin.Context, err error) {
+	var conflict *model.ConflictError
+	if errors.As(err, &conflict) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflict.Conflicts})
+		return
+	}
+	if isSeriesError(err) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func (e *Endpoint) PostFavorite(c *gin.Context) {
+	eventId, err := strconv.Atoi(c.Param("eventId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	user, _ := currentUser(c)
+	if err := e.services.Schedule.AddFavorite(user.UserID, eventId); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) DeleteFavorite(c *gin.Context) {
+	eventId, err := strconv.Atoi(c.Param("eventId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	user, _ := currentUser(c)
+	if err := e.services.Schedule.RemoveFavorite(user.UserID, eventId); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) GetFavorites(c *gin.Context) {
+	user, _ := currentUser(c)
+	ids, err := e.services.Schedule.GetFavorites(user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event_ids": ids})
+}
+
+func (e *Endpoint) GetSchedule(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	user, _ := currentUser(c)
+	items, err := e.services.Schedule.GetSchedule(user.UserID, days)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	if err := e.services.Translations.TranslateSchedule(items, requestLocale(c)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]model.ScheduleItem, len(items))
+	for i, item := range items {
+		result[i] = item.Localize(loc, e.school)
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": result})
+}
+
+// GetCalendarLink returns the private calendar link, renew=true replaces
+// a leaked link with a new one.
+func (e *Endpoint) GetCalendarLink(c *gin.Context) {
+	renew, _ := strconv.ParseBool(c.Query("renew"))
+	user, _ := currentUser(c)
+	link, err := e.services.Schedule.GetCalendarLink(user.UserID, renew)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"link": link})
+}
+
+func (e *Endpoint) GetPrivateCalendar(c *gin.Context) {
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := e.services.Schedule.UserICS(c.Param("token"), loc, requestLocale(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeFeed(c, calendarContentType, feed)
+}
@@ -0,0 +1,113 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+// abortSeriesError answers 404 for unknown events, the id may be of the
+// parent or of any stage.
+func abortSeriesError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// isSeriesError tells whether err breaks the rules of series, see
+// PutEventParent.
+func isSeriesError(err error) bool {
+	for _, target := range []error{model.ErrOwnParent, model.ErrParentNotFound, model.ErrParentIsStage, model.ErrHasStages} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Endpoint) GetSeries(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	parent, children, err := e.services.Events.GetSeries(id)
+	if err != nil {
+		abortSeriesError(c, err)
+		return
+	}
+	events := append([]model.Event{parent}, children...)
+	if !e.translate(c, events) {
+		return
+	}
+	events = e.localize(events, loc)
+	c.JSON(http.StatusOK, gin.H{"series": events[0], "events": events[1:]})
+}
+
+func (e *Endpoint) GetSeriesCalendar(c *gin.Context) {
+	e.seriesFeed(c, calendarContentType, e.services.Calendar.SeriesICS)
+}
+
+func (e *Endpoint) GetSeriesRSSFeed(c *gin.Context) {
+	e.seriesFeed(c, rssContentType, e.services.Feed.SeriesRSS)
+}
+
+func (e *Endpoint) GetSeriesAtomFeed(c *gin.Context) {
+	e.seriesFeed(c, atomContentType, e.services.Feed.SeriesAtom)
+}
+
+func (e *Endpoint) seriesFeed(c *gin.Context, contentType string, render func(int, *time.Location, string) (model.Feed, error)) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	loc, ok := e.location(c)
+	if !ok {
+		return
+	}
+	feed, err := render(id, loc, requestLocale(c))
+	if err != nil {
+		abortSeriesError(c, err)
+		return
+	}
+	writeFeed(c, contentType, feed)
+}
+
+type PutEventParentInput struct {
+	ParentID *int `json:"parent_id"`
+}
+
+// PutEventParent adds the event to a series, a null parent_id takes it out
+// of its series.
+func (e *Endpoint) PutEventParent(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input PutEventParentInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Events.SetEventParent(id, input.ParentID); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
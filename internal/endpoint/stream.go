@@ -0,0 +1,163 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/service"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	streamHeartbeat = 25 * time.Second
+	streamRetry     = 3000
+)
+
+// Stream pushes event and block changes as Server-Sent Events, or over a
+// WebSocket when the request asks for an upgrade. Clients resume after the
+// Last-Event-ID header or the last_event_id query parameter; when the
+// changes since then are no longer known they get a changes.reset event.
+func (e *Endpoint) Stream(c *gin.Context) {
+	lastParam := c.GetHeader("Last-Event-ID")
+	if lastParam == "" {
+		lastParam = c.Query("last_event_id")
+	}
+	var lastId int64
+	if lastParam != "" {
+		id, err := strconv.ParseInt(lastParam, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid last event id"})
+			return
+		}
+		lastId = id
+	}
+	sub, err := e.services.Stream.Subscribe(lastId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer e.services.Stream.Unsubscribe(sub)
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		server := websocket.Server{
+			// Origins are not checked, like the CORS policy of the API.
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				streamWebSocket(ws, sub, lastId)
+			},
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+	streamSSE(c, sub, lastId)
+}
+
+func streamSSE(c *gin.Context, sub *service.StreamSubscription, lastId int64) {
+	// Streams outlive the server's write timeout.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// nginx buffers proxied responses unless told otherwise.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry)
+	send := func(entry model.ChangeLogEntry) bool {
+		lastId = entry.ID
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return false
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", entry.ID, entry.Kind, data)
+		return err == nil
+	}
+	write := func(entry model.ChangeLogEntry) bool {
+		return entry.ID <= lastId || send(entry)
+	}
+	if sub.Reset != nil && !send(*sub.Reset) {
+		return
+	}
+	for _, entry := range sub.Backlog {
+		if !write(entry) {
+			return
+		}
+	}
+	c.Writer.Flush()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case entry, ok := <-sub.C:
+			if !ok || !write(entry) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// streamWebSocket sends each change as a JSON text message and pings with
+// an empty heartbeat message.
+func streamWebSocket(ws *websocket.Conn, sub *service.StreamSubscription, lastId int64) {
+	defer ws.Close()
+	// The hijacked connection keeps the server's read and write deadlines.
+	if ws.SetDeadline(time.Time{}) != nil {
+		return
+	}
+	closed := make(chan struct{})
+	go func() {
+		// Reading notices the client going away, messages from it are ignored.
+		var message string
+		for websocket.Message.Receive(ws, &message) == nil {
+		}
+		close(closed)
+	}()
+	send := func(entry model.ChangeLogEntry) bool {
+		if entry.ID <= lastId {
+			return true
+		}
+		lastId = entry.ID
+		return websocket.JSON.Send(ws, entry) == nil
+	}
+	if sub.Reset != nil {
+		lastId = sub.Reset.ID
+		if websocket.JSON.Send(ws, *sub.Reset) != nil {
+			return
+		}
+	}
+	for _, entry := range sub.Backlog {
+		if !send(entry) {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case entry, ok := <-sub.C:
+			if !ok || !send(entry) {
+				return
+			}
+		case <-heartbeat.C:
+			if websocket.Message.Send(ws, `{"kind":"heartbeat"}`) != nil {
+				return
+			}
+		}
+	}
+}
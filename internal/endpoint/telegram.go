@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PostTelegramLink returns a one-time code and a bot link. Sending the code
+// to the bot links the chat to the account.
+func (e *Endpoint) PostTelegramLink(c *gin.Context) {
+	user, _ := currentUser(c)
+	link, err := e.services.Telegram.CreateTelegramLink(user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"telegram": link})
+}
+
+func (e *Endpoint) DeleteTelegramLink(c *gin.Context) {
+	user, _ := currentUser(c)
+	if err := e.services.Telegram.UnlinkTelegram(user.UserID); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
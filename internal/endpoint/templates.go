@@ -0,0 +1,147 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+// abortCopyError answers 404 when the source event or template is gone,
+// save errors otherwise.
+func abortCopyError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	abortSaveError(c, err)
+}
+
+func (e *Endpoint) CloneEvent(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input model.CloneOptions
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := e.services.Templates.CloneEvent(id, input, saveOptions(c))
+	if err != nil {
+		abortCopyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, e.withWarnings(gin.H{"id": event.ID}, event.EventBlocks))
+}
+
+func (e *Endpoint) GetTemplates(c *gin.Context) {
+	templates, err := e.services.Templates.GetTemplates()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+func (e *Endpoint) GetTemplate(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	template, err := e.services.Templates.GetTemplate(id)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// TemplateInput saves a snapshot of the event with event_id, or the event
+// given as it is.
+type TemplateInput struct {
+	Name    string              `json:"name"`
+	EventID int                 `json:"event_id"`
+	Event   model.TemplateEvent `json:"event"`
+}
+
+func (e *Endpoint) PostTemplate(c *gin.Context) {
+	var input TemplateInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := e.services.Templates.CreateTemplate(model.EventTemplate{
+		Name:  input.Name,
+		Event: input.Event,
+	}, input.EventID)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (e *Endpoint) PutTemplate(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input TemplateInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := e.services.Templates.EditTemplate(model.EventTemplate{
+		ID:    id,
+		Name:  input.Name,
+		Event: input.Event,
+	}); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) DeleteTemplate(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Templates.DeleteTemplate(id); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) InstantiateTemplate(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input model.TemplateInstance
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := e.services.Templates.InstantiateTemplate(id, input, saveOptions(c))
+	if err != nil {
+		abortCopyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, e.withWarnings(gin.H{"id": event.ID}, event.EventBlocks))
+}
@@ -0,0 +1,137 @@
+package endpoint
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func (e *Endpoint) GetMe(c *gin.Context) {
+	claims, _ := currentUser(c)
+	user, err := e.services.Users.GetUser(claims.UserID)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "role": claims.Role})
+}
+
+type PutUserInput struct {
+	Name  *string `json:"name"`
+	Role  *string `json:"role"`
+	Grade *int    `json:"grade"`
+	Class *string `json:"class"`
+}
+
+// editUser applies the fields present in the request to the stored user.
+// The role goes into tokens, so only admins may set it.
+func (e *Endpoint) editUser(c *gin.Context, userId int, allowRole bool) {
+	var input PutUserInput
+	if err := c.BindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role != nil && !allowRole {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": model.ErrRoleForbidden.Error()})
+		return
+	}
+	user, err := e.services.Users.GetUser(userId)
+	if err != nil {
+		abortUserError(c, err)
+		return
+	}
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Role != nil {
+		user.Role = *input.Role
+	}
+	if input.Grade != nil {
+		user.Grade = input.Grade
+	}
+	if input.Class != nil {
+		user.Class = input.Class
+	}
+	if err := e.services.Users.EditProfile(user); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (e *Endpoint) PutMe(c *gin.Context) {
+	claims, _ := currentUser(c)
+	e.editUser(c, claims.UserID, false)
+}
+
+func (e *Endpoint) GetUsers(c *gin.Context) {
+	users, err := e.services.Users.GetUsers(c.Query("role"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func (e *Endpoint) PutUser(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	e.editUser(c, id, true)
+}
+
+func (e *Endpoint) DeleteUser(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := e.services.Users.DeleteUser(id); err != nil {
+		abortUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// abortUserError answers unknown users with 404 and other failures with
+// 400.
+func abortUserError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// fillFromProfile completes a registration with the signed in student's
+// profile, so they do not type it for every block.
+func (e *Endpoint) fillFromProfile(c *gin.Context, registration *model.Registration) {
+	claims, ok := currentUser(c)
+	if !ok || claims.UserID == 0 {
+		return
+	}
+	user, err := e.services.Users.GetUser(claims.UserID)
+	if err != nil {
+		return
+	}
+	if registration.Email == "" {
+		registration.Email = user.Email
+	}
+	if registration.Name == "" {
+		registration.Name = user.Name
+	}
+	if registration.Grade == 0 && user.Grade != nil {
+		registration.Grade = *user.Grade
+	}
+	if registration.Class == "" && user.Class != nil {
+		registration.Class = *user.Class
+	}
+}
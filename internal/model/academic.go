@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	PeriodTerm         = "term"
+	PeriodHoliday      = "holiday"
+	PeriodExam         = "exam"
+	PeriodNonSchoolDay = "non_school_day"
+)
+
+// AcademicPeriod is a range of days of the school year, both ends are
+// inclusive.
+type AcademicPeriod struct {
+	ID        int    `db:"id" json:"id"`
+	Name      string `db:"name" json:"name"`
+	Kind      string `db:"kind" json:"kind"`
+	StartDate Date   `db:"start_date" json:"start_date"`
+	EndDate   Date   `db:"end_date" json:"end_date"`
+}
+
+// IsSchoolDay reports whether lessons and regular activities take place
+// during the period.
+func (p AcademicPeriod) IsSchoolDay() bool {
+	return p.Kind != PeriodHoliday && p.Kind != PeriodNonSchoolDay
+}
+
+// Contains reports whether t falls on one of the period's days in t's
+// location.
+func (p AcademicPeriod) Contains(t time.Time) bool {
+	day := DateOf(t)
+	return !day.Before(p.StartDate.Time) && !day.After(p.EndDate.Time)
+}
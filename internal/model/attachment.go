@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Attachment is a file attached to an event, such as a poster, rules or a
+// results table. Width, Height and the thumbnail are only set for images
+// the server can decode.
+type Attachment struct {
+	ID           int       `db:"id" json:"id"`
+	EventID      int       `db:"event_id" json:"event_id"`
+	FileName     string    `db:"file_name" json:"file_name"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	Size         int64     `db:"size" json:"size"`
+	Width        *int      `db:"width" json:"width,omitempty"`
+	Height       *int      `db:"height" json:"height,omitempty"`
+	StorageKey   string    `db:"storage_key" json:"-"`
+	ThumbnailKey *string   `db:"thumbnail_key" json:"-"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+
+	URL          string `db:"-" json:"url"`
+	ThumbnailURL string `db:"-" json:"thumbnail_url,omitempty"`
+}
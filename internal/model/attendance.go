@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrCheckInClosed     = errors.New("check-in is closed")
+	ErrWrongCheckInCode  = errors.New("wrong check-in code")
+	ErrTooManyAttempts   = errors.New("too many attempts, wait for the next code")
+	ErrNotAnOccurrence   = errors.New("block has no occurrence at this time")
+	ErrAttendeeNameEmpty = errors.New("name is required for students who did not register")
+)
+
+const (
+	AttendanceCode   = "code"
+	AttendanceManual = "manual"
+)
+
+// Attendance marks a student present at a block. OccurrenceStart is the
+// start of the attended occurrence, the block's start for single blocks.
+type Attendance struct {
+	ID              int       `db:"id" json:"id"`
+	BlockID         int       `db:"block_id" json:"block_id"`
+	RegistrationID  *int      `db:"registration_id" json:"registration_id"`
+	OccurrenceStart time.Time `db:"occurrence_start" json:"occurrence_start"`
+	Name            string    `db:"name" json:"name"`
+	Grade           *int      `db:"grade" json:"grade"`
+	Class           *string   `db:"class" json:"class"`
+	Email           string    `db:"email" json:"email"`
+	Method          string    `db:"method" json:"method"`
+	MarkedBy        string    `db:"marked_by" json:"marked_by,omitempty"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+}
+
+// CheckInCode is the code shown in the room. QRPayload is a link carrying
+// the same code for students who scan it.
+type CheckInCode struct {
+	BlockID   int       `json:"block_id"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+	QRPayload string    `json:"qr_payload"`
+}
+
+// AttendanceRecord is a row of an attendance report. Confirmed registrants
+// of past single blocks who did not come are listed with Present false.
+type AttendanceRecord struct {
+	EventID         int        `db:"event_id" json:"event_id"`
+	EventName       string     `db:"event_name" json:"event_name"`
+	BlockID         int        `db:"block_id" json:"block_id"`
+	BlockName       string     `db:"block_name" json:"block_name"`
+	OccurrenceStart time.Time  `db:"occurrence_start" json:"occurrence_start"`
+	Name            string     `db:"name" json:"name"`
+	Grade           *int       `db:"grade" json:"grade"`
+	Class           *string    `db:"class" json:"class"`
+	Email           string     `db:"email" json:"email"`
+	Registered      bool       `db:"registered" json:"registered"`
+	Present         bool       `db:"present" json:"present"`
+	Method          *string    `db:"method" json:"method"`
+	CheckedInAt     *time.Time `db:"checked_in_at" json:"checked_in_at"`
+}
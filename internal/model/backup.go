@@ -0,0 +1,119 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// BackupVersion is the version of new backups. Older versions are still
+// restored, version 1 has no attachments, versions before 3 have no
+// translations, versions before 4 no tags and audience and versions
+// before 5 may lack block positions.
+const BackupVersion = 5
+
+// BackupAttachmentsVersion is the first version that lists attachments.
+const BackupAttachmentsVersion = 2
+
+// BackupTranslationsVersion is the first version that lists translations.
+const BackupTranslationsVersion = 3
+
+// BackupLabelsVersion is the first version with tags and audience, a
+// missing list there is empty.
+const BackupLabelsVersion = 4
+
+// BackupPositionsVersion is the first version that always has block
+// positions.
+const BackupPositionsVersion = 5
+
+const (
+	RestoreReplace = "replace"
+	RestoreMerge   = "merge"
+)
+
+// Backup is the versioned document produced by the backup endpoint. It
+// keeps its own JSON layout so API changes do not break old snapshots.
+type Backup struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	Admins    []string      `json:"admins"`
+	Events    []BackupEvent `json:"events"`
+
+	AcademicPeriods []AcademicPeriod `json:"academic_periods,omitempty"`
+	Rooms           []Room           `json:"rooms,omitempty"`
+}
+
+type BackupEvent struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	Blocks      []BackupBlock `json:"blocks"`
+
+	// ParentID is the backup id of the series parent.
+	ParentID *int `json:"parent_id,omitempty"`
+
+	// Tags and Audience are the event's own, a stage without them has
+	// those of its parent.
+	Tags     pq.StringArray `json:"tags,omitempty"`
+	Audience pq.StringArray `json:"audience,omitempty"`
+
+	Attachments  []BackupAttachment  `json:"attachments,omitempty"`
+	Translations []BackupTranslation `json:"translations,omitempty"`
+}
+
+// BackupTranslation is the name and description of an event or a block
+// in a locale other than DefaultLocale.
+type BackupTranslation struct {
+	Locale      string    `json:"locale"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BackupAttachment describes an attachment, the file stays in storage
+// under StorageKey and is not part of the backup.
+type BackupAttachment struct {
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        *int      `json:"width,omitempty"`
+	Height       *int      `json:"height,omitempty"`
+	StorageKey   string    `json:"storage_key"`
+	ThumbnailKey *string   `json:"thumbnail_key,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type BackupBlock struct {
+	ID          int       `json:"id"`
+	EventID     int       `json:"event_id"`
+	UID         string    `json:"uid"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	AllDay      bool      `json:"all_day,omitempty"`
+	Link        string    `json:"link"`
+	RRule       string    `json:"rrule,omitempty"`
+	Room        string    `json:"room,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Capacity             *int       `json:"capacity,omitempty"`
+	RegistrationDeadline *time.Time `json:"registration_deadline,omitempty"`
+	Position             int        `json:"position"`
+
+	Exceptions   []BlockException    `json:"exceptions,omitempty"`
+	Translations []BackupTranslation `json:"translations,omitempty"`
+}
+
+type RestoreReport struct {
+	Mode            string `json:"mode"`
+	Events          int    `json:"events"`
+	Blocks          int    `json:"blocks"`
+	AcademicPeriods int    `json:"academic_periods"`
+	Rooms           int    `json:"rooms"`
+	Attachments     int    `json:"attachments"`
+	Translations    int    `json:"translations"`
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+const (
+	BatchEvent = "event"
+	BatchBlock = "block"
+)
+
+const (
+	BatchOK         = "ok"
+	BatchFailed     = "error"
+	BatchRolledBack = "rolled_back"
+	BatchSkipped    = "skipped"
+)
+
+// BatchOperation is one write of a batch. Created events may be named with
+// Ref, blocks created later in the batch point at them with EventRef.
+type BatchOperation struct {
+	Op       string      `json:"op"`
+	Type     string      `json:"type"`
+	ID       int         `json:"id"`
+	Ref      string      `json:"ref"`
+	EventRef string      `json:"event_ref"`
+	Event    *Event      `json:"event"`
+	Block    *EventBlock `json:"block"`
+	Changes  *BlockPatch `json:"changes"`
+}
+
+type BatchResult struct {
+	Index     int             `json:"index"`
+	Status    string          `json:"status"`
+	ID        int             `json:"id,omitempty"`
+	EventID   int             `json:"event_id,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Conflicts []BlockConflict `json:"conflicts,omitempty"`
+}
+
+// BatchError stops an atomic batch, nothing of it is written.
+type BatchError struct {
+	Index   int
+	Message string
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Message)
+}
+
+// BlockPatch changes a block, nil fields are kept. Name, description and
+// link are always replaced. Zero location, capacity and deadline clear
+// them.
+type BlockPatch struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Link        string    `json:"link"`
+	StartDate   *DateTime `json:"start_date"`
+	EndDate     *DateTime `json:"end_date"`
+	AllDay      *bool     `json:"all_day"`
+	RRule       *string   `json:"rrule"`
+	LocationID  *int      `json:"location_id"`
+	Capacity    *int      `json:"capacity"`
+
+	RegistrationDeadline *time.Time `json:"registration_deadline"`
+}
+
+func (p BlockPatch) Apply(block *EventBlock) {
+	block.Name = p.Name
+	block.Description = p.Description
+	block.Link = p.Link
+	if p.StartDate != nil {
+		block.StartDate = p.StartDate.Time
+	}
+	if p.EndDate != nil {
+		block.EndDate = p.EndDate.BlockEnd()
+	}
+	if p.AllDay != nil {
+		block.AllDay = *p.AllDay
+	}
+	if p.RRule != nil {
+		block.RRule = *p.RRule
+	}
+	if p.LocationID != nil {
+		block.LocationID = p.LocationID
+		if *p.LocationID == 0 {
+			block.LocationID = nil
+		}
+	}
+	if p.Capacity != nil {
+		block.Capacity = p.Capacity
+		if *p.Capacity == 0 {
+			block.Capacity = nil
+		}
+	}
+	if p.RegistrationDeadline != nil {
+		block.RegistrationDeadline = p.RegistrationDeadline
+		if p.RegistrationDeadline.IsZero() {
+			block.RegistrationDeadline = nil
+		}
+	}
+}
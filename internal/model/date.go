@@ -0,0 +1,128 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day without time of day, it is written as
+// "2006-01-02" in JSON and maps to the SQL DATE type.
+type Date struct {
+	time.Time
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateOf returns the day t falls on in its own location.
+func DateOf(t time.Time) Date {
+	return NewDate(t.Year(), t.Month(), t.Day())
+}
+
+func ParseDate(value string) (Date, error) {
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return Date{t}, nil
+}
+
+// In returns the start of the day in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case time.Time:
+		*d = DateOf(value)
+		return nil
+	case string:
+		parsed, err := ParseDate(value[:min(len(value), len(DateLayout))])
+		*d = parsed
+		return err
+	case []byte:
+		return d.Scan(string(value))
+	}
+	return fmt.Errorf("can not scan %T into Date", src)
+}
+
+// floating is the location of times read from a bare date. Such a time
+// names a day rather than an instant, see DayIn.
+var floating = time.FixedZone("floating", 0)
+
+// DayIn returns midnight of t's day in loc. Times read from a bare date
+// keep their day, other times are converted to loc first.
+func DayIn(t time.Time, loc *time.Location) time.Time {
+	if t.Location() != floating {
+		t = t.In(loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// DateTime is a JSON time that also accepts a bare "2006-01-02" date, as
+// sent for all-day blocks.
+type DateTime struct {
+	time.Time
+	DateOnly bool
+}
+
+func (d *DateTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if len(value) == len(DateLayout) {
+		parsed, err := ParseDate(value)
+		if err != nil {
+			return err
+		}
+		*d = DateTime{Time: parsed.In(floating), DateOnly: true}
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+	}
+	*d = DateTime{Time: parsed}
+	return nil
+}
+
+// BlockEnd returns the end of a block that ends at d. A bare date names the
+// last day of an all-day block, which ends at the start of the next day.
+func (d DateTime) BlockEnd() time.Time {
+	if d.DateOnly {
+		return d.AddDate(0, 0, 1)
+	}
+	return d.Time
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDayInKeepsBareDates(t *testing.T) {
+	for _, zone := range []string{"America/New_York", "Europe/Moscow", "Pacific/Kiritimati"} {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Skip("no tzdata")
+		}
+		var value DateTime
+		if err := json.Unmarshal([]byte(`"2026-03-02"`), &value); err != nil {
+			t.Fatal(err)
+		}
+		day := DayIn(value.Time, loc)
+		if want := time.Date(2026, time.March, 2, 0, 0, 0, 0, loc); !day.Equal(want) {
+			t.Errorf("%s: got %s, want %s", zone, day, want)
+		}
+		if end := DayIn(value.BlockEnd(), loc); end.Day() != 3 {
+			t.Errorf("%s: block end is on %s", zone, end)
+		}
+	}
+}
+
+func TestDayInConvertsInstants(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	var value DateTime
+	if err := json.Unmarshal([]byte(`"2026-03-02T03:00:00Z"`), &value); err != nil {
+		t.Fatal(err)
+	}
+	if day := DayIn(value.Time, loc); day.Day() != 1 {
+		t.Errorf("got %s, want March 1 in New York", day)
+	}
+}
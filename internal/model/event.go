@@ -1,20 +1,214 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOwnParent      = errors.New("event can not be its own parent")
+	ErrParentNotFound = errors.New("parent event not found")
+	ErrParentIsStage  = errors.New("parent event is a stage of another series")
+	ErrHasStages      = errors.New("event has stages of its own")
+)
 
 type Event struct {
 	ID          int          `db:"id" json:"id"`
 	Name        string       `db:"name" json:"name"`
 	Description string       `db:"description" json:"description"`
+	CreatedAt   time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time    `db:"updated_at" json:"updated_at"`
 	EventBlocks []EventBlock `json:"event_blocks"`
+	Attachments []Attachment `db:"-" json:"attachments,omitempty"`
+
+	// ParentID links the event to the series it is a stage of. Series are
+	// one level deep, a parent never has a parent of its own.
+	ParentID *int `db:"parent_id" json:"parent_id"`
+
+	// Tags and Audience label the event. A stage with none of its own has
+	// those of its parent. Saving nil keeps the stored labels.
+	Tags     pq.StringArray `db:"tags" json:"tags"`
+	Audience pq.StringArray `db:"audience" json:"audience"`
 }
 
 type EventBlock struct {
 	ID          int       `db:"id" json:"id"`
 	EventID     int       `db:"event_id" json:"event_id"`
+	UID         string    `db:"uid" json:"uid"`
 	Name        string    `db:"name" json:"name"`
 	Description string    `db:"description" json:"description"`
 	StartDate   time.Time `db:"start_date" json:"start_date"`
 	EndDate     time.Time `db:"end_date" json:"end_date"`
+	AllDay      bool      `db:"all_day" json:"all_day"`
 	Link        string    `db:"link" json:"link"`
+	RRule       string    `db:"rrule" json:"rrule,omitempty"`
+	LocationID  *int      `db:"location_id" json:"location_id"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+
+	// Position orders the blocks of an event for display, blocks at the
+	// same position go by start_date. New blocks are put last.
+	Position int `db:"position" json:"position"`
+
+	Capacity             *int       `db:"capacity" json:"capacity"`
+	RegistrationDeadline *time.Time `db:"registration_deadline" json:"registration_deadline"`
+
+	Exceptions   []BlockException `db:"-" json:"exceptions,omitempty"`
+	RecurrenceID *time.Time       `db:"-" json:"recurrence_id,omitempty"`
+}
+
+// MaxDescriptionLength limits event and block descriptions, in bytes.
+const MaxDescriptionLength = 20000
+
+// descriptionJSON adds the rendered description to JSON output, so every
+// client shows the same HTML. description stays for older clients.
+type descriptionJSON struct {
+	DescriptionMD   string `json:"description_md"`
+	DescriptionHTML string `json:"description_html"`
+}
+
+func describe(description string) descriptionJSON {
+	return descriptionJSON{
+		DescriptionMD:   description,
+		DescriptionHTML: renderedDescriptions.render(description),
+	}
+}
+
+type eventJSON Event
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		eventJSON
+		descriptionJSON
+	}{
+		eventJSON:       eventJSON(e),
+		descriptionJSON: describe(e.Description),
+	})
+}
+
+type eventBlockJSON EventBlock
+
+// MarshalJSON writes all-day blocks as dates, end_date being the last day
+// of the block. Times are written in their own location, see Localize.
+func (b EventBlock) MarshalJSON() ([]byte, error) {
+	if !b.AllDay {
+		return json.Marshal(struct {
+			eventBlockJSON
+			descriptionJSON
+		}{
+			eventBlockJSON:  eventBlockJSON(b),
+			descriptionJSON: describe(b.Description),
+		})
+	}
+	return json.Marshal(struct {
+		eventBlockJSON
+		descriptionJSON
+		StartDate Date `json:"start_date"`
+		EndDate   Date `json:"end_date"`
+	}{
+		eventBlockJSON:  eventBlockJSON(b),
+		descriptionJSON: describe(b.Description),
+		StartDate:       DateOf(b.StartDate),
+		EndDate:         DateOf(b.EndDate.Add(-time.Nanosecond)),
+	})
+}
+
+// UnmarshalJSON accepts bare dates for start_date and end_date, a bare
+// end_date names the last day of the block.
+func (b *EventBlock) UnmarshalJSON(data []byte) error {
+	var input struct {
+		*eventBlockJSON
+		StartDate DateTime `json:"start_date"`
+		EndDate   DateTime `json:"end_date"`
+	}
+	input.eventBlockJSON = (*eventBlockJSON)(b)
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	b.StartDate = input.StartDate.Time
+	b.EndDate = input.EndDate.BlockEnd()
+	return nil
+}
+
+// Localize returns the block with its times in loc. All-day blocks are
+// moved to the school location, so they stay on their days.
+func (b EventBlock) Localize(loc *time.Location, school *time.Location) EventBlock {
+	if b.AllDay {
+		loc = school
+	}
+	b.StartDate = b.StartDate.In(loc)
+	b.EndDate = b.EndDate.In(loc)
+	if b.RecurrenceID != nil {
+		recurrenceId := b.RecurrenceID.In(loc)
+		b.RecurrenceID = &recurrenceId
+	}
+	if b.RegistrationDeadline != nil {
+		deadline := b.RegistrationDeadline.In(loc)
+		b.RegistrationDeadline = &deadline
+	}
+	b.CreatedAt = b.CreatedAt.In(loc)
+	b.UpdatedAt = b.UpdatedAt.In(loc)
+	return b
+}
+
+func (e Event) Localize(loc *time.Location, school *time.Location) Event {
+	e.CreatedAt = e.CreatedAt.In(loc)
+	e.UpdatedAt = e.UpdatedAt.In(loc)
+	if e.EventBlocks != nil {
+		blocks := make([]EventBlock, len(e.EventBlocks))
+		for i, block := range e.EventBlocks {
+			blocks[i] = block.Localize(loc, school)
+		}
+		e.EventBlocks = blocks
+	}
+	return e
+}
+
+// BlockException cancels or overrides a single occurrence of a recurring
+// block. Nil fields are inherited from the block.
+type BlockException struct {
+	ID           int        `db:"id" json:"id"`
+	BlockID      int        `db:"block_id" json:"block_id"`
+	RecurrenceID time.Time  `db:"recurrence_id" json:"recurrence_id"`
+	Cancelled    bool       `db:"cancelled" json:"cancelled"`
+	Name         *string    `db:"name" json:"name,omitempty"`
+	Description  *string    `db:"description" json:"description,omitempty"`
+	StartDate    *time.Time `db:"start_date" json:"start_date,omitempty"`
+	EndDate      *time.Time `db:"end_date" json:"end_date,omitempty"`
+	Link         *string    `db:"link" json:"link,omitempty"`
+}
+
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+	ScopeAll       = "all"
+)
+
+// OccurrenceEdit changes one occurrence of a recurring block, the ones
+// after it too or the whole series, depending on Scope.
+type OccurrenceEdit struct {
+	BlockID      int
+	RecurrenceID time.Time
+	Scope        string
+	Cancel       bool
+	Name         *string
+	Description  *string
+	StartDate    *time.Time
+	EndDate      *time.Time
+	Link         *string
+}
+
+// LastModified returns the latest modification time of the event and its
+// blocks.
+func (e Event) LastModified() time.Time {
+	last := e.UpdatedAt
+	for _, block := range e.EventBlocks {
+		if block.UpdatedAt.After(last) {
+			last = block.UpdatedAt
+		}
+	}
+	return last
 }
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+type Feed struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
@@ -0,0 +1,75 @@
+package model
+
+import "errors"
+
+// ErrUnsupportedFormat is returned for export formats other than csv and
+// xlsx.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+)
+
+// ImportBlock is one unit of an import. Block is nil for rows that only
+// describe an event.
+type ImportBlock struct {
+	Row              int
+	EventID          int
+	EventName        string
+	EventDescription string
+	Block            *EventBlock
+
+	// KeepRRule leaves the rule of a stored block matched by uid as it is,
+	// the source has no column for it.
+	KeepRRule bool
+}
+
+type ImportResult struct {
+	Row          int    `json:"row,omitempty"`
+	UID          string `json:"uid,omitempty"`
+	Action       string `json:"action,omitempty"`
+	BlockID      int    `json:"block_id,omitempty"`
+	EventID      int    `json:"event_id,omitempty"`
+	EventName    string `json:"event_name"`
+	EventCreated bool   `json:"event_created"`
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun  bool             `json:"dry_run"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Results []ImportResult   `json:"results"`
+	Errors  []ImportRowError `json:"errors,omitempty"`
+}
+
+type ImportTarget struct {
+	EventID          int
+	EventName        string
+	EventDescription string
+}
+
+type ExportFile struct {
+	Name        string
+	ContentType string
+	Body        []byte
+}
+
+// ImportError is a problem with the imported file itself, as opposed to a
+// failure to store it.
+type ImportError struct {
+	Err error
+}
+
+func (e *ImportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
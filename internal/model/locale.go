@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// DefaultLocale is the language events are written in. Other locales are
+// served from translations and fall back to it field by field.
+const DefaultLocale = "ru"
+
+var Locales = []string{"ru", "en"}
+
+func IsLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Translation holds the name and description of an event or a block in a
+// locale other than DefaultLocale. Empty fields are not translated.
+type Translation struct {
+	ID          int       `db:"id" json:"id"`
+	EventID     *int      `db:"event_id" json:"event_id,omitempty"`
+	BlockID     *int      `db:"block_id" json:"block_id,omitempty"`
+	Locale      string    `db:"locale" json:"locale"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
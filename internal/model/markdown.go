@@ -0,0 +1,702 @@
+package model
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	headingRe        = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*))?$`)
+	ruleRe           = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceRe          = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	quoteRe          = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	listItemRe       = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:( +)(.*))?$`)
+	tableSeparatorRe = regexp.MustCompile(`^ *\|? *:?-+:? *(?:\| *:?-+:? *)*\|? *$`)
+	codeLanguageRe   = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+const (
+	// maxMarkdownNesting bounds nested quotes, lists, emphasis and links,
+	// deeper markup is written as text. Each level goes over its lines
+	// again, so the bound keeps rendering linear.
+	maxMarkdownNesting = 16
+	// maxInlineScan bounds how far ahead link labels, destinations, titles
+	// and autolinks are looked for.
+	maxInlineScan = 2048
+)
+
+// emphasisTags wraps text by the length of its delimiter run.
+var emphasisTags = map[int][2]string{
+	1: {"<em>", "</em>"},
+	2: {"<strong>", "</strong>"},
+	3: {"<strong><em>", "</em></strong>"},
+}
+
+// RenderMarkdown turns a Markdown description into HTML. Raw HTML in the
+// source is escaped, so the result only has the tags made here, and links
+// keep only http, https, mailto and tel addresses or relative ones. Line
+// breaks inside a paragraph are kept, as people type them that way.
+func RenderMarkdown(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(source, "\n"), false, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderedDescriptions keeps recent renderings, as every event and block in
+// every response carries its rendered description.
+var renderedDescriptions = newMarkdownCache(8 << 20)
+
+// markdownCache maps Markdown sources to their HTML. It keeps two
+// generations: when the current one reaches limit bytes it becomes the
+// previous one, and entries read from the previous one move back.
+type markdownCache struct {
+	mu       sync.Mutex
+	limit    int
+	size     int
+	current  map[string]string
+	previous map[string]string
+}
+
+func newMarkdownCache(limit int) *markdownCache {
+	return &markdownCache{
+		limit:   limit,
+		current: make(map[string]string),
+	}
+}
+
+func (c *markdownCache) render(source string) string {
+	if source == "" {
+		return ""
+	}
+	c.mu.Lock()
+	rendered, ok := c.current[source]
+	if !ok {
+		if rendered, ok = c.previous[source]; ok {
+			c.add(source, rendered)
+		}
+	}
+	c.mu.Unlock()
+	if ok {
+		return rendered
+	}
+	rendered = RenderMarkdown(source)
+	c.mu.Lock()
+	c.add(source, rendered)
+	c.mu.Unlock()
+	return rendered
+}
+
+func (c *markdownCache) add(source string, rendered string) {
+	size := len(source) + len(rendered)
+	if c.size+size > c.limit {
+		c.previous = c.current
+		c.current = make(map[string]string)
+		c.size = 0
+	}
+	c.current[source] = rendered
+	c.size += size
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// startsBlock tells whether line ends a paragraph by starting another
+// block.
+func startsBlock(lines []string, i int) bool {
+	line := lines[i]
+	if headingRe.MatchString(line) || ruleRe.MatchString(line) || fenceRe.MatchString(line) || quoteRe.MatchString(line) {
+		return true
+	}
+	if item, ok := parseListItem(line); ok && item.content != "" {
+		return true
+	}
+	return isTableStart(lines, i)
+}
+
+// renderBlocks writes the blocks of lines. Tight list items have their
+// paragraphs written without <p>. depth counts the quotes and lists around
+// lines, past maxMarkdownNesting their markers are kept as text.
+func renderBlocks(b *strings.Builder, lines []string, tight bool, depth int) {
+	nested := depth < maxMarkdownNesting
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRe.MatchString(line):
+			i = renderCodeBlock(b, lines, i)
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			text := strings.TrimSpace(m[2])
+			if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+				text = strings.TrimSpace(trimmed)
+			}
+			tag := "h" + strconv.Itoa(len(m[1]))
+			b.WriteString("<" + tag + ">")
+			renderInline(b, text, depth)
+			b.WriteString("</" + tag + ">\n")
+			i++
+		case ruleRe.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case nested && quoteRe.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteRe.FindStringSubmatch(lines[i])[1])
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, false, depth+1)
+			b.WriteString("</blockquote>\n")
+		case isTableStart(lines, i):
+			i = renderTable(b, lines, i, depth)
+		default:
+			if _, ok := parseListItem(line); ok && nested {
+				i = renderList(b, lines, i, depth)
+				continue
+			}
+			start := i
+			for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines, i); i++ {
+			}
+			paragraph := make([]string, 0, i-start)
+			for _, l := range lines[start:i] {
+				paragraph = append(paragraph, strings.TrimSpace(l))
+			}
+			if !tight {
+				b.WriteString("<p>")
+			}
+			renderInline(b, strings.Join(paragraph, "\n"), depth)
+			if !tight {
+				b.WriteString("</p>")
+			}
+			b.WriteString("\n")
+		}
+	}
+}
+
+func renderCodeBlock(b *strings.Builder, lines []string, i int) int {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	fence := m[1]
+	b.WriteString("<pre><code")
+	if codeLanguageRe.MatchString(m[2]) {
+		b.WriteString(` class="language-` + m[2] + `"`)
+	}
+	b.WriteString(">")
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		b.WriteString(html.EscapeString(lines[i]) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+type listItem struct {
+	ordered bool
+	bullet  byte
+	start   int
+	// contentIndent is the column where the item text starts, lines
+	// indented that far belong to the item.
+	contentIndent int
+	content       string
+}
+
+func parseListItem(line string) (listItem, bool) {
+	m := listItemRe.FindStringSubmatch(line)
+	if m == nil || ruleRe.MatchString(line) {
+		return listItem{}, false
+	}
+	item := listItem{content: m[4]}
+	marker := m[2]
+	if last := marker[len(marker)-1]; last == '.' || last == ')' {
+		item.ordered = true
+		item.bullet = last
+		item.start, _ = strconv.Atoi(marker[:len(marker)-1])
+	} else {
+		item.bullet = marker[0]
+	}
+	spaces := len(m[3])
+	if spaces == 0 || spaces > 4 {
+		spaces = 1
+	}
+	item.contentIndent = len(m[1]) + len(marker) + spaces
+	return item, true
+}
+
+func sameList(a listItem, b listItem) bool {
+	return a.ordered == b.ordered && a.bullet == b.bullet
+}
+
+// renderList writes the list starting at lines[i] and returns the index
+// of the first line after it. Lists with blank lines between or inside
+// items are loose and get paragraphs.
+func renderList(b *strings.Builder, lines []string, i int, depth int) int {
+	first, _ := parseListItem(lines[i])
+	current := first
+	items := [][]string{}
+	itemLines := []string{first.content}
+	loose := false
+	for i++; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			next := i
+			for next < len(lines) && isBlank(lines[next]) {
+				next++
+			}
+			if next == len(lines) {
+				i = next
+				break
+			}
+			if indentOf(lines[next]) >= current.contentIndent {
+				for ; i < next; i++ {
+					itemLines = append(itemLines, "")
+				}
+				loose = true
+				continue
+			}
+			if item, ok := parseListItem(lines[next]); ok && sameList(item, first) {
+				loose = true
+				i = next
+				continue
+			}
+			break
+		}
+		if indentOf(line) >= current.contentIndent {
+			itemLines = append(itemLines, line[current.contentIndent:])
+			i++
+			continue
+		}
+		if ruleRe.MatchString(line) {
+			break
+		}
+		if item, ok := parseListItem(line); ok {
+			if !sameList(item, first) {
+				break
+			}
+			items = append(items, itemLines)
+			itemLines = []string{item.content}
+			current = item
+			i++
+			continue
+		}
+		if startsBlock(lines, i) {
+			break
+		}
+		// A lazy continuation of the item's paragraph.
+		itemLines = append(itemLines, strings.TrimSpace(line))
+		i++
+	}
+	items = append(items, itemLines)
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		var inner strings.Builder
+		renderBlocks(&inner, item, !loose, depth+1)
+		b.WriteString(strings.TrimSuffix(inner.String(), "\n"))
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func isTableStart(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.Contains(lines[i], "|") && strings.Contains(lines[i+1], "-") && tableSeparatorRe.MatchString(lines[i+1])
+}
+
+// splitRow splits a table row on pipes that are not escaped.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, strings.TrimSpace(line[start:i]))
+			start = i + 1
+		}
+	}
+	return append(cells, strings.TrimSpace(line[start:]))
+}
+
+func renderTable(b *strings.Builder, lines []string, i int, depth int) int {
+	header := splitRow(lines[i])
+	aligns := make([]string, len(header))
+	for j, cell := range splitRow(lines[i+1]) {
+		if j >= len(aligns) {
+			break
+		}
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns[j] = "center"
+		case strings.HasSuffix(cell, ":"):
+			aligns[j] = "right"
+		case strings.HasPrefix(cell, ":"):
+			aligns[j] = "left"
+		}
+	}
+	writeRow := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for j := range header {
+			b.WriteString("<" + tag)
+			if aligns[j] != "" {
+				b.WriteString(` style="text-align: ` + aligns[j] + `"`)
+			}
+			b.WriteString(">")
+			if j < len(cells) {
+				renderInline(b, cells[j], depth)
+			}
+			b.WriteString("</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	b.WriteString("</thead>\n")
+	i += 2
+	if i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|") {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|"); i++ {
+			writeRow(splitRow(lines[i]), "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func isWordChar(c byte) bool {
+	return c >= 0x80 || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func runLength(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// renderInline writes escaped text with code spans, emphasis, links,
+// images and autolinks. Past maxMarkdownNesting the text is only escaped.
+func renderInline(b *strings.Builder, s string, depth int) {
+	if depth >= maxMarkdownNesting {
+		b.WriteString(html.EscapeString(s))
+		return
+	}
+	// unclosed holds delimiter runs that found no closing run. Later runs
+	// would look through less of s, so they are not looked for again.
+	unclosed := make(map[string]bool)
+	text := 0
+	flush := func(i int) {
+		b.WriteString(html.EscapeString(s[text:i]))
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (isPunct(s[i+1]) || s[i+1] == '\n'):
+			flush(i)
+			if s[i+1] == '\n' {
+				b.WriteString("<br>\n")
+			} else {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			}
+			i += 2
+			text = i
+			continue
+		case c == '\n':
+			flush(i)
+			b.WriteString("<br>\n")
+			i++
+			text = i
+			continue
+		case c == '`':
+			n := runLength(s, i)
+			if unclosed[s[i:i+n]] {
+				i += n
+				continue
+			}
+			if end := findRun(s, i+n, '`', n); end >= 0 {
+				flush(i)
+				code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end + n
+				text = i
+				continue
+			}
+			unclosed[s[i:i+n]] = true
+			i += n
+			continue
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if link, ok := parseLink(s, i+1); ok {
+				flush(i)
+				if href, ok := safeURL(link.dest, false); ok {
+					b.WriteString(`<img src="` + html.EscapeString(href) + `" alt="` + html.EscapeString(link.label) + `"`)
+					if link.title != "" {
+						b.WriteString(` title="` + html.EscapeString(link.title) + `"`)
+					}
+					b.WriteString(">")
+				} else {
+					b.WriteString(html.EscapeString(link.label))
+				}
+				i = link.end
+				text = i
+				continue
+			}
+		case c == '[':
+			if link, ok := parseLink(s, i); ok {
+				flush(i)
+				href, ok := safeURL(link.dest, true)
+				if ok {
+					b.WriteString(`<a href="` + html.EscapeString(href) + `"`)
+					if link.title != "" {
+						b.WriteString(` title="` + html.EscapeString(link.title) + `"`)
+					}
+					b.WriteString(` rel="nofollow noopener">`)
+				}
+				renderInline(b, link.label, depth+1)
+				if ok {
+					b.WriteString("</a>")
+				}
+				i = link.end
+				text = i
+				continue
+			}
+		case c == '<':
+			if end := strings.IndexByte(s[i:min(len(s), i+maxInlineScan)], '>'); end > 1 && !strings.ContainsAny(s[i+1:i+end], " <\n") {
+				target := s[i+1 : i+end]
+				if !strings.Contains(target, ":") && strings.Contains(target, "@") {
+					target = "mailto:" + target
+				}
+				if href, ok := safeURL(target, true); ok && strings.Contains(href, ":") {
+					flush(i)
+					b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + html.EscapeString(s[i+1:i+end]) + "</a>")
+					i += end + 1
+					text = i
+					continue
+				}
+			}
+		case c == '*' || c == '_' || c == '~':
+			if end, n, ok := findEmphasis(s, i, unclosed); ok {
+				flush(i)
+				tags := emphasisTags[n]
+				if c == '~' {
+					tags = [2]string{"<del>", "</del>"}
+				}
+				b.WriteString(tags[0])
+				renderInline(b, s[i+n:end], depth+1)
+				b.WriteString(tags[1])
+				i = end + n
+				text = i
+				continue
+			}
+			i += runLength(s, i)
+			continue
+		case c == 'h' && (i == 0 || !isWordChar(s[i-1])) && (strings.HasPrefix(s[i:], "http://") || strings.HasPrefix(s[i:], "https://")):
+			end, limit := i, min(len(s), i+maxInlineScan)
+			for end < limit && !isSpace(s[end]) && s[end] != '<' {
+				end++
+			}
+			raw := strings.TrimRight(s[i:end], ".,:;!?'\"")
+			for strings.HasSuffix(raw, ")") && strings.Count(raw, ")") > strings.Count(raw, "(") {
+				raw = raw[:len(raw)-1]
+			}
+			if href, ok := safeURL(raw, false); ok && (end < limit || limit == len(s)) && strings.Contains(raw[strings.Index(raw, "//")+2:], ".") {
+				flush(i)
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + html.EscapeString(raw) + "</a>")
+				i += len(raw)
+				text = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(s))
+}
+
+// findRun returns the index of the next run of exactly n c bytes at or
+// after from, or -1.
+func findRun(s string, from int, c byte, n int) int {
+	for i := from; i < len(s); {
+		if s[i] != c {
+			i++
+			continue
+		}
+		run := runLength(s, i)
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+// findEmphasis matches the delimiter run at i with a closing run of the
+// same length. Underscores do not work inside words, so snake_case stays
+// as it is. Runs that find no closing run are added to unclosed.
+func findEmphasis(s string, i int, unclosed map[string]bool) (int, int, bool) {
+	c := s[i]
+	n := runLength(s, i)
+	if c == '~' && n != 2 || n > 3 {
+		return 0, 0, false
+	}
+	if i+n >= len(s) || isSpace(s[i+n]) {
+		return 0, 0, false
+	}
+	if c == '_' && i > 0 && isWordChar(s[i-1]) {
+		return 0, 0, false
+	}
+	if unclosed[s[i:i+n]] {
+		return 0, 0, false
+	}
+	for from := i + n; ; {
+		end := findRun(s, from, c, n)
+		if end < 0 {
+			unclosed[s[i:i+n]] = true
+			return 0, 0, false
+		}
+		from = end + n
+		if end == i+n || isSpace(s[end-1]) {
+			continue
+		}
+		if c == '_' && end+n < len(s) && isWordChar(s[end+n]) {
+			continue
+		}
+		return end, n, true
+	}
+}
+
+type inlineLink struct {
+	label string
+	dest  string
+	title string
+	end   int
+}
+
+// parseLink reads [label](dest "title") starting at the opening bracket.
+// Links longer than maxInlineScan are left as text.
+func parseLink(s string, i int) (inlineLink, bool) {
+	s = s[:min(len(s), i+maxInlineScan)]
+	depth := 0
+	close := -1
+	for j := i; j < len(s) && close < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				close = j
+			}
+		}
+	}
+	if close < 0 || close+1 >= len(s) || s[close+1] != '(' {
+		return inlineLink{}, false
+	}
+	link := inlineLink{label: s[i+1 : close]}
+	j := close + 2
+	for j < len(s) && s[j] == ' ' {
+		j++
+	}
+	if j < len(s) && s[j] == '<' {
+		end := strings.IndexByte(s[j:], '>')
+		if end < 0 {
+			return inlineLink{}, false
+		}
+		link.dest = s[j+1 : j+end]
+		j += end + 1
+	} else {
+		start, parens := j, 0
+		for ; j < len(s) && !isSpace(s[j]); j++ {
+			if s[j] == '(' {
+				parens++
+			} else if s[j] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		link.dest = s[start:j]
+	}
+	for j < len(s) && isSpace(s[j]) {
+		j++
+	}
+	if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+		end := strings.IndexByte(s[j+1:], s[j])
+		if end < 0 {
+			return inlineLink{}, false
+		}
+		link.title = s[j+1 : j+1+end]
+		j += end + 2
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+	}
+	if j >= len(s) || s[j] != ')' {
+		return inlineLink{}, false
+	}
+	link.end = j + 1
+	return link, true
+}
+
+// safeURL accepts relative addresses and http or https ones, and mailto
+// and tel for links.
+func safeURL(raw string, link bool) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.IndexFunc(raw, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return raw, true
+	case "mailto", "tel":
+		return raw, link
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"# Title", "<h1>Title</h1>"},
+		{"*em* **strong** `code` ~~del~~", "<p><em>em</em> <strong>strong</strong> <code>code</code> <del>del</del></p>"},
+		{"line\nnext", "<p>line<br>\nnext</p>"},
+		{"- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>"},
+		{"3. a\n4. b", "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>"},
+		{"> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>"},
+		{"[site](https://example.com \"Site\")", `<p><a href="https://example.com" title="Site" rel="nofollow noopener">site</a></p>`},
+		{"snake_case_name", "<p>snake_case_name</p>"},
+		{"| a | b |\n|---|--:|\n| 1 | 2 |", "<table>\n<thead>\n<tr><th>a</th><th style=\"text-align: right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td style=\"text-align: right\">2</td></tr>\n</tbody>\n</table>"},
+	}
+	for _, tt := range tests {
+		if got := RenderMarkdown(tt.source); got != tt.want {
+			t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdownEscapes(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>"},
+		{"[click](javascript:alert(1))", "<p>click</p>"},
+		{"[click](JavaScript:alert(1))", "<p>click</p>"},
+		{"[click](java\tscript:alert(1))", "<p>[click](java    script:alert(1))</p>"},
+		{"[click](data:text/html;base64,PHNjcmlwdD4=)", "<p>click</p>"},
+		{"![x](javascript:alert(1))", "<p>x</p>"},
+		{"![x](mailto:a@b.c)", "<p>x</p>"},
+		{"<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{`[x](http://a.b "t\" onmouseover=\"alert(1)")`, `<p>[x](<a href="http://a.b" rel="nofollow noopener">http://a.b</a> &#34;t&#34; onmouseover=&#34;alert(1)&#34;)</p>`},
+		{`[x](http://a.b 't" onmouseover="alert(1)')`, `<p><a href="http://a.b" title="t&#34; onmouseover=&#34;alert(1)" rel="nofollow noopener">x</a></p>`},
+		{"[x](http://a.b/\"><script>)", `<p><a href="http://a.b/&#34;&gt;&lt;script&gt;" rel="nofollow noopener">x</a></p>`},
+		{"```\"><script>\n</script>\n```", "<pre><code>&lt;/script&gt;\n</code></pre>"},
+		{"`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+	}
+	for _, tt := range tests {
+		if got := RenderMarkdown(tt.source); got != tt.want {
+			t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdownNestingLimit(t *testing.T) {
+	source := strings.Repeat(">", maxMarkdownNesting+4) + " deep"
+	got := RenderMarkdown(source)
+	if n := strings.Count(got, "<blockquote>"); n != maxMarkdownNesting {
+		t.Errorf("%d quotes, want %d", n, maxMarkdownNesting)
+	}
+	if !strings.Contains(got, "&gt;&gt;&gt;&gt; deep") {
+		t.Errorf("deeper quotes are not kept as text: %q", got)
+	}
+
+	var list strings.Builder
+	for i := 0; i < maxMarkdownNesting+4; i++ {
+		list.WriteString(strings.Repeat("  ", i) + "- item\n")
+	}
+	if n := strings.Count(RenderMarkdown(list.String()), "<ul>"); n != maxMarkdownNesting {
+		t.Errorf("%d lists, want %d", n, maxMarkdownNesting)
+	}
+
+	links := strings.Repeat("[", maxMarkdownNesting+4) + "x" + strings.Repeat("](http://a.b)", maxMarkdownNesting+4)
+	if n := strings.Count(RenderMarkdown(links), "<a "); n != maxMarkdownNesting {
+		t.Errorf("%d nested links, want %d", n, maxMarkdownNesting)
+	}
+}
+
+// TestRenderMarkdownPathological renders descriptions built to make a
+// naive renderer go over the source again and again. Doubling the length
+// of one past the maximum has to take about twice as long, not four
+// times. Shorter sources are not compared, the regexp engine switches to
+// a slower matcher for long lines.
+func TestRenderMarkdownPathological(t *testing.T) {
+	indented := func(n int) string {
+		var b strings.Builder
+		for i := 0; b.Len() < n; i++ {
+			b.WriteString(strings.Repeat(" ", 2*(i%200)) + "- x\n")
+		}
+		return b.String()
+	}
+	sources := map[string]func(n int) string{
+		"nested quotes":     func(n int) string { return strings.Repeat(">", n) },
+		"quote lines":       func(n int) string { return strings.Repeat(strings.Repeat(">", 200)+" x\n", n/203) },
+		"nested list items": func(n int) string { return strings.Repeat("- ", n/2) + "x" },
+		"indented lists":    indented,
+		"open brackets":     func(n int) string { return strings.Repeat("[", n) },
+		"open links":        func(n int) string { return strings.Repeat("[](", n/3) },
+		"open emphasis":     func(n int) string { return strings.Repeat("*a ", n/3) },
+		"nested emphasis":   func(n int) string { return strings.Repeat("*x ", n/6) + strings.Repeat("x* ", n/6) },
+		"backticks":         func(n int) string { return strings.Repeat("`` ` ", n/5) },
+		"angle brackets":    func(n int) string { return strings.Repeat("<", n-1) + ">" },
+		"bare urls":         func(n int) string { return strings.Repeat("http://", n/7) },
+	}
+	for name, source := range sources {
+		single := renderTime(source(MaxDescriptionLength))
+		double := renderTime(source(2 * MaxDescriptionLength))
+		if double > 3*single+5*time.Millisecond {
+			t.Errorf("%s took %s at twice the maximum length, %s at the maximum", name, double, single)
+		}
+	}
+}
+
+// renderTime is the fastest of a few renderings of source, which keeps
+// scheduling and collection noise out of the comparison.
+func renderTime(source string) time.Duration {
+	var fastest time.Duration
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		start := time.Now()
+		RenderMarkdown(source)
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest
+}
+
+func TestMarkdownCache(t *testing.T) {
+	cache := newMarkdownCache(100)
+	if got := cache.render("*a*"); got != "<p><em>a</em></p>" {
+		t.Fatalf("got %q", got)
+	}
+	if _, ok := cache.current["*a*"]; !ok {
+		t.Fatal("rendering was not cached")
+	}
+	cache.render(strings.Repeat("b", 60))
+	if _, ok := cache.previous["*a*"]; !ok {
+		t.Fatal("full generation was not moved to previous")
+	}
+	if got := cache.render("*a*"); got != "<p><em>a</em></p>" {
+		t.Errorf("got %q", got)
+	}
+	if _, ok := cache.current["*a*"]; !ok {
+		t.Error("entry read from previous generation did not move back")
+	}
+	if cache.render("") != "" {
+		t.Error("empty description rendered")
+	}
+}
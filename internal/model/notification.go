@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+const (
+	ChangeEventCreated      = "event.created"
+	ChangeEventUpdated      = "event.updated"
+	ChangeEventDeleted      = "event.deleted"
+	ChangeBlockCreated      = "block.created"
+	ChangeBlockUpdated      = "block.updated"
+	ChangeBlockDeleted      = "block.deleted"
+	ChangeOccurrenceUpdated = "occurrence.updated"
+	// ChangeReset means any data may have changed, as after a restore or
+	// when a client resumes from a change the log no longer holds. Clients
+	// reload what they show.
+	ChangeReset = "changes.reset"
+)
+
+// EventChange tells subscribers that an event or one of its blocks was
+// published or changed. BlockID is zero for changes of the whole event.
+type EventChange struct {
+	Kind    string    `json:"kind"`
+	EventID int       `json:"event_id"`
+	BlockID int       `json:"block_id,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// ChangeLogEntry is a change as stored for streaming clients. ID orders
+// the entries and is what clients resume from.
+type ChangeLogEntry struct {
+	ID        int64     `db:"id" json:"id"`
+	Kind      string    `db:"kind" json:"kind"`
+	EventID   int       `db:"event_id" json:"event_id"`
+	BlockID   int       `db:"block_id" json:"block_id,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Notification is a message for a user. Kind is the delivery kind the user
+// can unsubscribe from.
+type Notification struct {
+	Kind    string
+	Subject string
+	Body    string
+}
+
+// TelegramLink is a one-time code that links a Telegram chat to the user
+// who asked for it. URL opens the bot with the code filled in.
+type TelegramLink struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrAlreadyRegistered  = errors.New("already registered")
+	ErrNoOffer            = errors.New("no pending offer")
+)
+
+// RegistrationError is a registration request the student has to
+// correct, such as an invalid field or a wrong confirmation code.
+type RegistrationError struct {
+	Err error
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	RegistrationConfirmed  = "confirmed"
+	RegistrationWaitlisted = "waitlisted"
+	RegistrationOffered    = "offered"
+)
+
+// Registration is a student's place on a block. Waitlisted students are
+// promoted in order of sign-up and get an offer they have to accept before
+// OfferExpiresAt. Token identifies the registration in emailed links.
+type Registration struct {
+	ID             int        `db:"id" json:"id"`
+	BlockID        int        `db:"block_id" json:"block_id"`
+	Name           string     `db:"name" json:"name"`
+	Grade          int        `db:"grade" json:"grade"`
+	Class          string     `db:"class" json:"class"`
+	Email          string     `db:"email" json:"email"`
+	Status         string     `db:"status" json:"status"`
+	OfferExpiresAt *time.Time `db:"offer_expires_at" json:"offer_expires_at,omitempty"`
+	Token          string     `db:"token" json:"-"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+
+	Position int `db:"position" json:"position,omitempty"`
+}
+
+// RegistrationStatus describes how many students a block takes. Capacity is
+// the block's own or, when it has none, that of its room. A nil Capacity
+// means places are not limited. Offered places count as taken.
+type RegistrationStatus struct {
+	BlockID    int        `json:"block_id"`
+	Capacity   *int       `json:"capacity"`
+	Registered int        `json:"registered"`
+	Waitlisted int        `json:"waitlisted"`
+	Deadline   *time.Time `json:"registration_deadline"`
+	StartDate  time.Time  `json:"-"`
+	EndDate    time.Time  `json:"-"`
+}
+
+// Check reports whether students can still sign up at now. Registration
+// closes at the deadline or, without one, when the block ends.
+func (s RegistrationStatus) Check(now time.Time) error {
+	closes := s.EndDate
+	if s.Deadline != nil {
+		closes = *s.Deadline
+	}
+	if !now.Before(closes) {
+		return ErrRegistrationClosed
+	}
+	return nil
+}
+
+// CheckOffer reports whether places can still be offered from the
+// waitlist at now. Offers stop with registration and once the block has
+// started.
+func (s RegistrationStatus) CheckOffer(now time.Time) error {
+	if err := s.Check(now); err != nil {
+		return err
+	}
+	if !now.Before(s.StartDate) {
+		return ErrRegistrationClosed
+	}
+	return nil
+}
+
+// Free returns the number of places left, -1 when places are not limited.
+func (s RegistrationStatus) Free() int {
+	if s.Capacity == nil {
+		return -1
+	}
+	if free := *s.Capacity - s.Registered; free > 0 {
+		return free
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistrationStatusCheckOffer(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	deadline := start.Add(-24 * time.Hour)
+	status := RegistrationStatus{StartDate: start, EndDate: start.Add(time.Hour)}
+	tests := []struct {
+		name     string
+		deadline *time.Time
+		now      time.Time
+		closed   bool
+	}{
+		{"before the block", nil, start.Add(-time.Hour), false},
+		{"block started", nil, start, true},
+		{"block running", nil, start.Add(30 * time.Minute), true},
+		{"before the deadline", &deadline, deadline.Add(-time.Minute), false},
+		{"after the deadline", &deadline, deadline, true},
+	}
+	for _, tt := range tests {
+		status.Deadline = tt.deadline
+		err := status.CheckOffer(tt.now)
+		if closed := errors.Is(err, ErrRegistrationClosed); closed != tt.closed {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
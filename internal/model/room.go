@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Room struct {
+	ID       int    `db:"id" json:"id"`
+	Name     string `db:"name" json:"name"`
+	Capacity int    `db:"capacity" json:"capacity"`
+}
+
+// SaveOptions control how block writes treat room conflicts. Forced writes
+// are recorded in the audit log under Actor.
+type SaveOptions struct {
+	Force bool
+	Actor string
+}
+
+// BlockConflict is a block booked in the same room at the same time as
+// another one. Times are those of the first colliding occurrences.
+type BlockConflict struct {
+	RoomID        int        `json:"room_id"`
+	Block         EventBlock `json:"block"`
+	ConflictsWith EventBlock `json:"conflicts_with"`
+}
+
+type ConflictError struct {
+	Conflicts []BlockConflict
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) == 1 {
+		return "block collides with another block in the same room"
+	}
+	return fmt.Sprintf("blocks collide with other blocks in the same room (%d conflicts)", len(e.Conflicts))
+}
+
+const (
+	AuditForceCreateEvent  = "force_create_event"
+	AuditForceCreateBlocks = "force_create_blocks"
+	AuditForceEditBlock    = "force_edit_block"
+	AuditForceBatch        = "force_batch"
+	AuditForceImport       = "force_import"
+	AuditForceRestore      = "force_restore"
+)
+
+type AuditEntry struct {
+	ID        int             `db:"id" json:"id"`
+	Actor     string          `db:"actor" json:"actor"`
+	Action    string          `db:"action" json:"action"`
+	Details   json.RawMessage `db:"details" json:"details"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// ScheduleItem is an occurrence in a user's schedule. It is there because
+// its event is a favourite, the user registered for the block, or both.
+type ScheduleItem struct {
+	EventName          string     `json:"event_name"`
+	Block              EventBlock `json:"block"`
+	Favorite           bool       `json:"favorite"`
+	RegistrationStatus string     `json:"registration_status,omitempty"`
+}
+
+func (i ScheduleItem) Localize(loc *time.Location, school *time.Location) ScheduleItem {
+	i.Block = i.Block.Localize(loc, school)
+	return i
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// EventTemplate is a saved event that admins create new events from,
+// usually once a year.
+type EventTemplate struct {
+	ID        int           `db:"id" json:"id"`
+	Name      string        `db:"name" json:"name"`
+	Event     TemplateEvent `db:"event" json:"event"`
+	CreatedAt time.Time     `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time     `db:"updated_at" json:"updated_at"`
+}
+
+// TemplateEvent is the content of a template, stored as JSON. Blocks keep
+// the dates of the event the template was saved from, instances move them
+// to the year asked.
+type TemplateEvent struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Blocks      []TemplateBlock `json:"blocks"`
+
+	Tags     pq.StringArray `json:"tags,omitempty"`
+	Audience pq.StringArray `json:"audience,omitempty"`
+}
+
+type TemplateBlock struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	AllDay      bool      `json:"all_day,omitempty"`
+	Link        string    `json:"link"`
+	RRule       string    `json:"rrule,omitempty"`
+	LocationID  *int      `json:"location_id,omitempty"`
+
+	Capacity             *int       `json:"capacity,omitempty"`
+	RegistrationDeadline *time.Time `json:"registration_deadline,omitempty"`
+}
+
+func (t TemplateEvent) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+func (t *TemplateEvent) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case []byte:
+		return json.Unmarshal(value, t)
+	case string:
+		return json.Unmarshal([]byte(value), t)
+	}
+	return fmt.Errorf("can not scan %T into TemplateEvent", src)
+}
+
+// CloneOptions moves the copy of an event either by whole days or so that
+// its earliest block starts at StartDate. A bare date keeps the times of
+// day and only changes the day.
+type CloneOptions struct {
+	Name       string    `json:"name"`
+	NameSuffix string    `json:"name_suffix"`
+	OffsetDays int       `json:"offset_days"`
+	StartDate  *DateTime `json:"start_date"`
+	ParentID   *int      `json:"parent_id"`
+}
+
+// TemplateInstance moves the template's blocks to Year, keeping their
+// dates, and names the event after the template with NameSuffix, the year
+// by default.
+type TemplateInstance struct {
+	Year       int    `json:"year"`
+	NameSuffix string `json:"name_suffix"`
+	ParentID   *int   `json:"parent_id"`
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RoleStudent = "student"
+	RoleParent  = "parent"
+	RoleTeacher = "teacher"
+	// RoleAdmin is never stored, admins are listed in the service and get
+	// the role in their tokens.
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrTooManyCodes  = errors.New("too many codes requested, try again later")
+	ErrRoleForbidden = errors.New("role can only be changed by an admin")
+)
+
+// User is an account signed in with an email code. Grade and Class are
+// only kept for students.
+type User struct {
+	ID          int       `db:"id" json:"id"`
+	Email       string    `db:"email" json:"email"`
+	Name        string    `db:"name" json:"name"`
+	Role        string    `db:"role" json:"role"`
+	Grade       *int      `db:"grade" json:"grade"`
+	Class       *string   `db:"class" json:"class"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at" json:"last_login_at"`
+
+	CalendarToken  *string `db:"calendar_token" json:"-"`
+	TelegramChatID *int64  `db:"telegram_chat_id" json:"telegram_chat_id"`
+
+	NotificationSettings
+	UnsubscribeToken string `db:"unsubscribe_token" json:"-"`
+}
+
+// NotificationSettings says which emails a user gets. Reminders are sent
+// ReminderHours before each occurrence of the user's events.
+type NotificationSettings struct {
+	RemindersEnabled bool `db:"reminders_enabled" json:"reminders_enabled"`
+	ReminderHours    int  `db:"reminder_hours" json:"reminder_hours"`
+	DigestEnabled    bool `db:"digest_enabled" json:"digest_enabled"`
+}
+
+const (
+	DeliveryReminder = "reminder"
+	DeliveryDigest   = "digest"
+)
+
+// UserClaims is what a token says about its holder.
+type UserClaims struct {
+	UserID int
+	Email  string
+	Role   string
+}
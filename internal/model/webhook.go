@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+
+	// WebhookTest is the type of payloads sent by the test endpoint.
+	WebhookTest = "webhook.test"
+)
+
+// Webhook is a URL that gets a signed POST for every change of the listed
+// EventTypes. The secret is only returned when the webhook is created.
+type Webhook struct {
+	ID         int            `db:"id" json:"id"`
+	URL        string         `db:"url" json:"url"`
+	Secret     string         `db:"secret" json:"secret,omitempty"`
+	EventTypes pq.StringArray `db:"event_types" json:"event_types"`
+	Active     bool           `db:"active" json:"active"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+}
+
+// WebhookDelivery is one payload for one webhook. Pending deliveries are
+// retried at NextAttemptAt until they succeed or run out of attempts.
+type WebhookDelivery struct {
+	ID             int             `db:"id" json:"id"`
+	WebhookID      int             `db:"webhook_id" json:"webhook_id"`
+	EventType      string          `db:"event_type" json:"event_type"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	ResponseStatus *int            `db:"response_status" json:"response_status"`
+	LastError      string          `db:"last_error" json:"last_error"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time      `db:"delivered_at" json:"delivered_at"`
+}
+
+// WebhookPayload is the JSON body of a delivery. Event is the event after
+// the change and is missing once it is deleted.
+type WebhookPayload struct {
+	Type      string    `json:"type"`
+	EventID   int       `json:"event_id,omitempty"`
+	BlockID   int       `json:"block_id,omitempty"`
+	Event     *Event    `json:"event,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
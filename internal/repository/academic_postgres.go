@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type AcademicPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAcademicPostgres(db *sqlx.DB) *AcademicPostgres {
+	return &AcademicPostgres{
+		db: db,
+	}
+}
+
+func (r *AcademicPostgres) CreatePeriod(period model.AcademicPeriod) (int, error) {
+	query := fmt.Sprintf("INSERT INTO %s (name, kind, start_date, end_date) VALUES ($1, $2, $3, $4) RETURNING id", academicPeriodsTable)
+	var id int
+	if err := r.db.Get(&id, query, period.Name, period.Kind, period.StartDate, period.EndDate); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *AcademicPostgres) EditPeriod(period model.AcademicPeriod) error {
+	query := fmt.Sprintf("UPDATE %s SET name = $1, kind = $2, start_date = $3, end_date = $4 WHERE id = $5", academicPeriodsTable)
+	result, err := r.db.Exec(query, period.Name, period.Kind, period.StartDate, period.EndDate, period.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AcademicPostgres) DeletePeriod(periodId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", academicPeriodsTable)
+	result, err := r.db.Exec(query, periodId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AcademicPostgres) GetPeriods() ([]model.AcademicPeriod, error) {
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY start_date, end_date", academicPeriodsTable)
+	periods := []model.AcademicPeriod{}
+	if err := r.db.Select(&periods, query); err != nil {
+		return nil, err
+	}
+	return periods, nil
+}
+
+func (r *AcademicPostgres) GetNonSchoolPeriods() ([]model.AcademicPeriod, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE kind IN ($1, $2) ORDER BY start_date", academicPeriodsTable)
+	var periods []model.AcademicPeriod
+	if err := r.db.Select(&periods, query, model.PeriodHoliday, model.PeriodNonSchoolDay); err != nil {
+		return nil, err
+	}
+	return periods, nil
+}
+
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
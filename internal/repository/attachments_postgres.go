@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+type AttachmentsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAttachmentsPostgres(db *sqlx.DB) *AttachmentsPostgres {
+	return &AttachmentsPostgres{
+		db: db,
+	}
+}
+
+func (r *AttachmentsPostgres) CreateAttachment(attachment model.Attachment) (int, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (event_id, file_name, content_type, size, width, height, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, attachmentsTable)
+	var id int
+	if err := r.db.Get(&id, query, attachment.EventID, attachment.FileName, attachment.ContentType, attachment.Size, attachment.Width, attachment.Height, attachment.StorageKey, attachment.ThumbnailKey); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *AttachmentsPostgres) GetAttachment(attachmentId int) (model.Attachment, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", attachmentsTable)
+	var attachment model.Attachment
+	if err := r.db.Get(&attachment, query, attachmentId); err != nil {
+		return model.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (r *AttachmentsPostgres) GetEventAttachments(eventIds []int) ([]model.Attachment, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE event_id = ANY($1) ORDER BY event_id, id", attachmentsTable)
+	attachments := []model.Attachment{}
+	if err := r.db.Select(&attachments, query, pq.Array(eventIds)); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// DeleteAttachment removes the row only, a trigger queues its files for
+// GetOrphanedFiles.
+func (r *AttachmentsPostgres) DeleteAttachment(attachmentId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", attachmentsTable)
+	result, err := r.db.Exec(query, attachmentId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AttachmentsPostgres) CountAttachments() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", attachmentsTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *AttachmentsPostgres) GetOrphanedFiles(limit int) ([]string, error) {
+	query := fmt.Sprintf("SELECT storage_key FROM %s ORDER BY deleted_at LIMIT $1", orphanedFilesTable)
+	keys := []string{}
+	if err := r.db.Select(&keys, query, limit); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *AttachmentsPostgres) DeleteOrphanedFile(key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE storage_key = $1", orphanedFilesTable)
+	_, err := r.db.Exec(query, key)
+	return err
+}
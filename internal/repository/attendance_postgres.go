@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type AttendancePostgres struct {
+	db *sqlx.DB
+}
+
+func NewAttendancePostgres(db *sqlx.DB) *AttendancePostgres {
+	return &AttendancePostgres{
+		db: db,
+	}
+}
+
+// MarkAttendance records a student as present. Marking a student twice for
+// the same occurrence keeps the first record and returns its id.
+func (r *AttendancePostgres) MarkAttendance(attendance model.Attendance) (int, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (block_id, registration_id, occurrence_start, name, grade, class, email, method, marked_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (block_id, occurrence_start, email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id
+	`, attendanceTable)
+	var id int
+	if err := r.db.Get(&id, query, attendance.BlockID, attendance.RegistrationID, attendance.OccurrenceStart, attendance.Name, attendance.Grade, attendance.Class, attendance.Email, attendance.Method, attendance.MarkedBy); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *AttendancePostgres) UnmarkAttendance(blockId int, occurrenceStart time.Time, email string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE block_id = $1 AND occurrence_start = $2 AND email = $3", attendanceTable)
+	result, err := r.db.Exec(query, blockId, occurrenceStart, email)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AttendancePostgres) CountAttendance() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", attendanceTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *AttendancePostgres) GetBlockAttendance(blockId int) ([]model.Attendance, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE block_id = $1 ORDER BY occurrence_start, name", attendanceTable)
+	attendance := []model.Attendance{}
+	if err := r.db.Select(&attendance, query, blockId); err != nil {
+		return nil, err
+	}
+	return attendance, nil
+}
+
+// attendanceReportQuery lists attendance records together with confirmed
+// registrants of past single blocks who have none. %[5]s filters both
+// parts by the event (e) or the student's email.
+const attendanceReportQuery = `
+	SELECT
+		e.id AS event_id, e.name AS event_name, b.id AS block_id, b.name AS block_name,
+		a.occurrence_start, a.name, a.grade, a.class, a.email,
+		a.registration_id IS NOT NULL AS registered, TRUE AS present,
+		a.method, a.created_at AS checked_in_at
+	FROM %[1]s a
+	JOIN %[2]s b ON b.id = a.block_id
+	JOIN %[3]s e ON e.id = b.event_id
+	WHERE %[5]s
+	UNION ALL
+	SELECT
+		e.id, e.name, b.id, b.name,
+		b.start_date, reg.name, reg.grade, reg.class, reg.email,
+		TRUE, FALSE,
+		NULL, NULL
+	FROM %[4]s reg
+	JOIN %[2]s b ON b.id = reg.block_id
+	JOIN %[3]s e ON e.id = b.event_id
+	WHERE %[6]s AND b.rrule = '' AND b.start_date <= NOW() AND reg.status = 'confirmed'
+		AND NOT EXISTS (SELECT 1 FROM %[1]s a WHERE a.block_id = b.id AND a.email = reg.email)
+	ORDER BY occurrence_start, block_id, name
+`
+
+func (r *AttendancePostgres) GetEventAttendance(eventId int) ([]model.AttendanceRecord, error) {
+	query := fmt.Sprintf(attendanceReportQuery, attendanceTable, eventBlocksTable, eventsTable, registrationsTable, "e.id = $1", "e.id = $1")
+	records := []model.AttendanceRecord{}
+	if err := r.db.Select(&records, query, eventId); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *AttendancePostgres) GetStudentAttendance(email string) ([]model.AttendanceRecord, error) {
+	query := fmt.Sprintf(attendanceReportQuery, attendanceTable, eventBlocksTable, eventsTable, registrationsTable, "a.email = $1", "reg.email = $1")
+	records := []model.AttendanceRecord{}
+	if err := r.db.Select(&records, query, email); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
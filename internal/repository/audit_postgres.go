@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type AuditPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAuditPostgres(db *sqlx.DB) *AuditPostgres {
+	return &AuditPostgres{
+		db: db,
+	}
+}
+
+func (r *AuditPostgres) AddAuditEntry(entry model.AuditEntry) error {
+	query := fmt.Sprintf("INSERT INTO %s (actor, action, details) VALUES ($1, $2, $3)", auditLogTable)
+	_, err := r.db.Exec(query, entry.Actor, entry.Action, []byte(entry.Details))
+	return err
+}
+
+func (r *AuditPostgres) GetAuditLog(limit int) ([]model.AuditEntry, error) {
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY created_at DESC, id DESC LIMIT $1", auditLogTable)
+	entries := []model.AuditEntry{}
+	if err := r.db.Select(&entries, query, limit); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type BackupPostgres struct {
+	db *sqlx.DB
+}
+
+func NewBackupPostgres(db *sqlx.DB) *BackupPostgres {
+	return &BackupPostgres{
+		db: db,
+	}
+}
+
+// Restore writes the backup in a single transaction. Events and rooms are
+// matched by name, blocks by uid, attachments by storage key, translations
+// by their event or block and locale and academic periods by their
+// contents. Events keep their stored tags and audience when the backup
+// has none for them. Block event ids are remapped to the ids the
+// events get in this database. In replace mode all content is removed
+// first. Removing attachments queues their files for deletion, restored
+// attachments take their files off that queue again.
+func (r *BackupPostgres) Restore(backup model.Backup, mode string) (model.RestoreReport, error) {
+	report := model.RestoreReport{Mode: mode}
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return model.RestoreReport{}, err
+	}
+	if mode == model.RestoreReplace {
+		for _, table := range []string{eventBlocksTable, eventsTable, academicPeriodsTable, roomsTable} {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+		}
+	}
+	roomsQuery := fmt.Sprintf(`
+		INSERT INTO %s (name, capacity) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET capacity = EXCLUDED.capacity
+		RETURNING id
+	`, roomsTable)
+	roomIds := make(map[string]int, len(backup.Rooms))
+	for _, room := range backup.Rooms {
+		var id int
+		if err := tx.Get(&id, roomsQuery, room.Name, room.Capacity); err != nil {
+			tx.Rollback()
+			return model.RestoreReport{}, err
+		}
+		roomIds[room.Name] = id
+		report.Rooms++
+	}
+	eventsQuery := fmt.Sprintf(`
+		INSERT INTO %[1]s (name, description, tags, audience, created_at, updated_at)
+		VALUES ($1, $2, COALESCE($3::TEXT[], '{}'), COALESCE($4::TEXT[], '{}'), $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			tags = COALESCE($3::TEXT[], %[1]s.tags),
+			audience = COALESCE($4::TEXT[], %[1]s.audience),
+			updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, eventsTable)
+	blocksQuery := fmt.Sprintf(`
+		INSERT INTO %s (event_id, uid, name, description, start_date, end_date, link, rrule, all_day, location_id, capacity, registration_deadline, position, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (uid) DO UPDATE SET
+			event_id = EXCLUDED.event_id,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			start_date = EXCLUDED.start_date,
+			end_date = EXCLUDED.end_date,
+			link = EXCLUDED.link,
+			rrule = EXCLUDED.rrule,
+			all_day = EXCLUDED.all_day,
+			location_id = EXCLUDED.location_id,
+			capacity = EXCLUDED.capacity,
+			registration_deadline = EXCLUDED.registration_deadline,
+			position = EXCLUDED.position,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, eventBlocksTable)
+	clearExceptionsQuery := fmt.Sprintf("DELETE FROM %s WHERE block_id = $1", blockExceptionsTable)
+	exceptionsQuery := fmt.Sprintf(`
+		INSERT INTO %s (block_id, recurrence_id, cancelled, name, description, start_date, end_date, link)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, blockExceptionsTable)
+	eventTranslationsQuery := fmt.Sprintf(`
+		INSERT INTO %s (event_id, locale, name, description, updated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (event_id, locale) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			updated_at = EXCLUDED.updated_at
+	`, translationsTable)
+	blockTranslationsQuery := fmt.Sprintf(`
+		INSERT INTO %s (block_id, locale, name, description, updated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (block_id, locale) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			updated_at = EXCLUDED.updated_at
+	`, translationsTable)
+	eventIds := make(map[int]int, len(backup.Events))
+	for _, event := range backup.Events {
+		var id int
+		if err := tx.Get(&id, eventsQuery, event.Name, event.Description, event.Tags, event.Audience, event.CreatedAt, event.UpdatedAt); err != nil {
+			tx.Rollback()
+			return model.RestoreReport{}, err
+		}
+		eventIds[event.ID] = id
+		for _, translation := range event.Translations {
+			if _, err := tx.Exec(eventTranslationsQuery, id, translation.Locale, translation.Name, translation.Description, translation.UpdatedAt); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+			report.Translations++
+		}
+		report.Events++
+	}
+	parentQuery := fmt.Sprintf("UPDATE %s SET parent_id = $1 WHERE id = $2", eventsTable)
+	for _, event := range backup.Events {
+		var parentId *int
+		if event.ParentID != nil {
+			id := eventIds[*event.ParentID]
+			parentId = &id
+		}
+		if _, err := tx.Exec(parentQuery, parentId, eventIds[event.ID]); err != nil {
+			tx.Rollback()
+			return model.RestoreReport{}, err
+		}
+	}
+	for _, event := range backup.Events {
+		for _, block := range event.Blocks {
+			var (
+				blockId    int
+				locationId *int
+			)
+			if id, ok := roomIds[block.Room]; ok {
+				locationId = &id
+			}
+			if err := tx.Get(&blockId, blocksQuery, eventIds[event.ID], block.UID, block.Name, block.Description, block.StartDate, block.EndDate, block.Link, block.RRule, block.AllDay, locationId, block.Capacity, block.RegistrationDeadline, block.Position, block.CreatedAt, block.UpdatedAt); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+			if _, err := tx.Exec(clearExceptionsQuery, blockId); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+			for _, exception := range block.Exceptions {
+				if _, err := tx.Exec(exceptionsQuery, blockId, exception.RecurrenceID, exception.Cancelled, exception.Name, exception.Description, exception.StartDate, exception.EndDate, exception.Link); err != nil {
+					tx.Rollback()
+					return model.RestoreReport{}, err
+				}
+			}
+			for _, translation := range block.Translations {
+				if _, err := tx.Exec(blockTranslationsQuery, blockId, translation.Locale, translation.Name, translation.Description, translation.UpdatedAt); err != nil {
+					tx.Rollback()
+					return model.RestoreReport{}, err
+				}
+				report.Translations++
+			}
+			report.Blocks++
+		}
+	}
+	attachmentsQuery := fmt.Sprintf(`
+		INSERT INTO %s (event_id, file_name, content_type, size, width, height, storage_key, thumbnail_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (storage_key) DO UPDATE SET
+			event_id = EXCLUDED.event_id,
+			file_name = EXCLUDED.file_name,
+			content_type = EXCLUDED.content_type,
+			size = EXCLUDED.size,
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			thumbnail_key = EXCLUDED.thumbnail_key
+	`, attachmentsTable)
+	keepFilesQuery := fmt.Sprintf("DELETE FROM %s WHERE storage_key = $1 OR storage_key = $2", orphanedFilesTable)
+	for _, event := range backup.Events {
+		for _, attachment := range event.Attachments {
+			if _, err := tx.Exec(attachmentsQuery, eventIds[event.ID], attachment.FileName, attachment.ContentType, attachment.Size, attachment.Width, attachment.Height, attachment.StorageKey, attachment.ThumbnailKey, attachment.CreatedAt); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+			if _, err := tx.Exec(keepFilesQuery, attachment.StorageKey, attachment.ThumbnailKey); err != nil {
+				tx.Rollback()
+				return model.RestoreReport{}, err
+			}
+			report.Attachments++
+		}
+	}
+	periodsQuery := fmt.Sprintf(`
+		INSERT INTO %[1]s (name, kind, start_date, end_date)
+		SELECT $1::VARCHAR, $2::VARCHAR, $3::DATE, $4::DATE
+		WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE name = $1 AND kind = $2 AND start_date = $3 AND end_date = $4)
+	`, academicPeriodsTable)
+	for _, period := range backup.AcademicPeriods {
+		if _, err := tx.Exec(periodsQuery, period.Name, period.Kind, period.StartDate, period.EndDate); err != nil {
+			tx.Rollback()
+			return model.RestoreReport{}, err
+		}
+		report.AcademicPeriods++
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return model.RestoreReport{}, err
+	}
+	return report, nil
+}
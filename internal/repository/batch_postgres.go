@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type BatchPostgres struct {
+	db *sqlx.DB
+}
+
+func NewBatchPostgres(db *sqlx.DB) *BatchPostgres {
+	return &BatchPostgres{
+		db: db,
+	}
+}
+
+// ErrBatchFailed means an atomic batch was rolled back, the cause is in
+// the results.
+var ErrBatchFailed = errors.New("batch failed")
+
+// RunBatch writes the operations in one transaction and fills their
+// results. Operations already marked as failed are skipped. An atomic
+// batch stops and rolls back at the first failure, otherwise every
+// operation runs under a savepoint and only its own writes are undone.
+func (r *BatchPostgres) RunBatch(ops []model.BatchOperation, results []model.BatchResult, atomic bool) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	refs := make(map[string]int)
+	for i, op := range ops {
+		if results[i].Status == model.BatchFailed {
+			continue
+		}
+		if !atomic {
+			if _, err := tx.Exec("SAVEPOINT batch_operation"); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		id, eventId, err := runBatchOperation(tx, op, refs)
+		if err != nil {
+			results[i].Status = model.BatchFailed
+			results[i].Error = err.Error()
+			if atomic {
+				tx.Rollback()
+				return ErrBatchFailed
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT batch_operation"); err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+		if !atomic {
+			if _, err := tx.Exec("RELEASE SAVEPOINT batch_operation"); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if op.Op == model.BatchCreate && op.Type == model.BatchEvent && op.Ref != "" {
+			refs[op.Ref] = id
+		}
+		results[i].Status = model.BatchOK
+		results[i].ID = id
+		results[i].EventID = eventId
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// runBatchOperation returns the id of the written event or block and the
+// id of the event it belongs to.
+func runBatchOperation(tx *sqlx.Tx, op model.BatchOperation, refs map[string]int) (int, int, error) {
+	switch op.Type + "." + op.Op {
+	case model.BatchEvent + "." + model.BatchCreate:
+		if err := lockParent(tx, op.Event.ParentID); err != nil {
+			return 0, 0, err
+		}
+		id, err := insertEvent(tx, *op.Event)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, block := range op.Event.EventBlocks {
+			if _, err := insertBatchBlock(tx, block, id); err != nil {
+				return 0, 0, err
+			}
+		}
+		return id, id, nil
+	case model.BatchEvent + "." + model.BatchUpdate:
+		query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, tags = COALESCE($3, tags), audience = COALESCE($4, audience), updated_at = NOW() WHERE id = $5", eventsTable)
+		result, err := tx.Exec(query, op.Event.Name, op.Event.Description, op.Event.Tags, op.Event.Audience, op.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		return op.ID, op.ID, batchAffected(result)
+	case model.BatchEvent + "." + model.BatchDelete:
+		query := fmt.Sprintf("DELETE FROM %s WHERE event_id = $1", eventBlocksTable)
+		if _, err := tx.Exec(query, op.ID); err != nil {
+			return 0, 0, err
+		}
+		query = fmt.Sprintf("DELETE FROM %s WHERE id = $1", eventsTable)
+		result, err := tx.Exec(query, op.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		return op.ID, op.ID, batchAffected(result)
+	case model.BatchBlock + "." + model.BatchCreate:
+		eventId := op.Block.EventID
+		if op.EventRef != "" {
+			id, ok := refs[op.EventRef]
+			if !ok {
+				return 0, 0, fmt.Errorf("event %s was not created", op.EventRef)
+			}
+			eventId = id
+		}
+		id, err := insertBatchBlock(tx, *op.Block, eventId)
+		if err != nil {
+			return 0, 0, err
+		}
+		return id, eventId, nil
+	case model.BatchBlock + "." + model.BatchUpdate:
+		block := op.Block
+		query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, start_date = $3, end_date = $4, link = $5, rrule = $6, all_day = $7, location_id = $8, capacity = $9, registration_deadline = $10, updated_at = NOW() WHERE id = $11", eventBlocksTable)
+		result, err := tx.Exec(query, block.Name, block.Description, block.StartDate, block.EndDate, block.Link, block.RRule, block.AllDay, block.LocationID, block.Capacity, block.RegistrationDeadline, op.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		return op.ID, block.EventID, batchAffected(result)
+	case model.BatchBlock + "." + model.BatchDelete:
+		query := fmt.Sprintf("UPDATE %s SET updated_at = NOW() WHERE id = (SELECT event_id FROM %s WHERE id = $1)", eventsTable, eventBlocksTable)
+		if _, err := tx.Exec(query, op.ID); err != nil {
+			return 0, 0, err
+		}
+		query = fmt.Sprintf("DELETE FROM %s WHERE id = $1", eventBlocksTable)
+		result, err := tx.Exec(query, op.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		return op.ID, op.Block.EventID, batchAffected(result)
+	}
+	return 0, 0, fmt.Errorf("unknown operation %s %s", op.Op, op.Type)
+}
+
+func insertBatchBlock(tx *sqlx.Tx, block model.EventBlock, eventId int) (int, error) {
+	uid, err := blockUID(block)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date, uid, rrule, all_day, location_id, capacity, registration_deadline, position) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, %s) RETURNING id", eventBlocksTable, nextBlockPosition(1))
+	if err := tx.Get(&id, query, eventId, block.Name, block.Description, block.Link, block.StartDate, block.EndDate, uid, block.RRule, block.AllDay, block.LocationID, block.Capacity, block.RegistrationDeadline); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// batchAffected reports missing rows as "not found", the results are shown
+// to admins as they are.
+func batchAffected(result sql.Result) error {
+	if err := expectAffected(result); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("not found")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// changesChannel is the NOTIFY channel that tells every replica about
+	// new change log entries.
+	changesChannel = "event_changes"
+	// changeLogLock serializes change log writes, see AddChange.
+	changeLogLock = 8
+)
+
+type ChangeLogPostgres struct {
+	db *sqlx.DB
+}
+
+func NewChangeLogPostgres(db *sqlx.DB) *ChangeLogPostgres {
+	return &ChangeLogPostgres{
+		db: db,
+	}
+}
+
+// AddChange stores the change and notifies listeners with its id in the
+// same transaction, so the entry is readable when the notification comes.
+// Writes take a transaction lock before drawing the id, so entries commit
+// in id order and a reader that has seen an id has seen every smaller one.
+func (r *ChangeLogPostgres) AddChange(change model.EventChange) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, 0)", changeLogLock); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (kind, event_id, block_id, created_at) VALUES ($1, $2, $3, $4) RETURNING id", changeLogTable)
+	var id int64
+	if err := tx.Get(&id, query, change.Kind, change.EventID, change.BlockID, change.At); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec("SELECT pg_notify($1, $2)", changesChannel, fmt.Sprint(id)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *ChangeLogPostgres) GetChangesAfter(id int64, limit int) ([]model.ChangeLogEntry, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id > $1 ORDER BY id LIMIT $2", changeLogTable)
+	entries := []model.ChangeLogEntry{}
+	if err := r.db.Select(&entries, query, id, limit); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetFirstChangeID returns the oldest id still in the log, or zero when
+// the log is empty.
+func (r *ChangeLogPostgres) GetFirstChangeID() (int64, error) {
+	query := fmt.Sprintf("SELECT COALESCE(MIN(id), 0) FROM %s", changeLogTable)
+	var id int64
+	if err := r.db.Get(&id, query); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *ChangeLogPostgres) GetLastChangeID() (int64, error) {
+	query := fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s", changeLogTable)
+	var id int64
+	if err := r.db.Get(&id, query); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *ChangeLogPostgres) DeleteChangesBefore(before time.Time) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE created_at < $1", changeLogTable)
+	_, err := r.db.Exec(query, before)
+	return err
+}
+
+// ListenChanges calls notify for every change notification until ctx is
+// done. It also calls notify after reconnecting, as notifications sent
+// while the connection was down are lost.
+func (r *ChangeLogPostgres) ListenChanges(ctx context.Context, dsn string, notify func()) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logrus.Errorf("CHANGE LISTENER ERROR: %s", err.Error())
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(changesChannel); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			// A nil notification means the connection was re-established.
+			notify()
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type DeliveriesPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDeliveriesPostgres(db *sqlx.DB) *DeliveriesPostgres {
+	return &DeliveriesPostgres{
+		db: db,
+	}
+}
+
+// ClaimDelivery records that a message is being sent and reports false when
+// it was already recorded, so each message goes out once even with several
+// senders.
+func (r *DeliveriesPostgres) ClaimDelivery(userId int, kind string, key string) (bool, error) {
+	query := fmt.Sprintf("INSERT INTO %s (user_id, kind, key) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", deliveriesTable)
+	result, err := r.db.Exec(query, userId, kind, key)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ReleaseDelivery forgets a claimed message that could not be sent, so the
+// next run tries again.
+func (r *DeliveriesPostgres) ReleaseDelivery(userId int, kind string, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND kind = $2 AND key = $3", deliveriesTable)
+	_, err := r.db.Exec(query, userId, kind, key)
+	return err
+}
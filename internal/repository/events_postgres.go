@@ -1,12 +1,17 @@
 package repository
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
 )
 
 type EventsPostgres struct {
@@ -19,11 +24,33 @@ func NewEventsPostgres(db *sqlx.DB) *EventsPostgres {
 	}
 }
 
+// eventColumns selects events e joined with their parent p as in
+// eventsJoin. A stage with no tags or no audience of its own takes those
+// of its parent.
+const eventColumns = `e.id, e.name, e.description, e.created_at, e.updated_at, e.parent_id,
+	CASE WHEN cardinality(e.tags) = 0 AND p.id IS NOT NULL THEN p.tags ELSE e.tags END AS tags,
+	CASE WHEN cardinality(e.audience) = 0 AND p.id IS NOT NULL THEN p.audience ELSE e.audience END AS audience`
+
+var eventsJoin = fmt.Sprintf("%[1]s e LEFT JOIN %[1]s p ON p.id = e.parent_id", eventsTable)
+
+// CreateEvent writes the event, then its blocks. The parent is checked
+// under lock, see lockParent.
 func (r *EventsPostgres) CreateEvent(event model.Event) (int, error) {
-	query := fmt.Sprintf("INSERT INTO %s (name, description) VALUES ($1, $2) RETURNING id", eventsTable)
-	var id int
-	row := r.db.QueryRow(query, event.Name, event.Description)
-	if err := row.Scan(&id); err != nil {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	if err := lockParent(tx, event.ParentID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	id, err := insertEvent(tx, event)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
 		return 0, err
 	}
 	if err := r.CreateEventBlocks(event.EventBlocks, id); err != nil && len(event.EventBlocks) > 0 {
@@ -33,24 +60,69 @@ func (r *EventsPostgres) CreateEvent(event model.Event) (int, error) {
 }
 
 func (r *EventsPostgres) CreateEventBlocks(blocks []model.EventBlock, eventId int) error {
-	query := fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date) VALUES ", eventBlocksTable)
+	query := fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date, uid, rrule, all_day, location_id, capacity, registration_deadline, position) VALUES ", eventBlocksTable)
 	queryPieces := make([]string, len(blocks))
 	argsCounter := 0
 	argsArr := make([]interface{}, 0)
 	for i, block := range blocks {
-		queryPieces[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", argsCounter+1, argsCounter+2, argsCounter+3, argsCounter+4, argsCounter+5, argsCounter+6)
-		argsCounter += 6
-		argsArr = append(argsArr, eventId, block.Name, block.Description, block.Link, block.StartDate, block.EndDate)
+		uid, err := blockUID(block)
+		if err != nil {
+			return err
+		}
+		queryPieces[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, %s + %d)", argsCounter+1, argsCounter+2, argsCounter+3, argsCounter+4, argsCounter+5, argsCounter+6, argsCounter+7, argsCounter+8, argsCounter+9, argsCounter+10, argsCounter+11, argsCounter+12, nextBlockPosition(argsCounter+1), i)
+		argsCounter += 12
+		argsArr = append(argsArr, eventId, block.Name, block.Description, block.Link, block.StartDate, block.EndDate, uid, block.RRule, block.AllDay, block.LocationID, block.Capacity, block.RegistrationDeadline)
 	}
 	query += strings.Join(queryPieces, ", ")
 	_, err := r.db.Exec(query, argsArr...)
 	return err
 }
 
+// nextBlockPosition is the position after the last block of the event
+// given in parameter n.
+func nextBlockPosition(n int) string {
+	return fmt.Sprintf("(SELECT COALESCE(MAX(position) + 1, 0) FROM %s WHERE event_id = $%d)", eventBlocksTable, n)
+}
+
+func blockUID(block model.EventBlock) (string, error) {
+	if block.UID != "" {
+		return block.UID, nil
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return token + "@" + blockUIDDomain, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
 func (r *EventsPostgres) DeleteEventBlock(blockId int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", eventBlocksTable)
-	_, err := r.db.Exec(query, blockId)
-	return err
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("UPDATE %s SET updated_at = NOW() WHERE id = (SELECT event_id FROM %s WHERE id = $1)", eventsTable, eventBlocksTable)
+	if _, err := tx.Exec(query, blockId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	query = fmt.Sprintf("DELETE FROM %s WHERE id = $1", eventBlocksTable)
+	if _, err := tx.Exec(query, blockId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
 }
 
 func (r *EventsPostgres) DeleteEvent(eventId int) error {
@@ -78,25 +150,58 @@ func (r *EventsPostgres) DeleteEvent(eventId int) error {
 }
 
 func (r *EventsPostgres) EditEventInfo(event model.Event) error {
-	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2 WHERE id = $3", eventsTable)
-	_, err := r.db.Exec(query, event.Name, event.Description, event.ID)
+	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, tags = COALESCE($3, tags), audience = COALESCE($4, audience), updated_at = NOW() WHERE id = $5", eventsTable)
+	_, err := r.db.Exec(query, event.Name, event.Description, event.Tags, event.Audience, event.ID)
 	return err
 }
 
+// insertEvent writes the event without its blocks. Nil tags and audience
+// are stored empty.
+func insertEvent(tx *sqlx.Tx, event model.Event) (int, error) {
+	query := fmt.Sprintf("INSERT INTO %s (name, description, parent_id, tags, audience) VALUES ($1, $2, $3, COALESCE($4::TEXT[], '{}'), COALESCE($5::TEXT[], '{}')) RETURNING id", eventsTable)
+	var id int
+	if err := tx.Get(&id, query, event.Name, event.Description, event.ParentID, event.Tags, event.Audience); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// lockParent checks that parentId may get a new stage and keeps it from
+// joining a series of its own until the transaction ends. A nil parentId
+// is not checked.
+func lockParent(tx *sqlx.Tx, parentId *int) error {
+	if parentId == nil {
+		return nil
+	}
+	var grandparentId *int
+	query := fmt.Sprintf("SELECT parent_id FROM %s WHERE id = $1 FOR SHARE", eventsTable)
+	err := tx.Get(&grandparentId, query, *parentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if grandparentId != nil {
+		return model.ErrParentIsStage
+	}
+	return nil
+}
+
 func (r *EventsPostgres) EditBlockInfo(block model.EventBlock) error {
-	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, start_date = $3, end_date = $4, link = $5 WHERE id = $6", eventBlocksTable)
-	_, err := r.db.Exec(query, block.Name, block.Description, block.StartDate, block.EndDate, block.Link, block.ID)
+	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, start_date = $3, end_date = $4, link = $5, rrule = $6, all_day = $7, location_id = $8, capacity = $9, registration_deadline = $10, updated_at = NOW() WHERE id = $11", eventBlocksTable)
+	_, err := r.db.Exec(query, block.Name, block.Description, block.StartDate, block.EndDate, block.Link, block.RRule, block.AllDay, block.LocationID, block.Capacity, block.RegistrationDeadline, block.ID)
 	return err
 }
 
 func (r *EventsPostgres) GetCurrentEvents() ([]model.Event, error) {
 	currentTime := time.Now()
 	query := fmt.Sprintf(`
-		SELECT DISTINCT e.id, e.name, e.description
-		FROM %s e
+		SELECT DISTINCT %s
+		FROM %s
 		JOIN %s b ON e.id = b.event_id
-		WHERE b.start_date <= $1 AND b.end_date >= $1
-	`, eventsTable, eventBlocksTable)
+		WHERE b.rrule = '' AND b.start_date <= $1 AND b.end_date >= $1
+	`, eventColumns, eventsJoin, eventBlocksTable)
 
 	var events []model.Event
 	if err := r.db.Select(&events, query, currentTime); err != nil {
@@ -109,6 +214,11 @@ type eventWithBlocks struct {
 	ID          int
 	Name        string
 	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ParentID    *int
+	Tags        pq.StringArray
+	Audience    pq.StringArray
 	Blocks      []model.EventBlock
 }
 
@@ -118,16 +228,30 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 			e.id as event_id, 
 			e.name as event_name, 
 			e.description as event_description, 
+			e.created_at as event_created_at, 
+			e.updated_at as event_updated_at, 
+			e.parent_id as event_parent_id, 
+			CASE WHEN cardinality(e.tags) = 0 AND p.id IS NOT NULL THEN p.tags ELSE e.tags END as event_tags, 
+			CASE WHEN cardinality(e.audience) = 0 AND p.id IS NOT NULL THEN p.audience ELSE e.audience END as event_audience, 
 			b.id as block_id, 
+			b.uid as block_uid, 
 			b.name as block_name, 
 			b.description as block_description, 
 			b.start_date as block_start_date, 
 			b.end_date as block_end_date, 
-			b.link as block_link
-		FROM %s e
+			b.link as block_link, 
+			b.rrule as block_rrule, 
+			b.all_day as block_all_day, 
+			b.location_id as block_location_id, 
+			b.capacity as block_capacity, 
+			b.registration_deadline as block_registration_deadline, 
+			b.position as block_position, 
+			b.created_at as block_created_at, 
+			b.updated_at as block_updated_at
+		FROM %s
 		LEFT JOIN %s b ON e.id = b.event_id
-		ORDER BY e.id, b.id
-	`, eventsTable, eventBlocksTable))
+		ORDER BY e.id, b.position, b.start_date, b.id
+	`, eventsJoin, eventBlocksTable))
 	if err != nil {
 		return nil, err
 	}
@@ -140,24 +264,52 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 			eventID          int
 			eventName        string
 			eventDescription string
+			eventCreatedAt   time.Time
+			eventUpdatedAt   time.Time
+			eventParentID    *int
+			eventTags        pq.StringArray
+			eventAudience    pq.StringArray
 			blockID          *int
+			blockUID         *string
 			blockName        *string
 			blockDescription *string
 			blockStartDate   *time.Time
 			blockEndDate     *time.Time
 			blockLink        *string
+			blockRRule       *string
+			blockAllDay      *bool
+			blockLocationID  *int
+			blockCapacity    *int
+			blockDeadline    *time.Time
+			blockPosition    *int
+			blockCreatedAt   *time.Time
+			blockUpdatedAt   *time.Time
 		)
 
 		err := rows.Scan(
 			&eventID,
 			&eventName,
 			&eventDescription,
+			&eventCreatedAt,
+			&eventUpdatedAt,
+			&eventParentID,
+			&eventTags,
+			&eventAudience,
 			&blockID,
+			&blockUID,
 			&blockName,
 			&blockDescription,
 			&blockStartDate,
 			&blockEndDate,
 			&blockLink,
+			&blockRRule,
+			&blockAllDay,
+			&blockLocationID,
+			&blockCapacity,
+			&blockDeadline,
+			&blockPosition,
+			&blockCreatedAt,
+			&blockUpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -169,6 +321,11 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 				ID:          eventID,
 				Name:        eventName,
 				Description: eventDescription,
+				CreatedAt:   eventCreatedAt,
+				UpdatedAt:   eventUpdatedAt,
+				ParentID:    eventParentID,
+				Tags:        eventTags,
+				Audience:    eventAudience,
 				Blocks:      []model.EventBlock{},
 			}
 			eventsMap[eventID] = evt
@@ -184,6 +341,9 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 				EndDate:     time.Time{},
 				Link:        "",
 			}
+			if blockUID != nil {
+				block.UID = *blockUID
+			}
 			if blockName != nil {
 				block.Name = *blockName
 			}
@@ -199,6 +359,24 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 			if blockLink != nil {
 				block.Link = *blockLink
 			}
+			if blockRRule != nil {
+				block.RRule = *blockRRule
+			}
+			if blockAllDay != nil {
+				block.AllDay = *blockAllDay
+			}
+			block.LocationID = blockLocationID
+			block.Capacity = blockCapacity
+			block.RegistrationDeadline = blockDeadline
+			if blockPosition != nil {
+				block.Position = *blockPosition
+			}
+			if blockCreatedAt != nil {
+				block.CreatedAt = *blockCreatedAt
+			}
+			if blockUpdatedAt != nil {
+				block.UpdatedAt = *blockUpdatedAt
+			}
 			evt.Blocks = append(evt.Blocks, block)
 		}
 	}
@@ -212,7 +390,12 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 			ID:          evt.ID,
 			Name:        evt.Name,
 			Description: evt.Description,
+			CreatedAt:   evt.CreatedAt,
+			UpdatedAt:   evt.UpdatedAt,
 			EventBlocks: evt.Blocks,
+			ParentID:    evt.ParentID,
+			Tags:        evt.Tags,
+			Audience:    evt.Audience,
 		}
 		events = append(events, e)
 	}
@@ -223,12 +406,12 @@ func (r *EventsPostgres) GetAllEvents() ([]model.Event, error) {
 
 func (r *EventsPostgres) GetOneEvent(eventId int) (model.Event, error) {
 	var event model.Event
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", eventsTable)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE e.id = $1", eventColumns, eventsJoin)
 	if err := r.db.Get(&event, query, eventId); err != nil {
 		return model.Event{}, err
 	}
 	var eventBlocks []model.EventBlock
-	query = fmt.Sprintf("SELECT * FROM %s WHERE event_id = $1", eventBlocksTable)
+	query = fmt.Sprintf("SELECT * FROM %s WHERE event_id = $1 ORDER BY position, start_date, id", eventBlocksTable)
 	if err := r.db.Select(&eventBlocks, query, eventId); err != nil {
 		return model.Event{}, err
 	}
@@ -236,6 +419,226 @@ func (r *EventsPostgres) GetOneEvent(eventId int) (model.Event, error) {
 	return event, nil
 }
 
+// GetBlocksByUID returns the stored blocks with the given uids.
+func (r *EventsPostgres) GetBlocksByUID(uids []string) ([]model.EventBlock, error) {
+	var blocks []model.EventBlock
+	query := fmt.Sprintf("SELECT * FROM %s WHERE uid = ANY($1)", eventBlocksTable)
+	if err := r.db.Select(&blocks, query, pq.Array(uids)); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// GetEvents returns the events with the given ids without their blocks.
+func (r *EventsPostgres) GetEvents(eventIds []int) ([]model.Event, error) {
+	var events []model.Event
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE e.id = ANY($1) ORDER BY e.id", eventColumns, eventsJoin)
+	if err := r.db.Select(&events, query, pq.Array(eventIds)); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetChildEvents returns the events of a series with their blocks.
+func (r *EventsPostgres) GetChildEvents(parentId int) ([]model.Event, error) {
+	var events []model.Event
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE e.parent_id = $1 ORDER BY e.id", eventColumns, eventsJoin)
+	if err := r.db.Select(&events, query, parentId); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+	eventIds := make([]int, len(events))
+	for i, event := range events {
+		eventIds[i] = event.ID
+	}
+	var blocks []model.EventBlock
+	query = fmt.Sprintf("SELECT * FROM %s WHERE event_id = ANY($1) ORDER BY event_id, position, start_date, id", eventBlocksTable)
+	if err := r.db.Select(&blocks, query, pq.Array(eventIds)); err != nil {
+		return nil, err
+	}
+	byEvent := make(map[int][]model.EventBlock, len(events))
+	for _, block := range blocks {
+		byEvent[block.EventID] = append(byEvent[block.EventID], block)
+	}
+	for i := range events {
+		events[i].EventBlocks = byEvent[events[i].ID]
+	}
+	return events, nil
+}
+
+// SetEventParent links the event to a series, a nil parentId unlinks it.
+// The event and the parent are locked in id order while the series rules
+// are checked, so concurrent links can not nest series.
+func (r *EventsPostgres) SetEventParent(eventId int, parentId *int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	ids := []int{eventId}
+	if parentId != nil {
+		ids = append(ids, *parentId)
+	}
+	var locked []struct {
+		ID       int  `db:"id"`
+		ParentID *int `db:"parent_id"`
+	}
+	query := fmt.Sprintf("SELECT id, parent_id FROM %s WHERE id = ANY($1) ORDER BY id FOR UPDATE", eventsTable)
+	if err := tx.Select(&locked, query, pq.Array(ids)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	found := make(map[int]*int, len(locked))
+	for _, event := range locked {
+		found[event.ID] = event.ParentID
+	}
+	if _, ok := found[eventId]; !ok {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	if parentId != nil {
+		grandparentId, ok := found[*parentId]
+		if !ok {
+			tx.Rollback()
+			return model.ErrParentNotFound
+		}
+		if grandparentId != nil {
+			tx.Rollback()
+			return model.ErrParentIsStage
+		}
+		var hasChildren bool
+		query = fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE parent_id = $1)", eventsTable)
+		if err := tx.Get(&hasChildren, query, eventId); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if hasChildren {
+			tx.Rollback()
+			return model.ErrHasStages
+		}
+	}
+	query = fmt.Sprintf("UPDATE %s SET parent_id = $1, updated_at = NOW() WHERE id = $2", eventsTable)
+	if _, err := tx.Exec(query, parentId, eventId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// CopyEvent creates the event with its blocks in one transaction. Blocks
+// keep the ids of the blocks they are copied from, so translations of the
+// source event and its blocks are copied along. A zero sourceId copies no
+// translations.
+func (r *EventsPostgres) CopyEvent(event model.Event, sourceId int) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	if err := lockParent(tx, event.ParentID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	id, err := insertEvent(tx, event)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	blocksQuery := fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date, uid, rrule, all_day, location_id, capacity, registration_deadline, position) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id", eventBlocksTable)
+	eventTranslationsQuery := fmt.Sprintf("INSERT INTO %[1]s (event_id, locale, name, description) SELECT $1, locale, name, description FROM %[1]s WHERE event_id = $2", translationsTable)
+	blockTranslationsQuery := fmt.Sprintf("INSERT INTO %[1]s (block_id, locale, name, description) SELECT $1, locale, name, description FROM %[1]s WHERE block_id = $2", translationsTable)
+	for i, block := range event.EventBlocks {
+		uid, err := blockUID(block)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		var blockId int
+		if err := tx.Get(&blockId, blocksQuery, id, block.Name, block.Description, block.Link, block.StartDate, block.EndDate, uid, block.RRule, block.AllDay, block.LocationID, block.Capacity, block.RegistrationDeadline, i); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if sourceId == 0 || block.ID == 0 {
+			continue
+		}
+		if _, err := tx.Exec(blockTranslationsQuery, blockId, block.ID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if sourceId != 0 {
+		if _, err := tx.Exec(eventTranslationsQuery, id, sourceId); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, nil
+}
+
+// SetBlockOrder gives the blocks positions in the order of blockIds. Every
+// block must belong to the event.
+func (r *EventsPostgres) SetBlockOrder(eventId int, blockIds []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`
+		UPDATE %s b SET position = o.ord - 1
+		FROM unnest($2::INT[]) WITH ORDINALITY AS o(id, ord)
+		WHERE b.id = o.id AND b.event_id = $1
+	`, eventBlocksTable)
+	result, err := tx.Exec(query, eventId, pq.Array(blockIds))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != int64(len(blockIds)) {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	query = fmt.Sprintf("UPDATE %s SET updated_at = NOW() WHERE id = $1", eventsTable)
+	if _, err := tx.Exec(query, eventId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// HasChildEvents tells whether the event is the parent of a series.
+func (r *EventsPostgres) HasChildEvents(eventId int) (bool, error) {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE parent_id = $1)", eventsTable)
+	if err := r.db.Get(&exists, query, eventId); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// CountLabeledEvents counts the events with tags or audience of their own.
+func (r *EventsPostgres) CountLabeledEvents() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE cardinality(tags) > 0 OR cardinality(audience) > 0", eventsTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (r *EventsPostgres) GetOneBlock(blockId int) (model.EventBlock, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", eventBlocksTable)
 	var block model.EventBlock
@@ -247,7 +650,7 @@ func (r *EventsPostgres) GetOneBlock(blockId int) (model.EventBlock, error) {
 
 func (r *EventsPostgres) CleanEvents() error {
 	threeMonthsAgo := time.Now().AddDate(0, -3, 0)
-	query := fmt.Sprintf("DELETE FROM %s WHERE end_date < $1", eventBlocksTable)
+	query := fmt.Sprintf("DELETE FROM %s b WHERE b.end_date < $1 AND b.rrule = '' AND NOT EXISTS (SELECT 1 FROM %s a WHERE a.block_id = b.id)", eventBlocksTable, attendanceTable)
 	_, err := r.db.Exec(query, threeMonthsAgo)
 	return err
 }
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type FavoritesPostgres struct {
+	db *sqlx.DB
+}
+
+func NewFavoritesPostgres(db *sqlx.DB) *FavoritesPostgres {
+	return &FavoritesPostgres{
+		db: db,
+	}
+}
+
+// AddFavorite is idempotent, adding a favourite twice keeps the first one.
+func (r *FavoritesPostgres) AddFavorite(userId int, eventId int) error {
+	query := fmt.Sprintf("INSERT INTO %s (user_id, event_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", favoritesTable)
+	_, err := r.db.Exec(query, userId, eventId)
+	return err
+}
+
+func (r *FavoritesPostgres) RemoveFavorite(userId int, eventId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND event_id = $2", favoritesTable)
+	result, err := r.db.Exec(query, userId, eventId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *FavoritesPostgres) GetFavoriteEventIds(userId int) ([]int, error) {
+	query := fmt.Sprintf("SELECT event_id FROM %s WHERE user_id = $1 ORDER BY created_at", favoritesTable)
+	ids := []int{}
+	if err := r.db.Select(&ids, query, userId); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *FavoritesPostgres) CountFavorites() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", favoritesTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetUserRegistrations returns the registrations made with the email that
+// are not just waiting for a place.
+func (r *FavoritesPostgres) GetUserRegistrations(email string) ([]model.Registration, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE email = $1 AND status <> $2", registrationsTable)
+	registrations := []model.Registration{}
+	if err := r.db.Select(&registrations, query, email, model.RegistrationWaitlisted); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// GetEventFollowers returns the users who favourited the event or
+// registered for one of its blocks.
+func (r *FavoritesPostgres) GetEventFollowers(eventId int) ([]model.User, error) {
+	query := fmt.Sprintf(`
+		SELECT * FROM %s u
+		WHERE u.id IN (SELECT user_id FROM %s WHERE event_id = $1)
+			OR u.email IN (SELECT r.email FROM %s r JOIN %s b ON b.id = r.block_id WHERE b.event_id = $1)
+	`, usersTable, favoritesTable, registrationsTable, eventBlocksTable)
+	users := []model.User{}
+	if err := r.db.Select(&users, query, eventId); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type ImportPostgres struct {
+	db *sqlx.DB
+}
+
+func NewImportPostgres(db *sqlx.DB) *ImportPostgres {
+	return &ImportPostgres{
+		db: db,
+	}
+}
+
+// ImportBlocks creates or updates blocks matched by UID and events matched
+// by name in a single transaction. In dry-run mode the transaction is rolled back, so the
+// report describes what would have been written.
+func (r *ImportPostgres) ImportBlocks(blocks []model.ImportBlock, dryRun bool) (model.ImportReport, error) {
+	report := model.ImportReport{DryRun: dryRun, Results: make([]model.ImportResult, 0, len(blocks))}
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return model.ImportReport{}, err
+	}
+	createdEvents := make(map[string]bool)
+	for _, item := range blocks {
+		eventId, eventName, err := resolveImportEvent(tx, item, createdEvents)
+		if err != nil {
+			tx.Rollback()
+			return model.ImportReport{}, err
+		}
+		result := model.ImportResult{
+			Row:          item.Row,
+			EventID:      eventId,
+			EventName:    eventName,
+			EventCreated: createdEvents[eventName],
+		}
+		if item.Block != nil {
+			imported, err := upsertImportedBlock(tx, eventId, *item.Block, item.KeepRRule)
+			if err != nil {
+				tx.Rollback()
+				return model.ImportReport{}, err
+			}
+			result.UID = imported.uid
+			result.Action = imported.action
+			result.BlockID = imported.id
+			if imported.action == model.ImportCreated {
+				report.Created++
+			} else {
+				report.Updated++
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	if dryRun {
+		return report, tx.Rollback()
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return model.ImportReport{}, err
+	}
+	return report, nil
+}
+
+func resolveImportEvent(tx *sqlx.Tx, item model.ImportBlock, createdEvents map[string]bool) (int, string, error) {
+	if item.EventID != 0 {
+		var name string
+		query := fmt.Sprintf("SELECT name FROM %s WHERE id = $1", eventsTable)
+		if err := tx.Get(&name, query, item.EventID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, "", &model.ImportError{Err: fmt.Errorf("event %d not found", item.EventID)}
+			}
+			return 0, "", err
+		}
+		return item.EventID, name, nil
+	}
+	var id int
+	query := fmt.Sprintf("SELECT id FROM %s WHERE name = $1", eventsTable)
+	err := tx.Get(&id, query, item.EventName)
+	if err == nil {
+		if item.EventDescription != "" && !createdEvents[item.EventName] {
+			query = fmt.Sprintf("UPDATE %s SET description = $1, updated_at = NOW() WHERE id = $2 AND description IS DISTINCT FROM $1", eventsTable)
+			if _, err := tx.Exec(query, item.EventDescription, id); err != nil {
+				return 0, "", err
+			}
+		}
+		return id, item.EventName, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", err
+	}
+	query = fmt.Sprintf("INSERT INTO %s (name, description) VALUES ($1, $2) RETURNING id", eventsTable)
+	if err := tx.Get(&id, query, item.EventName, item.EventDescription); err != nil {
+		return 0, "", err
+	}
+	createdEvents[item.EventName] = true
+	return id, item.EventName, nil
+}
+
+type importedBlock struct {
+	id     int
+	uid    string
+	action string
+}
+
+// upsertImportedBlock updates the block with the uid or creates it. With
+// keepRRule an updated block keeps its stored rule.
+func upsertImportedBlock(tx *sqlx.Tx, eventId int, block model.EventBlock, keepRRule bool) (importedBlock, error) {
+	var id int
+	if block.UID != "" {
+		query := fmt.Sprintf("SELECT id FROM %s WHERE uid = $1", eventBlocksTable)
+		err := tx.Get(&id, query, block.UID)
+		if err == nil {
+			query = fmt.Sprintf("UPDATE %s SET event_id = $1, name = $2, description = $3, start_date = $4, end_date = $5, link = $6, rrule = CASE WHEN $10 THEN rrule ELSE $7 END, all_day = $8, updated_at = NOW() WHERE id = $9", eventBlocksTable)
+			if _, err := tx.Exec(query, eventId, block.Name, block.Description, block.StartDate, block.EndDate, block.Link, block.RRule, block.AllDay, id, keepRRule); err != nil {
+				return importedBlock{}, err
+			}
+			return importedBlock{id: id, uid: block.UID, action: model.ImportUpdated}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return importedBlock{}, err
+		}
+	}
+	uid, err := blockUID(block)
+	if err != nil {
+		return importedBlock{}, err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date, uid, rrule, all_day, position) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, %s) RETURNING id", eventBlocksTable, nextBlockPosition(1))
+	if err := tx.Get(&id, query, eventId, block.Name, block.Description, block.Link, block.StartDate, block.EndDate, uid, block.RRule, block.AllDay); err != nil {
+		return importedBlock{}, err
+	}
+	return importedBlock{id: id, uid: uid, action: model.ImportCreated}, nil
+}
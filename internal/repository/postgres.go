@@ -9,6 +9,23 @@ import (
 const (
 	eventsTable = "events"
 	eventBlocksTable = "event_blocks"
+	blockExceptionsTable = "event_block_exceptions"
+	academicPeriodsTable = "academic_periods"
+	roomsTable = "rooms"
+	auditLogTable = "audit_log"
+	registrationsTable = "registrations"
+	attendanceTable = "attendance"
+	usersTable = "users"
+	favoritesTable = "favorites"
+	deliveriesTable = "deliveries"
+	webhooksTable = "webhooks"
+	webhookDeliveriesTable = "webhook_deliveries"
+	changeLogTable = "change_log"
+	attachmentsTable = "attachments"
+	orphanedFilesTable = "orphaned_files"
+	translationsTable = "translations"
+	templatesTable = "event_templates"
+	blockUIDDomain = "it9tech.ru"
 )
 
 type PostgresConfig struct {
@@ -20,8 +37,12 @@ type PostgresConfig struct {
 	SSLMode  string
 }
 
+func (cfg PostgresConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+}
+
 func NewPostgresDB(cfg PostgresConfig) (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode))
+	db, err := sqlx.Open("postgres", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
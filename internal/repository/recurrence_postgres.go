@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+type RecurrencePostgres struct {
+	db *sqlx.DB
+}
+
+func NewRecurrencePostgres(db *sqlx.DB) *RecurrencePostgres {
+	return &RecurrencePostgres{
+		db: db,
+	}
+}
+
+func (r *RecurrencePostgres) GetRecurringBlocks() ([]model.EventBlock, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE rrule <> '' ORDER BY event_id, position, start_date, id", eventBlocksTable)
+	var blocks []model.EventBlock
+	if err := r.db.Select(&blocks, query); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (r *RecurrencePostgres) GetBlockExceptions(blockIds []int) ([]model.BlockException, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE block_id = ANY($1) ORDER BY block_id, recurrence_id", blockExceptionsTable)
+	var exceptions []model.BlockException
+	if err := r.db.Select(&exceptions, query, pq.Array(blockIds)); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+func (r *RecurrencePostgres) SaveBlockException(exception model.BlockException) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (block_id, recurrence_id, cancelled, name, description, start_date, end_date, link)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (block_id, recurrence_id) DO UPDATE SET
+			cancelled = EXCLUDED.cancelled,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			start_date = EXCLUDED.start_date,
+			end_date = EXCLUDED.end_date,
+			link = EXCLUDED.link
+	`, blockExceptionsTable)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, exception.BlockID, exception.RecurrenceID, exception.Cancelled, exception.Name, exception.Description, exception.StartDate, exception.EndDate, exception.Link); err != nil {
+		tx.Rollback()
+		return err
+	}
+	query = fmt.Sprintf("UPDATE %s SET updated_at = NOW() WHERE id = $1", eventBlocksTable)
+	if _, err := tx.Exec(query, exception.BlockID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// SplitRecurringBlock ends the series of blockId with rrule and, unless next
+// is nil, starts a new block carrying the rest of the series. Exceptions at
+// or after from belong to the replaced part and are removed.
+func (r *RecurrencePostgres) SplitRecurringBlock(blockId int, rrule string, from time.Time, next *model.EventBlock) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("UPDATE %s SET rrule = $1, updated_at = NOW() WHERE id = $2", eventBlocksTable)
+	if _, err := tx.Exec(query, rrule, blockId); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	query = fmt.Sprintf("DELETE FROM %s WHERE block_id = $1 AND recurrence_id >= $2", blockExceptionsTable)
+	if _, err := tx.Exec(query, blockId, from); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var id int
+	if next != nil {
+		uid, err := blockUID(*next)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		query = fmt.Sprintf("INSERT INTO %s (event_id, name, description, link, start_date, end_date, uid, rrule, all_day, location_id, capacity, position) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id", eventBlocksTable)
+		if err := tx.Get(&id, query, next.EventID, next.Name, next.Description, next.Link, next.StartDate, next.EndDate, uid, next.RRule, next.AllDay, next.LocationID, next.Capacity, next.Position); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *RecurrencePostgres) DeleteBlockExceptions(blockId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE block_id = $1", blockExceptionsTable)
+	_, err := r.db.Exec(query, blockId)
+	return err
+}
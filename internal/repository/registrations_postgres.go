@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type RegistrationsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewRegistrationsPostgres(db *sqlx.DB) *RegistrationsPostgres {
+	return &RegistrationsPostgres{
+		db: db,
+	}
+}
+
+func (r *RegistrationsPostgres) GetRegistrationStatus(blockId int) (model.RegistrationStatus, error) {
+	return registrationStatus(r.db, blockId, false)
+}
+
+// registrationStatus reads the capacity of a block and the number of its
+// registrations. With lock the block row stays locked until the end of the
+// transaction, so sign-ups, cancellations and promotions for the block run
+// one at a time.
+func registrationStatus(q sqlx.Queryer, blockId int, lock bool) (model.RegistrationStatus, error) {
+	query := fmt.Sprintf(`
+		SELECT b.id, COALESCE(b.capacity, NULLIF(r.capacity, 0)), b.registration_deadline, b.start_date, b.end_date
+		FROM %s b
+		LEFT JOIN %s r ON r.id = b.location_id
+		WHERE b.id = $1
+	`, eventBlocksTable, roomsTable)
+	if lock {
+		query += " FOR UPDATE OF b"
+	}
+	var status model.RegistrationStatus
+	if err := q.QueryRowx(query, blockId).Scan(&status.BlockID, &status.Capacity, &status.Deadline, &status.StartDate, &status.EndDate); err != nil {
+		return model.RegistrationStatus{}, err
+	}
+	query = fmt.Sprintf(`
+		SELECT
+			COUNT(*) FILTER (WHERE status <> $2),
+			COUNT(*) FILTER (WHERE status = $2)
+		FROM %s WHERE block_id = $1
+	`, registrationsTable)
+	if err := q.QueryRowx(query, blockId, model.RegistrationWaitlisted).Scan(&status.Registered, &status.Waitlisted); err != nil {
+		return model.RegistrationStatus{}, err
+	}
+	return status, nil
+}
+
+// CreateRegistration adds a registration unless the block is closed or
+// already has the email. When the block is full the student joins the end
+// of its waitlist.
+func (r *RegistrationsPostgres) CreateRegistration(registration model.Registration, now time.Time) (model.Registration, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return model.Registration{}, err
+	}
+	status, err := registrationStatus(tx, registration.BlockID, true)
+	if err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	if err := status.Check(now); err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	registration.Status = model.RegistrationConfirmed
+	if status.Free() == 0 {
+		registration.Status = model.RegistrationWaitlisted
+	}
+	if registration.Token, err = randomToken(); err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO %s (block_id, name, grade, class, email, status, token) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (block_id, email) DO NOTHING
+		RETURNING id, created_at
+	`, registrationsTable)
+	row := tx.QueryRowx(query, registration.BlockID, registration.Name, registration.Grade, registration.Class, registration.Email, registration.Status, registration.Token)
+	if err := row.Scan(&registration.ID, &registration.CreatedAt); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return model.Registration{}, model.ErrAlreadyRegistered
+		}
+		return model.Registration{}, err
+	}
+	if registration.Status == model.RegistrationWaitlisted {
+		registration.Position = status.Waitlisted + 1
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	return registration, nil
+}
+
+func (r *RegistrationsPostgres) GetRegistrations(blockId int) ([]model.Registration, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE block_id = $1 ORDER BY created_at, id", registrationsTable)
+	registrations := []model.Registration{}
+	if err := r.db.Select(&registrations, query, blockId); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+func (r *RegistrationsPostgres) CountRegistrations() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", registrationsTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *RegistrationsPostgres) GetBlockRegistration(blockId int, email string) (model.Registration, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE block_id = $1 AND email = $2", registrationsTable)
+	var registration model.Registration
+	if err := r.db.Get(&registration, query, blockId, email); err != nil {
+		return model.Registration{}, err
+	}
+	return registration, nil
+}
+
+// GetRegistrationByToken returns the registration with its place on the
+// waitlist, if it is waiting.
+func (r *RegistrationsPostgres) GetRegistrationByToken(token string) (model.Registration, error) {
+	query := fmt.Sprintf(`
+		SELECT r.*, CASE WHEN r.status = $2 THEN (
+			SELECT COUNT(*) FROM %[1]s w
+			WHERE w.block_id = r.block_id AND w.status = $2 AND (w.created_at, w.id) <= (r.created_at, r.id)
+		) ELSE 0 END AS position
+		FROM %[1]s r WHERE r.token = $1
+	`, registrationsTable)
+	var registration model.Registration
+	if err := r.db.Get(&registration, query, token, model.RegistrationWaitlisted); err != nil {
+		return model.Registration{}, err
+	}
+	return registration, nil
+}
+
+func (r *RegistrationsPostgres) DeleteRegistration(registrationId int, now time.Time, offerTTL time.Duration) ([]model.Registration, error) {
+	return r.removeRegistration("id = $1", registrationId, now, offerTTL)
+}
+
+func (r *RegistrationsPostgres) CancelRegistration(token string, now time.Time, offerTTL time.Duration) ([]model.Registration, error) {
+	return r.removeRegistration("token = $1", token, now, offerTTL)
+}
+
+// removeRegistration deletes a registration and offers the freed place to
+// the waitlist in the same transaction. It returns the promoted students.
+func (r *RegistrationsPostgres) removeRegistration(condition string, arg interface{}, now time.Time, offerTTL time.Duration) ([]model.Registration, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	var blockId int
+	query := fmt.Sprintf("SELECT block_id FROM %s WHERE %s", registrationsTable, condition)
+	if err := tx.Get(&blockId, query, arg); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := registrationStatus(tx, blockId, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	query = fmt.Sprintf("DELETE FROM %s WHERE %s", registrationsTable, condition)
+	result, err := tx.Exec(query, arg)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := expectAffected(result); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	promoted, err := promoteWaitlist(tx, blockId, now, offerTTL)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// promoteWaitlist offers free places of a locked block to the first
+// students of its waitlist, as long as the block takes offers.
+func promoteWaitlist(tx *sqlx.Tx, blockId int, now time.Time, offerTTL time.Duration) ([]model.Registration, error) {
+	status, err := registrationStatus(tx, blockId, false)
+	if err != nil {
+		return nil, err
+	}
+	if status.CheckOffer(now) != nil {
+		return nil, nil
+	}
+	free := status.Free()
+	if free < 0 {
+		free = status.Waitlisted
+	}
+	if free == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf(`
+		UPDATE %[1]s SET status = $1, offer_expires_at = $2
+		WHERE id IN (
+			SELECT id FROM %[1]s WHERE block_id = $3 AND status = $4
+			ORDER BY created_at, id LIMIT $5
+		)
+		RETURNING *
+	`, registrationsTable)
+	var promoted []model.Registration
+	if err := tx.Select(&promoted, query, model.RegistrationOffered, now.Add(offerTTL), blockId, model.RegistrationWaitlisted, free); err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// AcceptOffer confirms an offered place unless the offer has expired,
+// registration has closed or the block has started.
+func (r *RegistrationsPostgres) AcceptOffer(token string, now time.Time) (model.Registration, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return model.Registration{}, err
+	}
+	var blockId int
+	query := fmt.Sprintf("SELECT block_id FROM %s WHERE token = $1", registrationsTable)
+	if err := tx.Get(&blockId, query, token); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return model.Registration{}, model.ErrNoOffer
+		}
+		return model.Registration{}, err
+	}
+	status, err := registrationStatus(tx, blockId, true)
+	if err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	if err := status.CheckOffer(now); err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	query = fmt.Sprintf(`
+		UPDATE %s SET status = $1, offer_expires_at = NULL
+		WHERE token = $2 AND status = $3 AND offer_expires_at > $4
+		RETURNING *
+	`, registrationsTable)
+	var registration model.Registration
+	if err := tx.Get(&registration, query, model.RegistrationConfirmed, token, model.RegistrationOffered, now); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return model.Registration{}, model.ErrNoOffer
+		}
+		return model.Registration{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return model.Registration{}, err
+	}
+	return registration, nil
+}
+
+// ExpireOffers releases places whose offers were not accepted in time and
+// offers free places to the next students, including places added by a
+// larger capacity. Waitlists of closed or started blocks are left alone.
+// It returns the expired and the newly promoted registrations.
+func (r *RegistrationsPostgres) ExpireOffers(now time.Time, offerTTL time.Duration) ([]model.Registration, []model.Registration, error) {
+	var blockIds []int
+	query := fmt.Sprintf(`
+		SELECT DISTINCT r.block_id FROM %s r
+		JOIN %s b ON b.id = r.block_id
+		WHERE (r.status = $1 AND r.offer_expires_at <= $2)
+			OR (r.status = $3 AND b.start_date > $2 AND COALESCE(b.registration_deadline, b.end_date) > $2)
+	`, registrationsTable, eventBlocksTable)
+	if err := r.db.Select(&blockIds, query, model.RegistrationOffered, now, model.RegistrationWaitlisted); err != nil {
+		return nil, nil, err
+	}
+	var expired, promoted []model.Registration
+	for _, blockId := range blockIds {
+		tx, err := r.db.Beginx()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := registrationStatus(tx, blockId, true); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		var released []model.Registration
+		query := fmt.Sprintf("DELETE FROM %s WHERE block_id = $1 AND status = $2 AND offer_expires_at <= $3 RETURNING *", registrationsTable)
+		if err := tx.Select(&released, query, blockId, model.RegistrationOffered, now); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		next, err := promoteWaitlist(tx, blockId, now, offerTTL)
+		if err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		expired = append(expired, released...)
+		promoted = append(promoted, next...)
+	}
+	return expired, promoted, nil
+}
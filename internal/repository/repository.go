@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/lavatee/liceum_backend/internal/model"
 )
@@ -15,16 +18,202 @@ type Events interface {
 	GetCurrentEvents() ([]model.Event, error)
 	GetAllEvents() ([]model.Event, error)
 	GetOneEvent(eventId int) (model.Event, error)
+	GetEvents(eventIds []int) ([]model.Event, error)
 	GetOneBlock(blockId int) (model.EventBlock, error)
+	GetBlocksByUID(uids []string) ([]model.EventBlock, error)
+	GetChildEvents(parentId int) ([]model.Event, error)
+	SetEventParent(eventId int, parentId *int) error
+	HasChildEvents(eventId int) (bool, error)
+	CountLabeledEvents() (int, error)
+	CopyEvent(event model.Event, sourceId int) (int, error)
+	SetBlockOrder(eventId int, blockIds []int) error
 	CleanEvents() error
 }
 
+type Import interface {
+	ImportBlocks(blocks []model.ImportBlock, dryRun bool) (model.ImportReport, error)
+}
+
+type Backup interface {
+	Restore(backup model.Backup, mode string) (model.RestoreReport, error)
+}
+
+type Recurrence interface {
+	GetRecurringBlocks() ([]model.EventBlock, error)
+	GetBlockExceptions(blockIds []int) ([]model.BlockException, error)
+	SaveBlockException(exception model.BlockException) error
+	SplitRecurringBlock(blockId int, rrule string, from time.Time, next *model.EventBlock) (int, error)
+	DeleteBlockExceptions(blockId int) error
+}
+
+type Academic interface {
+	CreatePeriod(period model.AcademicPeriod) (int, error)
+	EditPeriod(period model.AcademicPeriod) error
+	DeletePeriod(periodId int) error
+	GetPeriods() ([]model.AcademicPeriod, error)
+	GetNonSchoolPeriods() ([]model.AcademicPeriod, error)
+}
+
+type Rooms interface {
+	CreateRoom(room model.Room) (int, error)
+	EditRoom(room model.Room) error
+	DeleteRoom(roomId int) error
+	GetRooms() ([]model.Room, error)
+	GetRoomBlocks(roomIds []int, from time.Time, to time.Time) ([]model.EventBlock, error)
+	LockRooms(roomIds []int) (func(), error)
+}
+
+type Audit interface {
+	AddAuditEntry(entry model.AuditEntry) error
+	GetAuditLog(limit int) ([]model.AuditEntry, error)
+}
+
+type Registrations interface {
+	GetRegistrationStatus(blockId int) (model.RegistrationStatus, error)
+	CreateRegistration(registration model.Registration, now time.Time) (model.Registration, error)
+	GetRegistrations(blockId int) ([]model.Registration, error)
+	CountRegistrations() (int, error)
+	GetRegistrationByToken(token string) (model.Registration, error)
+	DeleteRegistration(registrationId int, now time.Time, offerTTL time.Duration) ([]model.Registration, error)
+	CancelRegistration(token string, now time.Time, offerTTL time.Duration) ([]model.Registration, error)
+	AcceptOffer(token string, now time.Time) (model.Registration, error)
+	ExpireOffers(now time.Time, offerTTL time.Duration) ([]model.Registration, []model.Registration, error)
+	GetBlockRegistration(blockId int, email string) (model.Registration, error)
+}
+
+type Attendance interface {
+	MarkAttendance(attendance model.Attendance) (int, error)
+	UnmarkAttendance(blockId int, occurrenceStart time.Time, email string) error
+	CountAttendance() (int, error)
+	GetBlockAttendance(blockId int) ([]model.Attendance, error)
+	GetEventAttendance(eventId int) ([]model.AttendanceRecord, error)
+	GetStudentAttendance(email string) ([]model.AttendanceRecord, error)
+}
+
+type Users interface {
+	SignIn(email string, now time.Time) (model.User, error)
+	GetUser(userId int) (model.User, error)
+	GetUserByEmail(email string) (model.User, error)
+	GetUsers(role string) ([]model.User, error)
+	EditUser(user model.User) error
+	DeleteUser(userId int) error
+	GetUserByCalendarToken(token string) (model.User, error)
+	SetCalendarToken(userId int) (string, error)
+	EditNotificationSettings(userId int, settings model.NotificationSettings) error
+	Unsubscribe(token string, kind string) error
+	SetTelegramChat(userId int, chatId *int64) error
+	GetUserByTelegramChat(chatId int64) (model.User, error)
+	GetTelegramUsers() ([]model.User, error)
+}
+
+type Deliveries interface {
+	ClaimDelivery(userId int, kind string, key string) (bool, error)
+	ReleaseDelivery(userId int, kind string, key string) error
+}
+
+type Favorites interface {
+	AddFavorite(userId int, eventId int) error
+	RemoveFavorite(userId int, eventId int) error
+	GetFavoriteEventIds(userId int) ([]int, error)
+	CountFavorites() (int, error)
+	GetUserRegistrations(email string) ([]model.Registration, error)
+	GetEventFollowers(eventId int) ([]model.User, error)
+}
+
+type Webhooks interface {
+	CreateWebhook(webhook model.Webhook) (int, error)
+	EditWebhook(webhook model.Webhook) error
+	DeleteWebhook(webhookId int) error
+	GetWebhook(webhookId int) (model.Webhook, error)
+	GetWebhooks() ([]model.Webhook, error)
+	EnqueueDeliveries(eventType string, payload []byte) (int, error)
+	CreateDelivery(webhookId int, eventType string, payload []byte) (model.WebhookDelivery, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error)
+	SaveDeliveryAttempt(delivery model.WebhookDelivery) error
+	GetDeliveries(webhookId int, limit int) ([]model.WebhookDelivery, error)
+}
+
+type ChangeLog interface {
+	AddChange(change model.EventChange) (int64, error)
+	GetChangesAfter(id int64, limit int) ([]model.ChangeLogEntry, error)
+	GetFirstChangeID() (int64, error)
+	GetLastChangeID() (int64, error)
+	DeleteChangesBefore(before time.Time) error
+	ListenChanges(ctx context.Context, dsn string, notify func()) error
+}
+
+type Attachments interface {
+	CreateAttachment(attachment model.Attachment) (int, error)
+	GetAttachment(attachmentId int) (model.Attachment, error)
+	GetEventAttachments(eventIds []int) ([]model.Attachment, error)
+	DeleteAttachment(attachmentId int) error
+	CountAttachments() (int, error)
+	GetOrphanedFiles(limit int) ([]string, error)
+	DeleteOrphanedFile(key string) error
+}
+
+type Translations interface {
+	SaveEventTranslation(translation model.Translation) error
+	SaveBlockTranslation(translation model.Translation) error
+	DeleteEventTranslation(eventId int, locale string) error
+	DeleteBlockTranslation(blockId int, locale string) error
+	GetEventTranslations(eventId int) ([]model.Translation, error)
+	GetTranslations(locale string, eventIds []int, blockIds []int) ([]model.Translation, error)
+	CountTranslations() (int, error)
+}
+
+type Templates interface {
+	CreateTemplate(template model.EventTemplate) (int, error)
+	EditTemplate(template model.EventTemplate) error
+	DeleteTemplate(templateId int) error
+	GetTemplates() ([]model.EventTemplate, error)
+	GetTemplate(templateId int) (model.EventTemplate, error)
+}
+
+type Batch interface {
+	RunBatch(ops []model.BatchOperation, results []model.BatchResult, atomic bool) error
+}
+
 type Repository struct {
 	Events
+	Import
+	Backup
+	Recurrence
+	Academic
+	Rooms
+	Audit
+	Registrations
+	Attendance
+	Users
+	Favorites
+	Deliveries
+	Webhooks
+	ChangeLog
+	Attachments
+	Translations
+	Templates
+	Batch
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		Events: NewEventsPostgres(db),
+		Events:        NewEventsPostgres(db),
+		Import:        NewImportPostgres(db),
+		Backup:        NewBackupPostgres(db),
+		Recurrence:    NewRecurrencePostgres(db),
+		Academic:      NewAcademicPostgres(db),
+		Rooms:         NewRoomsPostgres(db),
+		Audit:         NewAuditPostgres(db),
+		Registrations: NewRegistrationsPostgres(db),
+		Attendance:    NewAttendancePostgres(db),
+		Users:         NewUsersPostgres(db),
+		Favorites:     NewFavoritesPostgres(db),
+		Deliveries:    NewDeliveriesPostgres(db),
+		Webhooks:      NewWebhooksPostgres(db),
+		ChangeLog:     NewChangeLogPostgres(db),
+		Attachments:   NewAttachmentsPostgres(db),
+		Translations:  NewTranslationsPostgres(db),
+		Templates:     NewTemplatesPostgres(db),
+		Batch:         NewBatchPostgres(db),
 	}
 }
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+type RoomsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewRoomsPostgres(db *sqlx.DB) *RoomsPostgres {
+	return &RoomsPostgres{
+		db: db,
+	}
+}
+
+func (r *RoomsPostgres) CreateRoom(room model.Room) (int, error) {
+	query := fmt.Sprintf("INSERT INTO %s (name, capacity) VALUES ($1, $2) RETURNING id", roomsTable)
+	var id int
+	if err := r.db.Get(&id, query, room.Name, room.Capacity); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *RoomsPostgres) EditRoom(room model.Room) error {
+	query := fmt.Sprintf("UPDATE %s SET name = $1, capacity = $2 WHERE id = $3", roomsTable)
+	result, err := r.db.Exec(query, room.Name, room.Capacity, room.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *RoomsPostgres) DeleteRoom(roomId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", roomsTable)
+	result, err := r.db.Exec(query, roomId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *RoomsPostgres) GetRooms() ([]model.Room, error) {
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY name", roomsTable)
+	rooms := []model.Room{}
+	if err := r.db.Select(&rooms, query); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// GetRoomBlocks returns the blocks booked in the rooms that overlap
+// [from, to) and every recurring block of the rooms, whose occurrences are
+// left to the caller.
+func (r *RoomsPostgres) GetRoomBlocks(roomIds []int, from time.Time, to time.Time) ([]model.EventBlock, error) {
+	query := fmt.Sprintf(`
+		SELECT * FROM %s
+		WHERE location_id = ANY($1) AND (rrule <> '' OR (start_date < $3 AND end_date > $2))
+		ORDER BY start_date
+	`, eventBlocksTable)
+	var blocks []model.EventBlock
+	if err := r.db.Select(&blocks, query, pq.Array(roomIds), from, to); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+const (
+	// roomLockClass keeps room locks apart from other advisory locks.
+	roomLockClass   = 7
+	roomLockTimeout = 30 * time.Second
+)
+
+// LockRooms takes an advisory lock on every room until the returned release
+// is called. Writers that check rooms for conflicts hold the lock from the
+// check until their write commits, so concurrent writes to a room are
+// checked one after another. Locks are held by a connection of their own
+// and are taken in id order to avoid deadlocks.
+func (r *RoomsPostgres) LockRooms(roomIds []int) (func(), error) {
+	if len(roomIds) == 0 {
+		return func() {}, nil
+	}
+	ids := append([]int{}, roomIds...)
+	sort.Ints(ids)
+	ctx, cancel := context.WithTimeout(context.Background(), roomLockTimeout)
+	defer cancel()
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, $2)", roomLockClass, id); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("room %d is locked: %w", id, err)
+		}
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock_all()")
+		conn.Close()
+	}, nil
+}
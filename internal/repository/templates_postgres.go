@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type TemplatesPostgres struct {
+	db *sqlx.DB
+}
+
+func NewTemplatesPostgres(db *sqlx.DB) *TemplatesPostgres {
+	return &TemplatesPostgres{
+		db: db,
+	}
+}
+
+func (r *TemplatesPostgres) CreateTemplate(template model.EventTemplate) (int, error) {
+	query := fmt.Sprintf("INSERT INTO %s (name, event) VALUES ($1, $2) RETURNING id", templatesTable)
+	var id int
+	if err := r.db.Get(&id, query, template.Name, template.Event); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *TemplatesPostgres) EditTemplate(template model.EventTemplate) error {
+	query := fmt.Sprintf("UPDATE %s SET name = $1, event = $2, updated_at = NOW() WHERE id = $3", templatesTable)
+	result, err := r.db.Exec(query, template.Name, template.Event, template.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TemplatesPostgres) DeleteTemplate(templateId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", templatesTable)
+	result, err := r.db.Exec(query, templateId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TemplatesPostgres) GetTemplates() ([]model.EventTemplate, error) {
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY name", templatesTable)
+	templates := []model.EventTemplate{}
+	if err := r.db.Select(&templates, query); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (r *TemplatesPostgres) GetTemplate(templateId int) (model.EventTemplate, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", templatesTable)
+	var template model.EventTemplate
+	if err := r.db.Get(&template, query, templateId); err != nil {
+		return model.EventTemplate{}, err
+	}
+	return template, nil
+}
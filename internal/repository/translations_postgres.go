@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+type TranslationsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewTranslationsPostgres(db *sqlx.DB) *TranslationsPostgres {
+	return &TranslationsPostgres{
+		db: db,
+	}
+}
+
+func (r *TranslationsPostgres) SaveEventTranslation(translation model.Translation) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (event_id, locale, name, description) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (event_id, locale) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			updated_at = NOW()
+	`, translationsTable)
+	_, err := r.db.Exec(query, translation.EventID, translation.Locale, translation.Name, translation.Description)
+	return err
+}
+
+func (r *TranslationsPostgres) SaveBlockTranslation(translation model.Translation) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (block_id, locale, name, description) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (block_id, locale) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			updated_at = NOW()
+	`, translationsTable)
+	_, err := r.db.Exec(query, translation.BlockID, translation.Locale, translation.Name, translation.Description)
+	return err
+}
+
+func (r *TranslationsPostgres) DeleteEventTranslation(eventId int, locale string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE event_id = $1 AND locale = $2", translationsTable)
+	result, err := r.db.Exec(query, eventId, locale)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TranslationsPostgres) DeleteBlockTranslation(blockId int, locale string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE block_id = $1 AND locale = $2", translationsTable)
+	result, err := r.db.Exec(query, blockId, locale)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetEventTranslations returns the translations of the event and of its
+// blocks in every locale.
+func (r *TranslationsPostgres) GetEventTranslations(eventId int) ([]model.Translation, error) {
+	query := fmt.Sprintf(`
+		SELECT * FROM %s
+		WHERE event_id = $1 OR block_id IN (SELECT id FROM %s WHERE event_id = $1)
+		ORDER BY locale, block_id NULLS FIRST
+	`, translationsTable, eventBlocksTable)
+	translations := []model.Translation{}
+	if err := r.db.Select(&translations, query, eventId); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (r *TranslationsPostgres) GetTranslations(locale string, eventIds []int, blockIds []int) ([]model.Translation, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE locale = $1 AND (event_id = ANY($2) OR block_id = ANY($3))", translationsTable)
+	var translations []model.Translation
+	if err := r.db.Select(&translations, query, locale, pq.Array(eventIds), pq.Array(blockIds)); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (r *TranslationsPostgres) CountTranslations() (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", translationsTable)
+	var count int
+	if err := r.db.Get(&count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
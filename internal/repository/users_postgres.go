@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type UsersPostgres struct {
+	db *sqlx.DB
+}
+
+func NewUsersPostgres(db *sqlx.DB) *UsersPostgres {
+	return &UsersPostgres{
+		db: db,
+	}
+}
+
+// SignIn returns the user with the email, creating a student account on
+// the first sign in.
+func (r *UsersPostgres) SignIn(email string, now time.Time) (model.User, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (email, last_login_at) VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET last_login_at = EXCLUDED.last_login_at
+		RETURNING *
+	`, usersTable)
+	var user model.User
+	if err := r.db.Get(&user, query, email, now); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (r *UsersPostgres) GetUser(userId int) (model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", usersTable)
+	var user model.User
+	if err := r.db.Get(&user, query, userId); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (r *UsersPostgres) GetUserByEmail(email string) (model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE email = $1", usersTable)
+	var user model.User
+	if err := r.db.Get(&user, query, email); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (r *UsersPostgres) GetUsers(role string) ([]model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE $1 = '' OR role = $1 ORDER BY email", usersTable)
+	users := []model.User{}
+	if err := r.db.Select(&users, query, role); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *UsersPostgres) EditUser(user model.User) error {
+	query := fmt.Sprintf("UPDATE %s SET name = $1, role = $2, grade = $3, class = $4 WHERE id = $5", usersTable)
+	result, err := r.db.Exec(query, user.Name, user.Role, user.Grade, user.Class, user.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *UsersPostgres) DeleteUser(userId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", usersTable)
+	result, err := r.db.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *UsersPostgres) GetUserByCalendarToken(token string) (model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE calendar_token = $1", usersTable)
+	var user model.User
+	if err := r.db.Get(&user, query, token); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// SetCalendarToken replaces the user's calendar token, so links made with
+// the old one stop working.
+func (r *UsersPostgres) SetCalendarToken(userId int) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	query := fmt.Sprintf("UPDATE %s SET calendar_token = $1 WHERE id = $2", usersTable)
+	result, err := r.db.Exec(query, token, userId)
+	if err != nil {
+		return "", err
+	}
+	return token, expectAffected(result)
+}
+
+func (r *UsersPostgres) EditNotificationSettings(userId int, settings model.NotificationSettings) error {
+	query := fmt.Sprintf("UPDATE %s SET reminders_enabled = $1, reminder_hours = $2, digest_enabled = $3 WHERE id = $4", usersTable)
+	result, err := r.db.Exec(query, settings.RemindersEnabled, settings.ReminderHours, settings.DigestEnabled, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// Unsubscribe turns off reminders, the digest or, for an empty kind, both
+// for the user with the unsubscribe token.
+func (r *UsersPostgres) Unsubscribe(token string, kind string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET
+			reminders_enabled = reminders_enabled AND $2 = '%s',
+			digest_enabled = digest_enabled AND $2 = '%s'
+		WHERE unsubscribe_token = $1
+	`, usersTable, model.DeliveryDigest, model.DeliveryReminder)
+	result, err := r.db.Exec(query, token, kind)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// SetTelegramChat links the chat to the user, unlinking it from anyone it
+// was linked to before. A nil chatId unlinks the user.
+func (r *UsersPostgres) SetTelegramChat(userId int, chatId *int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	if chatId != nil {
+		query := fmt.Sprintf("UPDATE %s SET telegram_chat_id = NULL WHERE telegram_chat_id = $1", usersTable)
+		if _, err := tx.Exec(query, *chatId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	query := fmt.Sprintf("UPDATE %s SET telegram_chat_id = $1 WHERE id = $2", usersTable)
+	result, err := tx.Exec(query, chatId, userId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UsersPostgres) GetUserByTelegramChat(chatId int64) (model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE telegram_chat_id = $1", usersTable)
+	var user model.User
+	if err := r.db.Get(&user, query, chatId); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (r *UsersPostgres) GetTelegramUsers() ([]model.User, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE telegram_chat_id IS NOT NULL", usersTable)
+	users := []model.User{}
+	if err := r.db.Select(&users, query); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+type WebhooksPostgres struct {
+	db *sqlx.DB
+}
+
+func NewWebhooksPostgres(db *sqlx.DB) *WebhooksPostgres {
+	return &WebhooksPostgres{
+		db: db,
+	}
+}
+
+func (r *WebhooksPostgres) CreateWebhook(webhook model.Webhook) (int, error) {
+	query := fmt.Sprintf("INSERT INTO %s (url, secret, event_types, active) VALUES ($1, $2, $3, $4) RETURNING id", webhooksTable)
+	var id int
+	if err := r.db.Get(&id, query, webhook.URL, webhook.Secret, webhook.EventTypes, webhook.Active); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// EditWebhook keeps the stored secret when webhook.Secret is empty.
+func (r *WebhooksPostgres) EditWebhook(webhook model.Webhook) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET url = $1, secret = COALESCE(NULLIF($2, ''), secret), event_types = $3, active = $4
+		WHERE id = $5
+	`, webhooksTable)
+	result, err := r.db.Exec(query, webhook.URL, webhook.Secret, webhook.EventTypes, webhook.Active, webhook.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *WebhooksPostgres) DeleteWebhook(webhookId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", webhooksTable)
+	result, err := r.db.Exec(query, webhookId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *WebhooksPostgres) GetWebhook(webhookId int) (model.Webhook, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", webhooksTable)
+	var webhook model.Webhook
+	if err := r.db.Get(&webhook, query, webhookId); err != nil {
+		return model.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (r *WebhooksPostgres) GetWebhooks() ([]model.Webhook, error) {
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY id", webhooksTable)
+	webhooks := []model.Webhook{}
+	if err := r.db.Select(&webhooks, query); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// EnqueueDeliveries queues the payload for every active webhook subscribed
+// to the event type and returns how many were queued.
+func (r *WebhooksPostgres) EnqueueDeliveries(eventType string, payload []byte) (int, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (webhook_id, event_type, payload)
+		SELECT id, $1, $2 FROM %s WHERE active AND $1 = ANY(event_types)
+	`, webhookDeliveriesTable, webhooksTable)
+	result, err := r.db.Exec(query, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+func (r *WebhooksPostgres) CreateDelivery(webhookId int, eventType string, payload []byte) (model.WebhookDelivery, error) {
+	query := fmt.Sprintf("INSERT INTO %s (webhook_id, event_type, payload) VALUES ($1, $2, $3) RETURNING *", webhookDeliveriesTable)
+	var delivery model.WebhookDelivery
+	if err := r.db.Get(&delivery, query, webhookId, eventType, payload); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// ClaimDueDeliveries takes up to limit pending deliveries due at now and
+// moves their next attempt to now+lease, so other dispatchers skip them
+// while they are being sent.
+func (r *WebhooksPostgres) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM %s
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`, webhookDeliveriesTable, webhookDeliveriesTable)
+	deliveries := []model.WebhookDelivery{}
+	if err := r.db.Select(&deliveries, query, now, now.Add(lease), model.WebhookPending, limit); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// SaveDeliveryAttempt stores the outcome of an attempt.
+func (r *WebhooksPostgres) SaveDeliveryAttempt(delivery model.WebhookDelivery) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = $1, attempts = $2, next_attempt_at = $3, response_status = $4, last_error = $5, delivered_at = $6
+		WHERE id = $7
+	`, webhookDeliveriesTable)
+	_, err := r.db.Exec(query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.DeliveredAt, delivery.ID)
+	return err
+}
+
+func (r *WebhooksPostgres) GetDeliveries(webhookId int, limit int) ([]model.WebhookDelivery, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2", webhookDeliveriesTable)
+	deliveries := []model.WebhookDelivery{}
+	if err := r.db.Select(&deliveries, query, webhookId, limit); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
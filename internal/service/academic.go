@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+type AcademicService struct {
+	repo     *repository.Repository
+	location *time.Location
+}
+
+func NewAcademicService(repo *repository.Repository, location *time.Location) *AcademicService {
+	return &AcademicService{
+		repo:     repo,
+		location: location,
+	}
+}
+
+func validatePeriod(period model.AcademicPeriod) error {
+	if strings.TrimSpace(period.Name) == "" {
+		return fmt.Errorf("name is empty")
+	}
+	switch period.Kind {
+	case model.PeriodTerm, model.PeriodHoliday, model.PeriodExam, model.PeriodNonSchoolDay:
+	default:
+		return fmt.Errorf("unknown period kind %s", period.Kind)
+	}
+	if period.StartDate.IsZero() || period.EndDate.IsZero() {
+		return fmt.Errorf("start_date and end_date are required")
+	}
+	if period.EndDate.Before(period.StartDate.Time) {
+		return fmt.Errorf("end_date is before start_date")
+	}
+	return nil
+}
+
+func (s *AcademicService) CreatePeriod(period model.AcademicPeriod) (int, error) {
+	if err := validatePeriod(period); err != nil {
+		return 0, err
+	}
+	return s.repo.Academic.CreatePeriod(period)
+}
+
+func (s *AcademicService) EditPeriod(period model.AcademicPeriod) error {
+	if err := validatePeriod(period); err != nil {
+		return err
+	}
+	return s.repo.Academic.EditPeriod(period)
+}
+
+func (s *AcademicService) DeletePeriod(periodId int) error {
+	return s.repo.Academic.DeletePeriod(periodId)
+}
+
+func (s *AcademicService) GetAcademicCalendar() ([]model.AcademicPeriod, error) {
+	return s.repo.Academic.GetPeriods()
+}
+
+// ScheduleWarnings lists blocks that take place on holidays or non-school
+// days. Such blocks are still saved, occurrences of recurring blocks on
+// those days are skipped.
+func (s *AcademicService) ScheduleWarnings(blocks []model.EventBlock) ([]string, error) {
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, block := range blocks {
+		if block.RRule != "" {
+			if skipped := len(holidayExdates(block, holidays, s.location)); skipped > 0 {
+				warnings = append(warnings, fmt.Sprintf("%d occurrences of block %q fall on holidays and will be skipped", skipped, block.Name))
+			}
+			continue
+		}
+		for _, holiday := range holidays {
+			first := model.DateOf(block.StartDate.In(s.location))
+			last := model.DateOf(block.EndDate.In(s.location).Add(-time.Nanosecond))
+			if holiday.StartDate.After(last.Time) || holiday.EndDate.Before(first.Time) {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("block %q is scheduled during %q (%s – %s)", block.Name, holiday.Name, holiday.StartDate, holiday.EndDate))
+		}
+	}
+	return warnings, nil
+}
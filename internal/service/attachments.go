@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxAttachmentSize = 20 << 20
+	// maxImagePixels keeps thumbnail generation away from decompression
+	// bombs, larger images are stored without a thumbnail.
+	maxImagePixels = 50_000_000
+	thumbnailSize  = 320
+)
+
+// attachmentTypes lists the allowed content types with the extension used
+// for storage keys.
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"text/csv":        ".csv",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       ".xlsx",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+}
+
+// zipTypes tells office documents apart, they all sniff as zip archives.
+var zipTypes = map[string]string{
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+type AttachmentsService struct {
+	repo    *repository.Repository
+	storage Storage
+	bus     *ChangeBus
+	link    string
+}
+
+func NewAttachmentsService(repo *repository.Repository, storage Storage, bus *ChangeBus, attachmentLink string) *AttachmentsService {
+	return &AttachmentsService{
+		repo:    repo,
+		storage: storage,
+		bus:     bus,
+		link:    attachmentLink,
+	}
+}
+
+// detectAttachmentType sniffs the content, the declared type of the upload
+// is not trusted. The file name only decides between formats that sniff
+// the same.
+func detectAttachmentType(data []byte, fileName string) string {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	ext := strings.ToLower(path.Ext(fileName))
+	switch {
+	case contentType == "application/zip" && zipTypes[ext] != "":
+		return zipTypes[ext]
+	case contentType == "text/plain" && ext == ".csv":
+		return "text/csv"
+	}
+	return contentType
+}
+
+func cleanFileName(fileName string) string {
+	fileName = path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	fileName = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, fileName)
+	for len(fileName) > 255 {
+		_, size := utf8.DecodeLastRuneInString(fileName)
+		fileName = fileName[:len(fileName)-size]
+	}
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return "file"
+	}
+	return fileName
+}
+
+// UploadAttachment validates and stores a file for the event. Images the
+// server can decode get a JPEG thumbnail.
+func (s *AttachmentsService) UploadAttachment(eventId int, fileName string, data []byte) (model.Attachment, error) {
+	if len(data) == 0 {
+		return model.Attachment{}, fmt.Errorf("file is empty")
+	}
+	if len(data) > maxAttachmentSize {
+		return model.Attachment{}, fmt.Errorf("file is larger than %d MB", maxAttachmentSize>>20)
+	}
+	contentType := detectAttachmentType(data, fileName)
+	ext, ok := attachmentTypes[contentType]
+	if !ok {
+		return model.Attachment{}, fmt.Errorf("file type %s is not allowed", contentType)
+	}
+	if _, err := s.repo.Events.GetOneEvent(eventId); err != nil {
+		return model.Attachment{}, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return model.Attachment{}, err
+	}
+	name := hex.EncodeToString(buf)
+	attachment := model.Attachment{
+		EventID:     eventId,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  fmt.Sprintf("events/%d/%s%s", eventId, name, ext),
+	}
+	thumbnail, width, height, err := makeThumbnail(data)
+	if err != nil {
+		logrus.Errorf("THUMBNAIL ERROR: %s", err.Error())
+	}
+	if width > 0 {
+		attachment.Width, attachment.Height = &width, &height
+	}
+	if err := s.storage.Put(attachment.StorageKey, contentType, data); err != nil {
+		return model.Attachment{}, err
+	}
+	if thumbnail != nil {
+		key := fmt.Sprintf("events/%d/%s.thumb.jpg", eventId, name)
+		if err := s.storage.Put(key, "image/jpeg", thumbnail); err != nil {
+			logrus.Errorf("THUMBNAIL ERROR: %s", err.Error())
+		} else {
+			attachment.ThumbnailKey = &key
+		}
+	}
+	id, err := s.repo.Attachments.CreateAttachment(attachment)
+	if err != nil {
+		s.deleteFiles(attachment)
+		return model.Attachment{}, err
+	}
+	stored, err := s.repo.Attachments.GetAttachment(id)
+	if err != nil {
+		return model.Attachment{}, err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, eventId, 0)
+	return s.withURLs(stored), nil
+}
+
+func (s *AttachmentsService) deleteFiles(attachment model.Attachment) {
+	if err := s.storage.Delete(attachment.StorageKey); err != nil {
+		logrus.Errorf("ATTACHMENT DELETE ERROR: %s", err.Error())
+	}
+	if attachment.ThumbnailKey != nil {
+		if err := s.storage.Delete(*attachment.ThumbnailKey); err != nil {
+			logrus.Errorf("ATTACHMENT DELETE ERROR: %s", err.Error())
+		}
+	}
+}
+
+func (s *AttachmentsService) withURLs(attachment model.Attachment) model.Attachment {
+	attachment.URL = fmt.Sprintf(s.link, attachment.ID)
+	if attachment.ThumbnailKey != nil {
+		attachment.ThumbnailURL = attachment.URL + "/thumbnail"
+	}
+	return attachment
+}
+
+func (s *AttachmentsService) GetAttachments(eventId int) ([]model.Attachment, error) {
+	attachments, err := s.repo.Attachments.GetEventAttachments([]int{eventId})
+	if err != nil {
+		return nil, err
+	}
+	for i := range attachments {
+		attachments[i] = s.withURLs(attachments[i])
+	}
+	return attachments, nil
+}
+
+// attachTo fills Attachments of every event with one query.
+func (s *AttachmentsService) attachTo(events []model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	eventIds := make([]int, len(events))
+	for i, event := range events {
+		eventIds[i] = event.ID
+	}
+	attachments, err := s.repo.Attachments.GetEventAttachments(eventIds)
+	if err != nil {
+		return err
+	}
+	byEvent := make(map[int][]model.Attachment)
+	for _, attachment := range attachments {
+		byEvent[attachment.EventID] = append(byEvent[attachment.EventID], s.withURLs(attachment))
+	}
+	for i := range events {
+		events[i].Attachments = byEvent[events[i].ID]
+	}
+	return nil
+}
+
+// OpenAttachment returns the file or its thumbnail with its size. The
+// caller closes the reader.
+func (s *AttachmentsService) OpenAttachment(attachmentId int, thumbnail bool) (model.Attachment, io.ReadCloser, int64, error) {
+	attachment, err := s.repo.Attachments.GetAttachment(attachmentId)
+	if err != nil {
+		return model.Attachment{}, nil, 0, err
+	}
+	key := attachment.StorageKey
+	if thumbnail {
+		if attachment.ThumbnailKey == nil {
+			return model.Attachment{}, nil, 0, sql.ErrNoRows
+		}
+		key = *attachment.ThumbnailKey
+		attachment.ContentType = "image/jpeg"
+	}
+	file, size, err := s.storage.Get(key)
+	if err != nil {
+		return model.Attachment{}, nil, 0, err
+	}
+	return attachment, file, size, nil
+}
+
+func (s *AttachmentsService) DeleteAttachment(attachmentId int) error {
+	attachment, err := s.repo.Attachments.GetAttachment(attachmentId)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Attachments.DeleteAttachment(attachmentId); err != nil {
+		return err
+	}
+	s.sweep()
+	s.bus.Publish(model.ChangeEventUpdated, attachment.EventID, 0)
+	return nil
+}
+
+// RunAttachmentSweeper deletes files of removed attachments from storage
+// every interval until ctx is done. Attachments also go away together
+// with their events, so files are queued by the database instead of
+// being deleted next to the rows.
+func (s *AttachmentsService) RunAttachmentSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *AttachmentsService) sweep() {
+	keys, err := s.repo.Attachments.GetOrphanedFiles(100)
+	if err != nil {
+		logrus.Errorf("ATTACHMENT SWEEPER ERROR: %s", err.Error())
+		return
+	}
+	for _, key := range keys {
+		if err := s.storage.Delete(key); err != nil {
+			logrus.Errorf("ATTACHMENT SWEEPER ERROR: %s", err.Error())
+			continue
+		}
+		if err := s.repo.Attachments.DeleteOrphanedFile(key); err != nil {
+			logrus.Errorf("ATTACHMENT SWEEPER ERROR: %s", err.Error())
+		}
+	}
+}
+
+// makeThumbnail decodes JPEG, PNG, GIF and WebP images and scales them to
+// fit thumbnailSize, flattened on white. Other files return a nil
+// thumbnail and zero dimensions.
+func makeThumbnail(data []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, nil
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, config.Width, config.Height, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, config.Width, config.Height, err
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scaleDown(src, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, config.Width, config.Height, err
+	}
+	return out.Bytes(), config.Width, config.Height, nil
+}
+
+// scaleDown averages the source pixels covered by each target pixel. Small
+// images keep their size.
+func scaleDown(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := bounds.Min.Y + y*h/th
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*h/th)
+		for x := 0; x < tw; x++ {
+			x0 := bounds.Min.X + x*w/tw
+			x1 := max(x0+1, bounds.Min.X+(x+1)*w/tw)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// Colors are premultiplied, adding the missing alpha
+			// puts the pixel on white.
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
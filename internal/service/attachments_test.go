@@ -0,0 +1,47 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			src.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var data bytes.Buffer
+	if err := png.Encode(&data, src); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail, width, height, err := makeThumbnail(data.Bytes())
+	if err != nil || thumbnail == nil || width != 640 || height != 480 {
+		t.Fatalf("got %d bytes, %dx%d, %v", len(thumbnail), width, height, err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil || format != "jpeg" || config.Width != thumbnailSize || config.Height != 240 {
+		t.Errorf("thumbnail is %s %dx%d, %v", format, config.Width, config.Height, err)
+	}
+}
+
+func TestMakeThumbnailWebP(t *testing.T) {
+	// A lossless 1x1 WebP image.
+	data, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	thumbnail, width, height, err := makeThumbnail(data)
+	if err != nil || thumbnail == nil || width != 1 || height != 1 {
+		t.Errorf("got %d bytes, %dx%d, %v", len(thumbnail), width, height, err)
+	}
+}
+
+func TestMakeThumbnailSkipsOtherFiles(t *testing.T) {
+	thumbnail, width, height, err := makeThumbnail([]byte("%PDF-1.7"))
+	if err != nil || thumbnail != nil || width != 0 || height != 0 {
+		t.Errorf("got %d bytes, %dx%d, %v", len(thumbnail), width, height, err)
+	}
+}
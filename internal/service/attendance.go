@@ -0,0 +1,283 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+const (
+	checkInCodeStep      = 60 * time.Second
+	maxCheckInAttempts   = 5
+	maxIPCheckInAttempts = 30
+	checkInAttemptsTTL   = 2 * checkInCodeStep
+	attendanceDayLayout  = "2006-01-02 15:04"
+)
+
+type AttendanceService struct {
+	repo     *repository.Repository
+	secret   []byte
+	siteURL  string
+	location *time.Location
+
+	mu       sync.Mutex
+	attempts map[string]checkInAttempts
+}
+
+type checkInAttempts struct {
+	failed int
+	reset  time.Time
+}
+
+func NewAttendanceService(repo *repository.Repository, secret string, siteURL string, location *time.Location) *AttendanceService {
+	return &AttendanceService{
+		repo:     repo,
+		secret:   []byte(secret),
+		siteURL:  siteURL,
+		location: location,
+		attempts: make(map[string]checkInAttempts),
+	}
+}
+
+// checkInCode derives a six digit code from the block and the code step of
+// t, so every step gets a new code without storing any.
+func (s *AttendanceService) checkInCode(blockId int, t time.Time) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d:%d", blockId, t.Unix()/int64(checkInCodeStep/time.Second))
+	sum := mac.Sum(nil)
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[:4])%1000000)
+}
+
+func (s *AttendanceService) GetCheckInCode(blockId int) (model.CheckInCode, error) {
+	if _, err := s.repo.Events.GetOneBlock(blockId); err != nil {
+		return model.CheckInCode{}, err
+	}
+	now := time.Now()
+	code := s.checkInCode(blockId, now)
+	return model.CheckInCode{
+		BlockID:   blockId,
+		Code:      code,
+		ExpiresAt: now.Truncate(checkInCodeStep).Add(checkInCodeStep),
+		QRPayload: fmt.Sprintf("%s/check-in/%d?code=%s", s.siteURL, blockId, code),
+	}, nil
+}
+
+// verifyCheckInCode accepts the current code and the previous one, so a
+// code shown just before it rotates still works. Wrong guesses are limited
+// per block and email, and per block and client address, so changing the
+// email does not buy more guesses. The address limit is higher because a
+// whole class may check in from one school network.
+func (s *AttendanceService) verifyCheckInCode(blockId int, email string, ip string, code string, now time.Time) error {
+	keys := []string{
+		fmt.Sprintf("email:%d:%s", blockId, email),
+		fmt.Sprintf("ip:%d:%s", blockId, ip),
+	}
+	limits := []int{maxCheckInAttempts, maxIPCheckInAttempts}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, a := range s.attempts {
+		if now.After(a.reset) {
+			delete(s.attempts, k)
+		}
+	}
+	for i, key := range keys {
+		if s.attempts[key].failed >= limits[i] {
+			return model.ErrTooManyAttempts
+		}
+	}
+	for _, t := range []time.Time{now, now.Add(-checkInCodeStep)} {
+		if hmac.Equal([]byte(s.checkInCode(blockId, t)), []byte(code)) {
+			delete(s.attempts, keys[0])
+			return nil
+		}
+	}
+	for _, key := range keys {
+		attempts, ok := s.attempts[key]
+		if !ok {
+			attempts = checkInAttempts{reset: now.Add(checkInAttemptsTTL)}
+		}
+		attempts.failed++
+		s.attempts[key] = attempts
+	}
+	return model.ErrWrongCheckInCode
+}
+
+// currentOccurrence returns the start of the block's occurrence in progress
+// at now.
+func (s *AttendanceService) currentOccurrence(block model.EventBlock, now time.Time) (time.Time, error) {
+	if block.RRule == "" {
+		if now.Before(block.StartDate) || now.After(block.EndDate) {
+			return time.Time{}, model.ErrCheckInClosed
+		}
+		return block.StartDate, nil
+	}
+	events := []model.Event{{EventBlocks: []model.EventBlock{block}}}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return time.Time{}, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return time.Time{}, err
+	}
+	occurrences := expandBlock(events[0].EventBlocks[0], holidays, s.location, now, now.Add(time.Second))
+	if len(occurrences) == 0 {
+		return time.Time{}, model.ErrCheckInClosed
+	}
+	return *occurrences[0].RecurrenceID, nil
+}
+
+// occurrenceStart checks that start is an occurrence of a recurring block.
+// Single blocks always use their start.
+func (s *AttendanceService) occurrenceStart(block model.EventBlock, start *time.Time) (time.Time, error) {
+	if block.RRule == "" || start == nil {
+		if block.RRule != "" {
+			return time.Time{}, model.ErrNotAnOccurrence
+		}
+		return block.StartDate, nil
+	}
+	rule, err := parseRecurrenceRule(block.RRule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := start.In(s.location)
+	if len(rule.occurrences(block.StartDate.In(s.location), t, t.Add(time.Second))) == 0 {
+		return time.Time{}, model.ErrNotAnOccurrence
+	}
+	return t, nil
+}
+
+// attendee fills the student's details from their registration when they
+// have one.
+func (s *AttendanceService) attendee(attendance *model.Attendance) error {
+	attendance.Email = normalizeEmail(attendance.Email)
+	attendance.Name = strings.TrimSpace(attendance.Name)
+	registration, err := s.repo.Registrations.GetBlockRegistration(attendance.BlockID, attendance.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && registration.Status == model.RegistrationConfirmed {
+		attendance.RegistrationID = &registration.ID
+		attendance.Name = registration.Name
+		attendance.Grade = &registration.Grade
+		attendance.Class = &registration.Class
+		return nil
+	}
+	if attendance.Name == "" {
+		return model.ErrAttendeeNameEmpty
+	}
+	if attendance.Email == "" {
+		return fmt.Errorf("email is empty")
+	}
+	return nil
+}
+
+func (s *AttendanceService) CheckIn(attendance model.Attendance, code string, ip string) (int, error) {
+	now := time.Now()
+	block, err := s.repo.Events.GetOneBlock(attendance.BlockID)
+	if err != nil {
+		return 0, err
+	}
+	start, err := s.currentOccurrence(block, now)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.verifyCheckInCode(block.ID, normalizeEmail(attendance.Email), ip, strings.TrimSpace(code), now); err != nil {
+		return 0, err
+	}
+	if err := s.attendee(&attendance); err != nil {
+		return 0, err
+	}
+	attendance.OccurrenceStart = start
+	attendance.Method = model.AttendanceCode
+	return s.repo.Attendance.MarkAttendance(attendance)
+}
+
+// MarkAttendance lets an admin mark a student present or, with present
+// false, remove the mark. Recurring blocks need the occurrence start.
+func (s *AttendanceService) MarkAttendance(attendance model.Attendance, occurrence *time.Time, present bool) error {
+	block, err := s.repo.Events.GetOneBlock(attendance.BlockID)
+	if err != nil {
+		return err
+	}
+	start, err := s.occurrenceStart(block, occurrence)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return s.repo.Attendance.UnmarkAttendance(block.ID, start, normalizeEmail(attendance.Email))
+	}
+	if err := s.attendee(&attendance); err != nil {
+		return err
+	}
+	attendance.OccurrenceStart = start
+	attendance.Method = model.AttendanceManual
+	_, err = s.repo.Attendance.MarkAttendance(attendance)
+	return err
+}
+
+func (s *AttendanceService) GetBlockAttendance(blockId int) ([]model.Attendance, error) {
+	return s.repo.Attendance.GetBlockAttendance(blockId)
+}
+
+func (s *AttendanceService) EventAttendanceReport(eventId int, format string) (model.ExportFile, error) {
+	records, err := s.repo.Attendance.GetEventAttendance(eventId)
+	if err != nil {
+		return model.ExportFile{}, err
+	}
+	return s.attendanceReport(fmt.Sprintf("attendance-event-%d", eventId), records, format)
+}
+
+func (s *AttendanceService) StudentAttendanceReport(email string, format string) (model.ExportFile, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return model.ExportFile{}, fmt.Errorf("email is empty")
+	}
+	records, err := s.repo.Attendance.GetStudentAttendance(email)
+	if err != nil {
+		return model.ExportFile{}, err
+	}
+	return s.attendanceReport("attendance-student", records, format)
+}
+
+func (s *AttendanceService) attendanceReport(name string, records []model.AttendanceRecord, format string) (model.ExportFile, error) {
+	rows := [][]string{{"event_name", "block_name", "start", "name", "grade", "class", "email", "registered", "present", "method", "checked_in_at"}}
+	for _, record := range records {
+		grade, class, method, checkedIn := "", "", "", ""
+		if record.Grade != nil {
+			grade = strconv.Itoa(*record.Grade)
+		}
+		if record.Class != nil {
+			class = *record.Class
+		}
+		if record.Method != nil {
+			method = *record.Method
+		}
+		if record.CheckedInAt != nil {
+			checkedIn = record.CheckedInAt.In(s.location).Format(attendanceDayLayout)
+		}
+		rows = append(rows, []string{
+			record.EventName,
+			record.BlockName,
+			record.OccurrenceStart.In(s.location).Format(attendanceDayLayout),
+			record.Name,
+			grade,
+			class,
+			record.Email,
+			strconv.FormatBool(record.Registered),
+			strconv.FormatBool(record.Present),
+			method,
+			checkedIn,
+		})
+	}
+	return exportRows(name, rows, format)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func wrongCode(s *AttendanceService, blockId int, now time.Time) string {
+	code := s.checkInCode(blockId, now)
+	previous := s.checkInCode(blockId, now.Add(-checkInCodeStep))
+	for i := 0; ; i++ {
+		wrong := fmt.Sprintf("%06d", i)
+		if wrong != code && wrong != previous {
+			return wrong
+		}
+	}
+}
+
+func TestVerifyCheckInCode(t *testing.T) {
+	s := NewAttendanceService(nil, "secret", "", time.UTC)
+	now := time.Date(2026, 9, 1, 9, 0, 30, 0, time.UTC)
+	if err := s.verifyCheckInCode(1, "a@b.c", "10.0.0.1", s.checkInCode(1, now), now); err != nil {
+		t.Fatalf("current code: %v", err)
+	}
+	if err := s.verifyCheckInCode(1, "a@b.c", "10.0.0.1", s.checkInCode(1, now.Add(-checkInCodeStep)), now); err != nil {
+		t.Fatalf("previous code: %v", err)
+	}
+	if err := s.verifyCheckInCode(2, "a@b.c", "10.0.0.1", s.checkInCode(1, now), now); err != model.ErrWrongCheckInCode {
+		t.Fatalf("code of another block: got %v", err)
+	}
+}
+
+func TestVerifyCheckInCodeLimitsEmail(t *testing.T) {
+	s := NewAttendanceService(nil, "secret", "", time.UTC)
+	now := time.Date(2026, 9, 1, 9, 0, 30, 0, time.UTC)
+	wrong := wrongCode(s, 1, now)
+	for i := 0; i < maxCheckInAttempts; i++ {
+		if err := s.verifyCheckInCode(1, "a@b.c", fmt.Sprintf("10.0.0.%d", i), wrong, now); err != model.ErrWrongCheckInCode {
+			t.Fatalf("attempt %d: got %v", i, err)
+		}
+	}
+	if err := s.verifyCheckInCode(1, "a@b.c", "10.0.1.1", s.checkInCode(1, now), now); err != model.ErrTooManyAttempts {
+		t.Fatalf("after limit: got %v", err)
+	}
+	later := now.Add(checkInAttemptsTTL + time.Second)
+	if err := s.verifyCheckInCode(1, "a@b.c", "10.0.1.1", s.checkInCode(1, later), later); err != nil {
+		t.Fatalf("after reset: %v", err)
+	}
+}
+
+func TestVerifyCheckInCodeLimitsAddress(t *testing.T) {
+	s := NewAttendanceService(nil, "secret", "", time.UTC)
+	now := time.Date(2026, 9, 1, 9, 0, 30, 0, time.UTC)
+	wrong := wrongCode(s, 1, now)
+	for i := 0; i < maxIPCheckInAttempts; i++ {
+		if err := s.verifyCheckInCode(1, fmt.Sprintf("s%d@b.c", i), "10.0.0.1", wrong, now); err != model.ErrWrongCheckInCode {
+			t.Fatalf("attempt %d: got %v", i, err)
+		}
+	}
+	if err := s.verifyCheckInCode(1, "new@b.c", "10.0.0.1", s.checkInCode(1, now), now); err != model.ErrTooManyAttempts {
+		t.Fatalf("after limit: got %v", err)
+	}
+	if err := s.verifyCheckInCode(1, "new@b.c", "10.0.0.2", s.checkInCode(1, now), now); err != nil {
+		t.Fatalf("other address: %v", err)
+	}
+	if err := s.verifyCheckInCode(2, "new@b.c", "10.0.0.1", s.checkInCode(2, now), now); err != nil {
+		t.Fatalf("other block: %v", err)
+	}
+}
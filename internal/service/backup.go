@@ -0,0 +1,527 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/lib/pq"
+)
+
+type BackupService struct {
+	repo     *repository.Repository
+	bus      *ChangeBus
+	location *time.Location
+}
+
+func NewBackupService(repo *repository.Repository, bus *ChangeBus, location *time.Location) *BackupService {
+	return &BackupService{
+		repo:     repo,
+		bus:      bus,
+		location: location,
+	}
+}
+
+func (s *BackupService) Backup(w io.Writer) error {
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return err
+	}
+	periods, err := s.repo.Academic.GetPeriods()
+	if err != nil {
+		return err
+	}
+	rooms, err := s.repo.Rooms.GetRooms()
+	if err != nil {
+		return err
+	}
+	eventIds := make([]int, 0, len(events))
+	for _, event := range events {
+		eventIds = append(eventIds, event.ID)
+	}
+	attachments, err := s.repo.Attachments.GetEventAttachments(eventIds)
+	if err != nil {
+		return err
+	}
+	eventAttachments := make(map[int][]model.BackupAttachment)
+	for _, attachment := range attachments {
+		eventAttachments[attachment.EventID] = append(eventAttachments[attachment.EventID], model.BackupAttachment{
+			FileName:     attachment.FileName,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+			Width:        attachment.Width,
+			Height:       attachment.Height,
+			StorageKey:   attachment.StorageKey,
+			ThumbnailKey: attachment.ThumbnailKey,
+			CreatedAt:    attachment.CreatedAt,
+		})
+	}
+	eventTranslations, blockTranslations, err := s.backupTranslations(events)
+	if err != nil {
+		return err
+	}
+	roomNames := make(map[int]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	// Stages are read with the labels of their parent, back up their own.
+	byId := make(map[int]model.Event, len(events))
+	for _, event := range events {
+		byId[event.ID] = event
+	}
+	for i := range events {
+		if events[i].ParentID != nil {
+			inheritLabels(&events[i], byId[*events[i].ParentID])
+		}
+	}
+	backup := model.Backup{
+		Version:         model.BackupVersion,
+		CreatedAt:       time.Now().UTC(),
+		Admins:          make([]string, 0, len(adminsMap)),
+		Events:          make([]model.BackupEvent, 0, len(events)),
+		AcademicPeriods: periods,
+		Rooms:           rooms,
+	}
+	for email := range adminsMap {
+		backup.Admins = append(backup.Admins, email)
+	}
+	sort.Strings(backup.Admins)
+	for _, event := range events {
+		backupEvent := model.BackupEvent{
+			ID:          event.ID,
+			Name:        event.Name,
+			Description: event.Description,
+			CreatedAt:   event.CreatedAt,
+			UpdatedAt:   event.UpdatedAt,
+			Blocks:      make([]model.BackupBlock, 0, len(event.EventBlocks)),
+			ParentID:    event.ParentID,
+			Tags:        event.Tags,
+			Audience:    event.Audience,
+			Attachments: eventAttachments[event.ID],
+
+			Translations: eventTranslations[event.ID],
+		}
+		for _, block := range event.EventBlocks {
+			room := ""
+			if block.LocationID != nil {
+				room = roomNames[*block.LocationID]
+			}
+			backupEvent.Blocks = append(backupEvent.Blocks, model.BackupBlock{
+				ID:          block.ID,
+				EventID:     event.ID,
+				UID:         block.UID,
+				Name:        block.Name,
+				Description: block.Description,
+				StartDate:   block.StartDate,
+				EndDate:     block.EndDate,
+				AllDay:      block.AllDay,
+				Link:        block.Link,
+				RRule:       block.RRule,
+				Room:        room,
+				Exceptions:  block.Exceptions,
+				CreatedAt:   block.CreatedAt,
+				UpdatedAt:   block.UpdatedAt,
+
+				Capacity:             block.Capacity,
+				RegistrationDeadline: block.RegistrationDeadline,
+				Position:             block.Position,
+
+				Translations: blockTranslations[block.ID],
+			})
+		}
+		backup.Events = append(backup.Events, backupEvent)
+	}
+	return json.NewEncoder(w).Encode(backup)
+}
+
+// backupTranslations returns the translations of the events and of their
+// blocks by event and block id, ordered by locale.
+func (s *BackupService) backupTranslations(events []model.Event) (map[int][]model.BackupTranslation, map[int][]model.BackupTranslation, error) {
+	var eventIds, blockIds []int
+	for _, event := range events {
+		eventIds = append(eventIds, event.ID)
+		for _, block := range event.EventBlocks {
+			blockIds = append(blockIds, block.ID)
+		}
+	}
+	byEvent := make(map[int][]model.BackupTranslation)
+	byBlock := make(map[int][]model.BackupTranslation)
+	for _, locale := range model.Locales {
+		if locale == model.DefaultLocale {
+			continue
+		}
+		translations, err := s.repo.Translations.GetTranslations(locale, eventIds, blockIds)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, translation := range translations {
+			backupTranslation := model.BackupTranslation{
+				Locale:      translation.Locale,
+				Name:        translation.Name,
+				Description: translation.Description,
+				UpdatedAt:   translation.UpdatedAt,
+			}
+			if translation.EventID != nil {
+				byEvent[*translation.EventID] = append(byEvent[*translation.EventID], backupTranslation)
+			} else {
+				byBlock[*translation.BlockID] = append(byBlock[*translation.BlockID], backupTranslation)
+			}
+		}
+	}
+	return byEvent, byBlock, nil
+}
+
+// Restore loads a backup document. Admins are listed in backups for
+// reference only, they are configured in code and are not restored.
+// Replacing is refused while registrations, attendance or favorites
+// exist, backups do not hold them.
+func (s *BackupService) Restore(r io.Reader, mode string, opts model.SaveOptions) (model.RestoreReport, error) {
+	if mode == "" {
+		mode = model.RestoreMerge
+	}
+	if mode != model.RestoreMerge && mode != model.RestoreReplace {
+		return model.RestoreReport{}, fmt.Errorf("unknown restore mode %s", mode)
+	}
+	var backup model.Backup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return model.RestoreReport{}, fmt.Errorf("invalid backup: %s", err.Error())
+	}
+	if err := validateBackup(backup); err != nil {
+		return model.RestoreReport{}, err
+	}
+	if mode == model.RestoreReplace {
+		for _, content := range laterContent {
+			if backup.Version >= content.version {
+				continue
+			}
+			count, err := content.count(s.repo)
+			if err != nil {
+				return model.RestoreReport{}, err
+			}
+			if count > 0 {
+				return model.RestoreReport{}, fmt.Errorf("backup version %d has no %s, replacing would delete %s, restore it in merge mode", backup.Version, content.name, fmt.Sprintf(content.deleted, count))
+			}
+		}
+		for _, content := range unbackedContent {
+			count, err := content.count(s.repo)
+			if err != nil {
+				return model.RestoreReport{}, err
+			}
+			if count > 0 {
+				return model.RestoreReport{}, fmt.Errorf("backups hold no %s, replacing would delete %d of them, restore in merge mode", content.name, count)
+			}
+		}
+	}
+	if backup.Version < model.BackupPositionsVersion {
+		positionBlocks(backup.Events)
+	}
+	if backup.Version >= model.BackupLabelsVersion {
+		for i := range backup.Events {
+			if backup.Events[i].Tags == nil {
+				backup.Events[i].Tags = pq.StringArray{}
+			}
+			if backup.Events[i].Audience == nil {
+				backup.Events[i].Audience = pq.StringArray{}
+			}
+		}
+	}
+	conflicts, release, err := s.checkConflicts(backup, mode, opts)
+	if err != nil {
+		return model.RestoreReport{}, err
+	}
+	defer release()
+	report, err := s.repo.Backup.Restore(backup, mode)
+	if err != nil {
+		return model.RestoreReport{}, err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceRestore, map[string]interface{}{
+			"conflicts": conflicts,
+		})
+	}
+	// A restore touches too much to announce change by change.
+	s.bus.Publish(model.ChangeReset, 0, 0)
+	return report, nil
+}
+
+// positionBlocks orders the blocks of events backed up without positions,
+// all of them at position 0, by start_date as they were shown then.
+func positionBlocks(events []model.BackupEvent) {
+	for _, event := range events {
+		positioned := false
+		for _, block := range event.Blocks {
+			if block.Position != 0 {
+				positioned = true
+				break
+			}
+		}
+		if positioned {
+			continue
+		}
+		order := make([]int, len(event.Blocks))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := event.Blocks[order[i]], event.Blocks[order[j]]
+			if !a.StartDate.Equal(b.StartDate) {
+				return a.StartDate.Before(b.StartDate)
+			}
+			return a.ID < b.ID
+		})
+		for position, i := range order {
+			event.Blocks[i].Position = position
+		}
+	}
+}
+
+// laterContent is what backups before a version do not hold. Replacing
+// the database with such a backup would delete it, merging keeps it.
+var laterContent = []struct {
+	version int
+	name    string
+	deleted string
+	count   func(*repository.Repository) (int, error)
+}{
+	{model.BackupAttachmentsVersion, "attachments", "%d attachments", func(repo *repository.Repository) (int, error) {
+		return repo.Attachments.CountAttachments()
+	}},
+	{model.BackupTranslationsVersion, "translations", "%d translations", func(repo *repository.Repository) (int, error) {
+		return repo.Translations.CountTranslations()
+	}},
+	{model.BackupLabelsVersion, "tags and audience", "those of %d events", func(repo *repository.Repository) (int, error) {
+		return repo.Events.CountLabeledEvents()
+	}},
+}
+
+// unbackedContent is what no backup holds. It belongs to events and
+// blocks, so replacing the database would delete it with them.
+var unbackedContent = []struct {
+	name  string
+	count func(*repository.Repository) (int, error)
+}{
+	{"registrations", func(repo *repository.Repository) (int, error) {
+		return repo.Registrations.CountRegistrations()
+	}},
+	{"attendance records", func(repo *repository.Repository) (int, error) {
+		return repo.Attendance.CountAttendance()
+	}},
+	{"favorites", func(repo *repository.Repository) (int, error) {
+		return repo.Favorites.CountFavorites()
+	}},
+}
+
+// checkConflicts checks the booked blocks of the backup against each other
+// and, when merging, against the stored blocks they do not replace. Rooms
+// that do not exist yet, and every room when replacing, get temporary
+// negative ids, so they are only compared within the backup.
+func (s *BackupService) checkConflicts(backup model.Backup, mode string, opts model.SaveOptions) ([]model.BlockConflict, func(), error) {
+	roomIds := make(map[string]int)
+	storedIds := make(map[string]int)
+	if mode == model.RestoreMerge {
+		rooms, err := s.repo.Rooms.GetRooms()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, room := range rooms {
+			roomIds[room.Name] = room.ID
+		}
+		var uids []string
+		for _, event := range backup.Events {
+			for _, block := range event.Blocks {
+				uids = append(uids, block.UID)
+			}
+		}
+		if len(uids) > 0 {
+			stored, err := s.repo.Events.GetBlocksByUID(uids)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, block := range stored {
+				storedIds[block.UID] = block.ID
+			}
+		}
+	}
+	var blocks []model.EventBlock
+	for _, event := range backup.Events {
+		for _, block := range event.Blocks {
+			if block.Room == "" {
+				continue
+			}
+			roomId, ok := roomIds[block.Room]
+			if !ok {
+				roomId = -len(roomIds) - 1
+				roomIds[block.Room] = roomId
+			}
+			blocks = append(blocks, model.EventBlock{
+				ID:         storedIds[block.UID],
+				UID:        block.UID,
+				Name:       block.Name,
+				StartDate:  block.StartDate,
+				EndDate:    block.EndDate,
+				AllDay:     block.AllDay,
+				RRule:      block.RRule,
+				LocationID: &roomId,
+				Exceptions: block.Exceptions,
+			})
+		}
+	}
+	conflicts, release, err := checkConflicts(s.repo, blocks, s.location, opts)
+	for i := range conflicts {
+		if conflicts[i].RoomID < 0 {
+			conflicts[i].RoomID = 0
+		}
+	}
+	return conflicts, release, err
+}
+
+func validateBackup(backup model.Backup) error {
+	if backup.Version < 1 || backup.Version > model.BackupVersion {
+		return fmt.Errorf("unsupported backup version %d, expected 1 to %d", backup.Version, model.BackupVersion)
+	}
+	rooms := make(map[string]bool, len(backup.Rooms))
+	for _, room := range backup.Rooms {
+		if err := validateRoom(room); err != nil {
+			return fmt.Errorf("room %q: %s", room.Name, err.Error())
+		}
+		if rooms[room.Name] {
+			return fmt.Errorf("room name %q is duplicated", room.Name)
+		}
+		rooms[room.Name] = true
+	}
+	names := make(map[string]bool, len(backup.Events))
+	ids := make(map[int]bool, len(backup.Events))
+	uids := make(map[string]bool)
+	for _, event := range backup.Events {
+		if event.Name == "" {
+			return fmt.Errorf("event %d has no name", event.ID)
+		}
+		if names[event.Name] {
+			return fmt.Errorf("event name %q is duplicated", event.Name)
+		}
+		if ids[event.ID] {
+			return fmt.Errorf("event id %d is duplicated", event.ID)
+		}
+		names[event.Name] = true
+		ids[event.ID] = true
+		if err := validateDescription(event.Description); err != nil {
+			return fmt.Errorf("event %d: %s", event.ID, err.Error())
+		}
+		if err := validateBackupTranslations(event.Translations); err != nil {
+			return fmt.Errorf("event %d: %s", event.ID, err.Error())
+		}
+		for field, labels := range map[string]pq.StringArray{"tags": event.Tags, "audience": event.Audience} {
+			cleaned, err := cleanLabels(field, labels)
+			if err != nil {
+				return fmt.Errorf("event %d: %s", event.ID, err.Error())
+			}
+			if len(cleaned) != len(labels) {
+				return fmt.Errorf("event %d: %s has empty or repeated labels", event.ID, field)
+			}
+		}
+		for _, block := range event.Blocks {
+			if block.UID == "" {
+				return fmt.Errorf("block %d has no uid", block.ID)
+			}
+			if uids[block.UID] {
+				return fmt.Errorf("block uid %s is duplicated", block.UID)
+			}
+			uids[block.UID] = true
+			if block.EndDate.Before(block.StartDate) {
+				return fmt.Errorf("block %s ends before it starts", block.UID)
+			}
+			if err := validateDescription(block.Description); err != nil {
+				return fmt.Errorf("block %s: %s", block.UID, err.Error())
+			}
+			if err := validateBackupTranslations(block.Translations); err != nil {
+				return fmt.Errorf("block %s: %s", block.UID, err.Error())
+			}
+			for _, exception := range block.Exceptions {
+				if exception.Description == nil {
+					continue
+				}
+				if err := validateDescription(*exception.Description); err != nil {
+					return fmt.Errorf("block %s: exception %s: %s", block.UID, exception.RecurrenceID.Format(time.RFC3339), err.Error())
+				}
+			}
+			if _, err := normalizeRRule(block.RRule); err != nil {
+				return fmt.Errorf("block %s: invalid rrule: %s", block.UID, err.Error())
+			}
+			if block.Room != "" && !rooms[block.Room] {
+				return fmt.Errorf("block %s: unknown room %q", block.UID, block.Room)
+			}
+		}
+	}
+	keys := make(map[string]bool)
+	for _, event := range backup.Events {
+		for _, attachment := range event.Attachments {
+			if attachment.FileName == "" || attachment.StorageKey == "" {
+				return fmt.Errorf("event %d: attachment without file name or storage key", event.ID)
+			}
+			if _, ok := attachmentTypes[attachment.ContentType]; !ok {
+				return fmt.Errorf("event %d: attachment %q has unsupported type %s", event.ID, attachment.FileName, attachment.ContentType)
+			}
+			for _, key := range []*string{&attachment.StorageKey, attachment.ThumbnailKey} {
+				if key == nil {
+					continue
+				}
+				if keys[*key] {
+					return fmt.Errorf("storage key %s is duplicated", *key)
+				}
+				keys[*key] = true
+			}
+		}
+	}
+	parents := make(map[int]*int, len(backup.Events))
+	for _, event := range backup.Events {
+		parents[event.ID] = event.ParentID
+	}
+	for _, event := range backup.Events {
+		if event.ParentID == nil {
+			continue
+		}
+		parent, ok := parents[*event.ParentID]
+		if !ok || *event.ParentID == event.ID {
+			return fmt.Errorf("event %d: unknown parent %d", event.ID, *event.ParentID)
+		}
+		if parent != nil {
+			return fmt.Errorf("event %d: parent %d is a stage of another series", event.ID, *event.ParentID)
+		}
+	}
+	for _, period := range backup.AcademicPeriods {
+		if err := validatePeriod(period); err != nil {
+			return fmt.Errorf("academic period %q: %s", period.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// validateBackupTranslations applies the checks of saved translations and
+// allows one translation per locale.
+func validateBackupTranslations(translations []model.BackupTranslation) error {
+	locales := make(map[string]bool, len(translations))
+	for _, translation := range translations {
+		if err := validateTranslation(&model.Translation{
+			Locale:      translation.Locale,
+			Name:        translation.Name,
+			Description: translation.Description,
+		}); err != nil {
+			return fmt.Errorf("translation %s: %s", translation.Locale, err.Error())
+		}
+		if locales[translation.Locale] {
+			return fmt.Errorf("translation %s is duplicated", translation.Locale)
+		}
+		locales[translation.Locale] = true
+	}
+	return nil
+}
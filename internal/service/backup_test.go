@@ -0,0 +1,127 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+func testBackup() model.Backup {
+	start := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	thumbnail := "attachments/poster-thumb.jpg"
+	return model.Backup{
+		Version: model.BackupVersion,
+		Events: []model.BackupEvent{{
+			ID:       1,
+			Name:     "Olympiad",
+			Tags:     pq.StringArray{"math"},
+			Audience: pq.StringArray{"9", "10"},
+			Blocks: []model.BackupBlock{{
+				ID:        1,
+				EventID:   1,
+				UID:       "block-1@liceum",
+				Name:      "Round 1",
+				StartDate: start,
+				EndDate:   start.Add(time.Hour),
+				Translations: []model.BackupTranslation{{
+					Locale: "en",
+					Name:   "Round one",
+				}},
+			}},
+			Translations: []model.BackupTranslation{{
+				Locale:      "en",
+				Description: "Olympiad in mathematics",
+			}},
+			Attachments: []model.BackupAttachment{{
+				FileName:     "poster.png",
+				ContentType:  "image/png",
+				Size:         100,
+				StorageKey:   "attachments/poster.png",
+				ThumbnailKey: &thumbnail,
+			}},
+		}},
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	if err := validateBackup(testBackup()); err != nil {
+		t.Fatal(err)
+	}
+	old := testBackup()
+	old.Version = 1
+	old.Events[0].Attachments = nil
+	old.Events[0].Translations = nil
+	old.Events[0].Blocks[0].Translations = nil
+	if err := validateBackup(old); err != nil {
+		t.Errorf("version 1: %v", err)
+	}
+}
+
+func TestValidateBackupRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*model.Backup)
+		want   string
+	}{
+		{"future version", func(b *model.Backup) { b.Version = model.BackupVersion + 1 }, "unsupported backup version"},
+		{"no version", func(b *model.Backup) { b.Version = 0 }, "unsupported backup version"},
+		{"long description", func(b *model.Backup) {
+			b.Events[0].Blocks[0].Description = strings.Repeat("a", model.MaxDescriptionLength+1)
+		}, "description is longer"},
+		{"attachment without key", func(b *model.Backup) { b.Events[0].Attachments[0].StorageKey = "" }, "storage key"},
+		{"attachment type", func(b *model.Backup) { b.Events[0].Attachments[0].ContentType = "text/html" }, "unsupported type"},
+		{"duplicated key", func(b *model.Backup) {
+			b.Events[0].Attachments = append(b.Events[0].Attachments, b.Events[0].Attachments[0])
+		}, "duplicated"},
+		{"thumbnail key of another file", func(b *model.Backup) {
+			key := b.Events[0].Attachments[0].StorageKey
+			b.Events[0].Attachments[0].ThumbnailKey = &key
+		}, "duplicated"},
+		{"translation locale", func(b *model.Backup) { b.Events[0].Translations[0].Locale = model.DefaultLocale }, "unsupported locale"},
+		{"empty translation", func(b *model.Backup) { b.Events[0].Blocks[0].Translations[0].Name = " " }, "translation is empty"},
+		{"duplicated translation", func(b *model.Backup) {
+			b.Events[0].Translations = append(b.Events[0].Translations, b.Events[0].Translations[0])
+		}, "translation en is duplicated"},
+		{"repeated tag", func(b *model.Backup) { b.Events[0].Tags = pq.StringArray{"math", "math"} }, "empty or repeated"},
+		{"long audience", func(b *model.Backup) {
+			b.Events[0].Audience = pq.StringArray{strings.Repeat("a", maxLabelLength+1)}
+		}, "longer than"},
+	}
+	for _, tt := range tests {
+		backup := testBackup()
+		tt.change(&backup)
+		err := validateBackup(backup)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPositionBlocks(t *testing.T) {
+	start := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	events := []model.BackupEvent{
+		{ID: 1, Blocks: []model.BackupBlock{
+			{ID: 3, StartDate: start.Add(2 * time.Hour)},
+			{ID: 2, StartDate: start},
+			{ID: 1, StartDate: start.Add(time.Hour)},
+		}},
+		{ID: 2, Blocks: []model.BackupBlock{
+			{ID: 4, StartDate: start.Add(time.Hour), Position: 0},
+			{ID: 5, StartDate: start, Position: 1},
+		}},
+	}
+	positionBlocks(events)
+	for i, want := range []int{2, 0, 1} {
+		if got := events[0].Blocks[i].Position; got != want {
+			t.Errorf("block %d: position %d, want %d", events[0].Blocks[i].ID, got, want)
+		}
+	}
+	for i, want := range []int{0, 1} {
+		if got := events[1].Blocks[i].Position; got != want {
+			t.Errorf("positioned block %d: position %d, want %d", events[1].Blocks[i].ID, got, want)
+		}
+	}
+}
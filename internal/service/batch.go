@@ -0,0 +1,335 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+const maxBatchOperations = 500
+
+type BatchService struct {
+	repo     *repository.Repository
+	bus      *ChangeBus
+	location *time.Location
+}
+
+func NewBatchService(repo *repository.Repository, bus *ChangeBus, location *time.Location) *BatchService {
+	return &BatchService{
+		repo:     repo,
+		bus:      bus,
+		location: location,
+	}
+}
+
+// RunBatch checks the operations the way the single endpoints do and writes
+// them in one transaction. Room conflicts are looked for among all blocks
+// of the batch at once, blocks it deletes do not count. In atomic mode the
+// first failure stops the batch with a BatchError, or a ConflictError for
+// room conflicts, and nothing is written. In best-effort mode failed
+// operations are reported in their results and the rest is written.
+// Errors returned without results reject the batch as a whole.
+func (s *BatchService) RunBatch(mode string, ops []model.BatchOperation, save model.SaveOptions) ([]model.BatchResult, error) {
+	if mode == "" {
+		mode = model.BatchAtomic
+	}
+	if mode != model.BatchAtomic && mode != model.BatchBestEffort {
+		return nil, fmt.Errorf("unknown batch mode %s", mode)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("operations is empty")
+	}
+	if len(ops) > maxBatchOperations {
+		return nil, fmt.Errorf("batch has more than %d operations", maxBatchOperations)
+	}
+	atomic := mode == model.BatchAtomic
+	results := make([]model.BatchResult, len(ops))
+	for i := range results {
+		results[i] = model.BatchResult{Index: i, Status: model.BatchSkipped}
+	}
+	var ignored []int
+	created := make(map[string]bool)
+	blocks := make(map[int]*model.EventBlock)
+	for i := range ops {
+		deleted, err := s.prepare(&ops[i], created, blocks)
+		if err != nil {
+			results[i].Status = model.BatchFailed
+			results[i].Error = err.Error()
+			if atomic {
+				return results, &model.BatchError{Index: i, Message: err.Error()}
+			}
+			continue
+		}
+		ignored = append(ignored, deleted...)
+	}
+	conflicts, release, err := s.findConflicts(ops, results, ignored)
+	if err != nil {
+		return results, err
+	}
+	defer release()
+	if len(conflicts) > 0 && !save.Force {
+		if atomic {
+			return results, &model.ConflictError{Conflicts: conflicts}
+		}
+		for i := range results {
+			if len(results[i].Conflicts) > 0 {
+				results[i].Status = model.BatchFailed
+				results[i].Error = (&model.ConflictError{Conflicts: results[i].Conflicts}).Error()
+			}
+		}
+	}
+	if err := s.repo.Batch.RunBatch(ops, results, atomic); err != nil {
+		if !errors.Is(err, repository.ErrBatchFailed) {
+			return results, err
+		}
+		failed := 0
+		for i := range results {
+			if results[i].Status == model.BatchFailed {
+				failed = i
+				break
+			}
+			results[i].Status = model.BatchRolledBack
+			results[i].ID, results[i].EventID = 0, 0
+		}
+		return results, &model.BatchError{Index: failed, Message: results[failed].Error}
+	}
+	if len(conflicts) > 0 && save.Force {
+		recordOverride(s.repo, save, model.AuditForceBatch, map[string]interface{}{
+			"conflicts": conflicts,
+		})
+	}
+	s.publish(ops, results)
+	return results, nil
+}
+
+// prepare validates the operation and completes it for writing. Blocks of
+// updates get the fields their changes leave alone from blocks, the
+// working copies of the blocks the batch has prepared so far, or from
+// the stored block. Deleted blocks are kept in blocks as nil. It returns
+// the ids of the stored blocks the operation deletes.
+func (s *BatchService) prepare(op *model.BatchOperation, created map[string]bool, blocks map[int]*model.EventBlock) ([]int, error) {
+	if op.Op != model.BatchCreate && op.Op != model.BatchUpdate && op.Op != model.BatchDelete {
+		return nil, fmt.Errorf("unknown op %s", op.Op)
+	}
+	if op.Op != model.BatchCreate && op.ID <= 0 {
+		return nil, fmt.Errorf("id is required")
+	}
+	switch op.Type {
+	case model.BatchEvent:
+		return s.prepareEvent(op, created, blocks)
+	case model.BatchBlock:
+		return s.prepareBlock(op, created, blocks)
+	}
+	return nil, fmt.Errorf("unknown type %s", op.Type)
+}
+
+func (s *BatchService) prepareEvent(op *model.BatchOperation, created map[string]bool, blocks map[int]*model.EventBlock) ([]int, error) {
+	if op.Op == model.BatchDelete {
+		event, err := s.repo.Events.GetOneEvent(op.ID)
+		if err != nil {
+			return nil, batchLookupError(err)
+		}
+		ids := make([]int, len(event.EventBlocks))
+		for i, block := range event.EventBlocks {
+			ids[i] = block.ID
+			blocks[block.ID] = nil
+		}
+		return ids, nil
+	}
+	if op.Event == nil {
+		return nil, fmt.Errorf("event is required")
+	}
+	if err := validateDescription(op.Event.Description); err != nil {
+		return nil, err
+	}
+	if op.Op == model.BatchUpdate {
+		stored, err := s.repo.Events.GetOneEvent(op.ID)
+		if err != nil {
+			return nil, batchLookupError(err)
+		}
+		return nil, prepareLabels(s.repo, op.Event, stored.ParentID)
+	}
+	if op.Ref != "" && created[op.Ref] {
+		return nil, fmt.Errorf("ref %s is already used", op.Ref)
+	}
+	if err := validateParent(s.repo, 0, op.Event.ParentID); err != nil {
+		return nil, err
+	}
+	if err := prepareLabels(s.repo, op.Event, op.Event.ParentID); err != nil {
+		return nil, err
+	}
+	if err := validateBlocks(op.Event.EventBlocks, s.location); err != nil {
+		return nil, err
+	}
+	if op.Ref != "" {
+		created[op.Ref] = true
+	}
+	return nil, nil
+}
+
+func (s *BatchService) prepareBlock(op *model.BatchOperation, created map[string]bool, blocks map[int]*model.EventBlock) ([]int, error) {
+	switch op.Op {
+	case model.BatchCreate:
+		if op.Block == nil {
+			return nil, fmt.Errorf("block is required")
+		}
+		if op.EventRef != "" && op.Block.EventID != 0 {
+			return nil, fmt.Errorf("event_id and event_ref can not be combined")
+		}
+		if op.EventRef != "" && !created[op.EventRef] {
+			return nil, fmt.Errorf("unknown event_ref %s", op.EventRef)
+		}
+		if op.EventRef == "" && op.Block.EventID == 0 {
+			return nil, fmt.Errorf("event_id is required")
+		}
+		op.Block.ID = 0
+		op.Block.UID = ""
+	case model.BatchUpdate:
+		if op.Changes == nil {
+			return nil, fmt.Errorf("changes is required")
+		}
+		block, err := s.workingBlock(op.ID, blocks)
+		if err != nil {
+			return nil, err
+		}
+		op.Changes.Apply(&block)
+		op.Block = &block
+	case model.BatchDelete:
+		block, err := s.workingBlock(op.ID, blocks)
+		if err != nil {
+			return nil, err
+		}
+		op.Block = &block
+		blocks[block.ID] = nil
+		return []int{block.ID}, nil
+	}
+	validated := []model.EventBlock{*op.Block}
+	if err := validateBlocks(validated, s.location); err != nil {
+		return nil, err
+	}
+	*op.Block = validated[0]
+	if op.Op == model.BatchUpdate {
+		working := *op.Block
+		blocks[working.ID] = &working
+	}
+	return nil, nil
+}
+
+// workingBlock returns a copy of the block as the operations prepared so
+// far leave it.
+func (s *BatchService) workingBlock(blockId int, blocks map[int]*model.EventBlock) (model.EventBlock, error) {
+	if block, ok := blocks[blockId]; ok {
+		if block == nil {
+			return model.EventBlock{}, fmt.Errorf("not found")
+		}
+		return *block, nil
+	}
+	block, err := s.repo.Events.GetOneBlock(blockId)
+	if err != nil {
+		return model.EventBlock{}, batchLookupError(err)
+	}
+	return block, nil
+}
+
+func batchLookupError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("not found")
+	}
+	return err
+}
+
+// findConflicts checks the blocks the batch writes, each conflict is also
+// added to the results of the operations that write the colliding block.
+// A block updated more than once is checked as its last update leaves it
+// and a conflict fails every update of it, blocks the batch deletes are
+// not checked. New blocks get temporary negative ids to be told apart,
+// they are cleared in the conflicts returned. The rooms stay locked until release is called, see
+// checkConflicts.
+func (s *BatchService) findConflicts(ops []model.BatchOperation, results []model.BatchResult, ignored []int) ([]model.BlockConflict, func(), error) {
+	var blocks []model.EventBlock
+	owners := make(map[int][]int)
+	positions := make(map[int]int)
+	deleted := make(map[int]bool, len(ignored))
+	for _, id := range ignored {
+		deleted[id] = true
+	}
+	add := func(block model.EventBlock, index int) {
+		if block.ID == 0 {
+			block.ID = -len(blocks) - 1
+		}
+		if deleted[block.ID] {
+			return
+		}
+		if ids := owners[block.ID]; len(ids) == 0 || ids[len(ids)-1] != index {
+			owners[block.ID] = append(ids, index)
+		}
+		if position, ok := positions[block.ID]; ok {
+			blocks[position] = block
+			return
+		}
+		positions[block.ID] = len(blocks)
+		blocks = append(blocks, block)
+	}
+	for i, op := range ops {
+		if results[i].Status == model.BatchFailed || op.Op == model.BatchDelete {
+			continue
+		}
+		switch {
+		case op.Type == model.BatchEvent && op.Op == model.BatchCreate:
+			for _, block := range op.Event.EventBlocks {
+				add(block, i)
+			}
+		case op.Type == model.BatchBlock:
+			add(*op.Block, i)
+		}
+	}
+	release, err := lockRooms(s.repo, blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflicts, err := findConflictsIgnoring(s.repo, blocks, ignored, s.location)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	for i := range conflicts {
+		indexes := owners[conflicts[i].Block.ID]
+		if conflicts[i].Block.ID < 0 {
+			conflicts[i].Block.ID = 0
+		}
+		if conflicts[i].ConflictsWith.ID < 0 {
+			conflicts[i].ConflictsWith.ID = 0
+		}
+		for _, index := range indexes {
+			results[index].Conflicts = append(results[index].Conflicts, conflicts[i])
+		}
+	}
+	return conflicts, release, nil
+}
+
+func (s *BatchService) publish(ops []model.BatchOperation, results []model.BatchResult) {
+	for i, op := range ops {
+		result := results[i]
+		if result.Status != model.BatchOK {
+			continue
+		}
+		switch op.Type + "." + op.Op {
+		case model.BatchEvent + "." + model.BatchCreate:
+			s.bus.Publish(model.ChangeEventCreated, result.ID, 0)
+		case model.BatchEvent + "." + model.BatchUpdate:
+			s.bus.Publish(model.ChangeEventUpdated, result.ID, 0)
+		case model.BatchEvent + "." + model.BatchDelete:
+			s.bus.Publish(model.ChangeEventDeleted, result.ID, 0)
+		case model.BatchBlock + "." + model.BatchCreate:
+			s.bus.Publish(model.ChangeBlockCreated, result.EventID, result.ID)
+		case model.BatchBlock + "." + model.BatchUpdate:
+			s.bus.Publish(model.ChangeBlockUpdated, result.EventID, result.ID)
+		case model.BatchBlock + "." + model.BatchDelete:
+			s.bus.Publish(model.ChangeBlockDeleted, result.EventID, result.ID)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+// storedBlocks serves GetOneBlock, the only read prepare makes for blocks.
+type storedBlocks struct {
+	repository.Events
+	blocks map[int]model.EventBlock
+}
+
+func (s storedBlocks) GetOneBlock(blockId int) (model.EventBlock, error) {
+	block, ok := s.blocks[blockId]
+	if !ok {
+		return model.EventBlock{}, sql.ErrNoRows
+	}
+	return block, nil
+}
+
+func newBatchTestService() *BatchService {
+	start := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	repo := &repository.Repository{Events: storedBlocks{blocks: map[int]model.EventBlock{
+		1: {ID: 1, EventID: 1, UID: "block-1@liceum", Name: "Round 1", StartDate: start, EndDate: start.Add(time.Hour)},
+	}}}
+	return NewBatchService(repo, nil, time.UTC)
+}
+
+func TestPrepareBuildsOnEarlierUpdates(t *testing.T) {
+	s := newBatchTestService()
+	moved := time.Date(2026, 9, 2, 9, 0, 0, 0, time.UTC)
+	capacity := 30
+	ops := []model.BatchOperation{
+		{Op: model.BatchUpdate, Type: model.BatchBlock, ID: 1, Changes: &model.BlockPatch{
+			Name:      "Round 1",
+			StartDate: &model.DateTime{Time: moved},
+			EndDate:   &model.DateTime{Time: moved.Add(time.Hour)},
+		}},
+		{Op: model.BatchUpdate, Type: model.BatchBlock, ID: 1, Changes: &model.BlockPatch{
+			Name:     "Round 1",
+			Capacity: &capacity,
+		}},
+	}
+	created := make(map[string]bool)
+	blocks := make(map[int]*model.EventBlock)
+	for i := range ops {
+		if _, err := s.prepare(&ops[i], created, blocks); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+	block := ops[1].Block
+	if !block.StartDate.Equal(moved) || !block.EndDate.Equal(moved.Add(time.Hour)) {
+		t.Errorf("second update lost the dates of the first: %v – %v", block.StartDate, block.EndDate)
+	}
+	if block.Capacity == nil || *block.Capacity != capacity {
+		t.Errorf("capacity = %v, want %d", block.Capacity, capacity)
+	}
+}
+
+func TestPrepareRejectsUpdateOfDeletedBlock(t *testing.T) {
+	s := newBatchTestService()
+	ops := []model.BatchOperation{
+		{Op: model.BatchDelete, Type: model.BatchBlock, ID: 1},
+		{Op: model.BatchUpdate, Type: model.BatchBlock, ID: 1, Changes: &model.BlockPatch{Name: "Round 1"}},
+	}
+	created := make(map[string]bool)
+	blocks := make(map[int]*model.EventBlock)
+	if _, err := s.prepare(&ops[0], created, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.prepare(&ops[1], created, blocks); err == nil || err.Error() != "not found" {
+		t.Errorf("got %v, want not found", err)
+	}
+}
+
+// bookedRoom serves the room reads of conflict checks: block 2 takes room
+// 5 at the time of booked.
+type bookedRoom struct {
+	repository.Rooms
+	booked model.EventBlock
+}
+
+func (r bookedRoom) GetRoomBlocks(roomIds []int, from time.Time, to time.Time) ([]model.EventBlock, error) {
+	return []model.EventBlock{r.booked}, nil
+}
+
+func (bookedRoom) LockRooms(roomIds []int) (func(), error) {
+	return func() {}, nil
+}
+
+type noHolidays struct{ repository.Academic }
+
+func (noHolidays) GetNonSchoolPeriods() ([]model.AcademicPeriod, error) {
+	return nil, nil
+}
+
+func TestFindConflictsFailsEveryUpdateOfBlock(t *testing.T) {
+	s := newBatchTestService()
+	start := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	room := 5
+	s.repo.Rooms = bookedRoom{booked: model.EventBlock{ID: 2, EventID: 2, Name: "Lecture", StartDate: start, EndDate: start.Add(time.Hour), LocationID: &room}}
+	s.repo.Academic = noHolidays{}
+	capacity := 30
+	ops := []model.BatchOperation{
+		{Op: model.BatchUpdate, Type: model.BatchBlock, ID: 1, Changes: &model.BlockPatch{Name: "Round 1", LocationID: &room}},
+		{Op: model.BatchUpdate, Type: model.BatchBlock, ID: 1, Changes: &model.BlockPatch{Name: "Round 1", Capacity: &capacity}},
+	}
+	created := make(map[string]bool)
+	blocks := make(map[int]*model.EventBlock)
+	for i := range ops {
+		if _, err := s.prepare(&ops[i], created, blocks); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+	results := make([]model.BatchResult, len(ops))
+	conflicts, release, err := s.findConflicts(ops, results, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+	for i, result := range results {
+		if len(result.Conflicts) != 1 {
+			t.Errorf("operation %d has %d conflicts, want 1", i, len(result.Conflicts))
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+type CalendarService struct {
+	repo     *repository.Repository
+	location *time.Location
+}
+
+func NewCalendarService(repo *repository.Repository, location *time.Location) *CalendarService {
+	return &CalendarService{
+		repo:     repo,
+		location: location,
+	}
+}
+
+func (s *CalendarService) EventsICS(loc *time.Location, locale string) (model.Feed, error) {
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return model.Feed{}, err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return model.Feed{}, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.renderCalendar(feedTextIn(locale).title, events, holidays, loc)
+}
+
+func (s *CalendarService) EventICS(eventId int, loc *time.Location, locale string) (model.Feed, error) {
+	event, err := s.repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	events := []model.Event{event}
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return model.Feed{}, err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return model.Feed{}, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.renderCalendar(events[0].Name, events, holidays, loc)
+}
+
+// SeriesICS exports the parent event of the series together with all of
+// its stages.
+func (s *CalendarService) SeriesICS(eventId int, loc *time.Location, locale string) (model.Feed, error) {
+	parent, children, err := loadSeries(s.repo, eventId)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	events := append([]model.Event{parent}, children...)
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return model.Feed{}, err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return model.Feed{}, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.renderCalendar(events[0].Name, events, holidays, loc)
+}
+
+// renderCalendar writes timed blocks as UTC instants and all-day blocks as
+// dates in the school's time zone. loc is only advertised to clients as
+// the calendar's display time zone.
+func (s *CalendarService) renderCalendar(name string, events []model.Event, holidays []model.AcademicPeriod, loc *time.Location) (model.Feed, error) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	for _, event := range events {
+		sort.Slice(event.EventBlocks, func(i, j int) bool {
+			return event.EventBlocks[i].ID < event.EventBlocks[j].ID
+		})
+	}
+	rooms, err := s.repo.Rooms.GetRooms()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	etag, err := calendarETag(name, events, holidays, rooms, loc)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	ctx := vEventContext{
+		stamp:  time.Now(),
+		school: s.location,
+		rooms:  make(map[int]string, len(rooms)),
+	}
+	for _, room := range rooms {
+		ctx.rooms[room.ID] = room.Name
+	}
+	w := newICalWriter(name, loc)
+	for _, event := range events {
+		for _, block := range event.EventBlocks {
+			writeBlockVEvent(w, ctx, event, block, holidayExdates(block, holidays, s.location))
+		}
+	}
+	return model.Feed{
+		Body:         w.bytes(),
+		ETag:         etag,
+		LastModified: feedLastModified(events).Truncate(time.Second),
+	}, nil
+}
+
+// vEventContext holds what every VEVENT of a calendar shares: the DTSTAMP,
+// the school's time zone for all-day blocks and room names for LOCATION.
+type vEventContext struct {
+	stamp  time.Time
+	school *time.Location
+	rooms  map[int]string
+}
+
+// writeBlockVEvent writes a block as a VEVENT. Recurring blocks carry their
+// RRULE, cancelled occurrences and skipped ones become EXDATEs and
+// overridden ones separate VEVENTs with a RECURRENCE-ID.
+func writeBlockVEvent(w *icalWriter, ctx vEventContext, event model.Event, block model.EventBlock, skipped []time.Time) {
+	format := func(t time.Time) string {
+		if block.AllDay {
+			return t.In(ctx.school).Format(icalDateFormat)
+		}
+		return t.UTC().Format(icalTimeFormat)
+	}
+	var exdates []string
+	for _, t := range skipped {
+		exdates = append(exdates, format(t))
+	}
+	for _, exception := range block.Exceptions {
+		if exception.Cancelled {
+			exdates = append(exdates, format(exception.RecurrenceID))
+		}
+	}
+	writeVEvent(w, ctx, event, block, func() {
+		w.prop("RRULE", block.RRule)
+		if block.AllDay {
+			w.prop("EXDATE;VALUE=DATE", strings.Join(exdates, ","))
+		} else {
+			w.prop("EXDATE", strings.Join(exdates, ","))
+		}
+	})
+	for _, exception := range block.Exceptions {
+		if exception.Cancelled {
+			continue
+		}
+		occurrence := block
+		occurrence.StartDate = exception.RecurrenceID.In(ctx.school)
+		occurrence.EndDate = occurrenceEnd(block, occurrence.StartDate)
+		applyException(&occurrence, exception)
+		writeVEvent(w, ctx, event, occurrence, func() {
+			if block.AllDay {
+				w.date("RECURRENCE-ID", exception.RecurrenceID, ctx.school)
+			} else {
+				w.time("RECURRENCE-ID", exception.RecurrenceID)
+			}
+		})
+	}
+}
+
+func writeVEvent(w *icalWriter, ctx vEventContext, event model.Event, block model.EventBlock, extra func()) {
+	description := block.Description
+	if description == "" {
+		description = event.Description
+	}
+	w.line("BEGIN:VEVENT")
+	w.prop("UID", block.UID)
+	w.time("DTSTAMP", ctx.stamp)
+	if block.AllDay {
+		w.date("DTSTART", block.StartDate, ctx.school)
+		w.date("DTEND", block.EndDate, ctx.school)
+	} else {
+		w.time("DTSTART", block.StartDate)
+		w.time("DTEND", block.EndDate)
+	}
+	extra()
+	w.text("SUMMARY", icalSummary(event.Name, block.Name))
+	w.text("DESCRIPTION", description)
+	if block.LocationID != nil {
+		w.text("LOCATION", ctx.rooms[*block.LocationID])
+	}
+	w.prop("URL", block.Link)
+	w.line("END:VEVENT")
+}
+
+func calendarETag(name string, events []model.Event, holidays []model.AcademicPeriod, rooms []model.Room, loc *time.Location) (string, error) {
+	data, err := json.Marshal([]interface{}{name, events, holidays, rooms, loc.String()})
+	if err != nil {
+		return "", err
+	}
+	return bodyETag(data), nil
+}
+
+func bodyETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+// ChangeBus passes event changes from the services that make them to the
+// ones that notify about them. Every subscriber gets the changes in the
+// order they were published, from a goroutine and queue of its own, so a
+// slow channel never holds up the request that made the change.
+type ChangeBus struct {
+	mu          sync.RWMutex
+	subscribers []*changeSubscriber
+}
+
+// changeSubscriber queues changes for fn until its goroutine takes them.
+type changeSubscriber struct {
+	fn    func(model.EventChange)
+	mu    sync.Mutex
+	queue []model.EventChange
+	wake  chan struct{}
+}
+
+func NewChangeBus() *ChangeBus {
+	return &ChangeBus{}
+}
+
+func (b *ChangeBus) Subscribe(fn func(model.EventChange)) {
+	sub := &changeSubscriber{fn: fn, wake: make(chan struct{}, 1)}
+	go sub.run()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, sub)
+}
+
+func (b *ChangeBus) Publish(kind string, eventId int, blockId int) {
+	change := model.EventChange{Kind: kind, EventID: eventId, BlockID: blockId, At: time.Now()}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscribers {
+		sub.push(change)
+	}
+}
+
+func (s *changeSubscriber) push(change model.EventChange) {
+	s.mu.Lock()
+	s.queue = append(s.queue, change)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *changeSubscriber) run() {
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			change := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			s.fn(change)
+		}
+	}
+}
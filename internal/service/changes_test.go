@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func TestChangeBusKeepsOrder(t *testing.T) {
+	bus := NewChangeBus()
+	const count = 200
+	got := make(chan int, count)
+	bus.Subscribe(func(change model.EventChange) {
+		got <- change.EventID
+	})
+	slow := make(chan int, count)
+	bus.Subscribe(func(change model.EventChange) {
+		time.Sleep(time.Microsecond)
+		slow <- change.EventID
+	})
+	for i := 0; i < count; i++ {
+		bus.Publish(model.ChangeEventUpdated, i, 0)
+	}
+	for _, ch := range []chan int{got, slow} {
+		for i := 0; i < count; i++ {
+			select {
+			case id := <-ch:
+				if id != i {
+					t.Fatalf("change %d arrived as %d", id, i)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("change %d never arrived", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+const channelEmail = "email"
+
+// Channel is a way to reach users. Linked reports whether the user can be
+// reached through it.
+type Channel interface {
+	Name() string
+	Linked(user model.User) bool
+	Send(user model.User, notification model.Notification) error
+}
+
+// EmailChannel reaches every user at their account email and adds an
+// unsubscribe link for the notification's kind.
+type EmailChannel struct {
+	mailer          *Mailer
+	unsubscribeLink string
+}
+
+func NewEmailChannel(mailer *Mailer, unsubscribeLink string) *EmailChannel {
+	return &EmailChannel{
+		mailer:          mailer,
+		unsubscribeLink: unsubscribeLink,
+	}
+}
+
+func (c *EmailChannel) Name() string {
+	return channelEmail
+}
+
+func (c *EmailChannel) Linked(user model.User) bool {
+	return user.Email != ""
+}
+
+func (c *EmailChannel) Send(user model.User, notification model.Notification) error {
+	link := fmt.Sprintf(c.unsubscribeLink, user.UnsubscribeToken) + "?kind=" + notification.Kind
+	return c.mailer.SendUnsubscribable(user.Email, notification.Subject, notification.Body, link)
+}
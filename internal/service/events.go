@@ -1,9 +1,12 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
-	"math/rand"
-	"net/smtp"
+	"math/big"
+	"net/mail"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -22,59 +25,154 @@ const (
 	refreshTTL = 15 * 24 * time.Hour
 )
 
+const authCodeTTL = 60 * time.Second
+
+// maxCodeAttempts is how many wrong guesses a code survives.
+const maxCodeAttempts = 5
+
+type storedCode struct {
+	code       string
+	expiration time.Time
+	data       interface{}
+	failures   int
+}
+
+// CodeStore keeps one-time email codes. Keys are emails for admin sign in
+// and prefixed keys for other confirmations.
 type CodeStore struct {
-	mu    sync.RWMutex
-	codes map[string][2]interface{}
+	mu    sync.Mutex
+	codes map[string]storedCode
 }
 
 func NewCodeStore() *CodeStore {
 	return &CodeStore{
-		codes: make(map[string][2]interface{}),
+		codes: make(map[string]storedCode),
 	}
 }
 
 func (cs *CodeStore) SetCode(userEmail string, code string) {
-	expiration := time.Now().Add(60 * time.Second)
+	cs.SetCodeWithData(userEmail, code, authCodeTTL, nil)
+}
+
+// SetCodeWithData stores a code together with data returned once the code
+// is confirmed. Expired codes are dropped on the way.
+func (cs *CodeStore) SetCodeWithData(key string, code string, ttl time.Duration, data interface{}) {
+	now := time.Now()
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	cs.codes[userEmail] = [2]interface{}{code, expiration}
+	for k, stored := range cs.codes {
+		if now.After(stored.expiration) {
+			delete(cs.codes, k)
+		}
+	}
+	cs.codes[key] = storedCode{code: code, expiration: now.Add(ttl), data: data}
 }
 
 func (cs *CodeStore) VerifyCode(userEmail string, code string) bool {
-	cs.mu.RLock()
-	defer cs.mu.RUnlock()
+	_, ok := cs.TakeCode(userEmail, code)
+	return ok
+}
 
-	data, exists := cs.codes[userEmail]
+// TakeCode checks a code and removes it once used, returning the data
+// stored with it. A code is also removed after maxCodeAttempts wrong
+// guesses, a new one has to be requested then.
+func (cs *CodeStore) TakeCode(key string, code string) (interface{}, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	stored, exists := cs.codes[key]
 	if !exists {
-		return false
+		return nil, false
+	}
+	if time.Now().After(stored.expiration) {
+		delete(cs.codes, key)
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.code), []byte(code)) != 1 {
+		stored.failures++
+		if stored.failures >= maxCodeAttempts {
+			delete(cs.codes, key)
+		} else {
+			cs.codes[key] = stored
+		}
+		return nil, false
+	}
+	delete(cs.codes, key)
+	return stored.data, true
+}
+
+// Sign in codes are limited per address, so nobody can flood a mailbox,
+// and per client address, so nobody can spray codes over many mailboxes.
+const (
+	authCodeWindow        = time.Hour
+	maxAuthCodesPerEmail  = 5
+	maxAuthCodesPerClient = 20
+)
+
+type sendCount struct {
+	sent  int
+	reset time.Time
+}
+
+// SendLimiter counts sends per key in fixed windows.
+type SendLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	counts map[string]sendCount
+}
+
+func NewSendLimiter(window time.Duration) *SendLimiter {
+	return &SendLimiter{
+		window: window,
+		counts: make(map[string]sendCount),
 	}
+}
 
-	storedCode := data[0].(string)
-	expiration := data[1].(time.Time)
-	if time.Now().After(expiration) {
-		delete(cs.codes, userEmail)
-		return false
+// Allow counts one send for every key and reports whether all of them are
+// still within their limits. Nothing is counted when one is not.
+func (l *SendLimiter) Allow(now time.Time, keys []string, limits []int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, count := range l.counts {
+		if now.After(count.reset) {
+			delete(l.counts, k)
+		}
+	}
+	for i, key := range keys {
+		if l.counts[key].sent >= limits[i] {
+			return false
+		}
 	}
-	return storedCode == code
+	for _, key := range keys {
+		count, ok := l.counts[key]
+		if !ok {
+			count = sendCount{reset: now.Add(l.window)}
+		}
+		count.sent++
+		l.counts[key] = count
+	}
+	return true
 }
 
 type EventsService struct {
-	repo      *repository.Repository
-	smtpAuth  smtp.Auth
-	gmail     string
-	smtpHost  string
-	smtpPort  string
-	codeStore *CodeStore
+	repo        *repository.Repository
+	mailer      *Mailer
+	codeStore   *CodeStore
+	bus         *ChangeBus
+	attachments *AttachmentsService
+	location    *time.Location
+	codeLimits  *SendLimiter
 }
 
-func NewEventsService(repo *repository.Repository, smtpAuth smtp.Auth, gmail string, smtpHost string, smtpPort string) *EventsService {
+func NewEventsService(repo *repository.Repository, mailer *Mailer, codeStore *CodeStore, bus *ChangeBus, attachments *AttachmentsService, location *time.Location) *EventsService {
 	return &EventsService{
-		repo:      repo,
-		smtpAuth:  smtpAuth,
-		gmail:     gmail,
-		smtpHost:  smtpHost,
-		smtpPort:  smtpPort,
-		codeStore: NewCodeStore(),
+		repo:        repo,
+		mailer:      mailer,
+		codeStore:   codeStore,
+		bus:         bus,
+		attachments: attachments,
+		location:    location,
+		codeLimits:  NewSendLimiter(authCodeWindow),
 	}
 }
 
@@ -90,16 +188,39 @@ func (s *EventsService) CheckIsAdmin(email string) bool {
 }
 
 func generateRandomCode() int {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return r.Intn(900000) + 100000
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		panic(err)
+	}
+	return int(n.Int64()) + 100000
+}
+
+// authCodeSubjects are the sign in emails by locale, the code is all they
+// say.
+var authCodeSubjects = map[string]string{
+	"ru": "Ваш код для входа в аккаунт: %s",
+	"en": "Your sign in code: %s",
 }
 
-func (s *EventsService) SendAuthCode(email string) error {
-	if !s.CheckIsAdmin(email) {
-		return fmt.Errorf("notadmin")
+// SendAuthCode emails a sign in code in the locale. Any address may sign
+// in, the account is created once the code is verified. ip is the
+// requesting client as the router resolves it, the proxy's X-Real-IP and
+// never a header the client sets. Sends are limited per email and per
+// client.
+func (s *EventsService) SendAuthCode(email string, ip string, locale string) error {
+	email = normalizeEmail(email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return fmt.Errorf("invalid email")
+	}
+	if !s.codeLimits.Allow(time.Now(), []string{"email:" + email, "ip:" + ip}, []int{maxAuthCodesPerEmail, maxAuthCodesPerClient}) {
+		return model.ErrTooManyCodes
+	}
+	subject, ok := authCodeSubjects[locale]
+	if !ok {
+		subject = authCodeSubjects[model.DefaultLocale]
 	}
 	code := strconv.Itoa(generateRandomCode())
-	if err := smtp.SendMail(s.smtpHost+":"+s.smtpPort, s.smtpAuth, s.gmail, []string{email}, []byte(fmt.Sprintf("Subject: Ваш код для входа в аккаунт: %s", code))); err != nil {
+	if err := s.mailer.Send(email, fmt.Sprintf(subject, code), ""); err != nil {
 		return err
 	}
 	s.codeStore.SetCode(email, code)
@@ -107,16 +228,39 @@ func (s *EventsService) SendAuthCode(email string) error {
 }
 
 func (s *EventsService) VerifyCode(code string, email string) (string, string, error) {
+	email = normalizeEmail(email)
 	if !s.codeStore.VerifyCode(email, code) {
 		return "", "", fmt.Errorf("wrongcode")
 	}
+	user, err := s.repo.Users.SignIn(email, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	return s.newTokens(user)
+}
+
+// userRole is the role put in tokens, admins get RoleAdmin whatever their
+// stored role is.
+func (s *EventsService) userRole(user model.User) string {
+	if s.CheckIsAdmin(user.Email) {
+		return model.RoleAdmin
+	}
+	return user.Role
+}
+
+func (s *EventsService) newTokens(user model.User) (string, string, error) {
+	role := s.userRole(user)
 	accessClaims := jwt.MapClaims{
-		"exp":   time.Now().Add(accessTTL).Unix(),
-		"email": email,
+		"exp":     time.Now().Add(accessTTL).Unix(),
+		"email":   user.Email,
+		"user_id": user.ID,
+		"role":    role,
 	}
 	refreshClaims := jwt.MapClaims{
-		"exp":   time.Now().Add(refreshTTL).Unix(),
-		"email": email,
+		"exp":     time.Now().Add(refreshTTL).Unix(),
+		"email":   user.Email,
+		"user_id": user.ID,
+		"role":    role,
 	}
 	accessToken, err := s.NewToken(accessClaims)
 	if err != nil {
@@ -145,6 +289,26 @@ func (s *EventsService) ParseToken(token string) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("expired token")
 }
 
+// ParseUser reads the holder of an access token. Tokens issued before
+// accounts existed carry only the email and get a zero UserID.
+func (s *EventsService) ParseUser(token string) (model.UserClaims, error) {
+	claims, err := s.ParseToken(token)
+	if err != nil {
+		return model.UserClaims{}, err
+	}
+	user := model.UserClaims{Email: fmt.Sprint(claims["email"])}
+	if id, ok := claims["user_id"].(float64); ok {
+		user.UserID = int(id)
+	}
+	if role, ok := claims["role"].(string); ok {
+		user.Role = role
+	}
+	if s.CheckIsAdmin(user.Email) {
+		user.Role = model.RoleAdmin
+	}
+	return user, nil
+}
+
 func (s *EventsService) NewToken(claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	stringToken, err := token.SignedString([]byte(tokenKey))
@@ -154,36 +318,226 @@ func (s *EventsService) NewToken(claims jwt.Claims) (string, error) {
 	return stringToken, nil
 }
 
-func (s *EventsService) CreateEvent(event model.Event) (int, error) {
-	return s.repo.Events.CreateEvent(event)
+func (s *EventsService) CreateEvent(event model.Event, opts model.SaveOptions) (int, error) {
+	if err := validateDescription(event.Description); err != nil {
+		return 0, err
+	}
+	if err := validateParent(s.repo, 0, event.ParentID); err != nil {
+		return 0, err
+	}
+	if err := prepareLabels(s.repo, &event, event.ParentID); err != nil {
+		return 0, err
+	}
+	if err := validateBlocks(event.EventBlocks, s.location); err != nil {
+		return 0, err
+	}
+	conflicts, release, err := checkConflicts(s.repo, event.EventBlocks, s.location, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	id, err := s.repo.Events.CreateEvent(event)
+	if err != nil {
+		return 0, err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceCreateEvent, map[string]interface{}{
+			"event_id":  id,
+			"conflicts": conflicts,
+		})
+	}
+	s.bus.Publish(model.ChangeEventCreated, id, 0)
+	return id, nil
 }
 
 func (s *EventsService) DeleteEvent(eventId int) error {
-	return s.repo.Events.DeleteEvent(eventId)
+	if err := s.repo.Events.DeleteEvent(eventId); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventDeleted, eventId, 0)
+	return nil
 }
 
-func (s *EventsService) CreateEventBlocks(blocks []model.EventBlock) error {
+func (s *EventsService) CreateEventBlocks(blocks []model.EventBlock, opts model.SaveOptions) error {
 	if len(blocks) == 0 {
 		return fmt.Errorf("blocks is empty")
 	}
+	if err := validateBlocks(blocks, s.location); err != nil {
+		return err
+	}
+	conflicts, release, err := checkConflicts(s.repo, blocks, s.location, opts)
+	if err != nil {
+		return err
+	}
+	defer release()
 	eventId := blocks[0].EventID
-	return s.repo.Events.CreateEventBlocks(blocks, eventId)
+	if err := s.repo.Events.CreateEventBlocks(blocks, eventId); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceCreateBlocks, map[string]interface{}{
+			"event_id":  eventId,
+			"conflicts": conflicts,
+		})
+	}
+	s.bus.Publish(model.ChangeBlockCreated, eventId, 0)
+	return nil
+}
+
+// validateBlocks checks block dates and normalizes recurrence rules in
+// place. All-day blocks are moved to midnight in loc, their end being the
+// start of the day after the last one.
+func validateBlocks(blocks []model.EventBlock, loc *time.Location) error {
+	for i := range blocks {
+		if blocks[i].AllDay {
+			start := model.DayIn(blocks[i].StartDate, loc)
+			end := model.DayIn(blocks[i].EndDate, loc)
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			blocks[i].StartDate = start
+			blocks[i].EndDate = end
+		}
+		if blocks[i].EndDate.Before(blocks[i].StartDate) {
+			return fmt.Errorf("block end_date is before start_date")
+		}
+		if err := validateDescription(blocks[i].Description); err != nil {
+			return err
+		}
+		if blocks[i].Capacity != nil && *blocks[i].Capacity <= 0 {
+			return fmt.Errorf("block capacity must be positive")
+		}
+		rrule, err := normalizeRRule(blocks[i].RRule)
+		if err != nil {
+			return fmt.Errorf("invalid rrule: %s", err.Error())
+		}
+		blocks[i].RRule = rrule
+	}
+	return nil
+}
+
+// sortBlocks puts blocks in display order, by position and then start.
+func sortBlocks(blocks []model.EventBlock) {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Position != blocks[j].Position {
+			return blocks[i].Position < blocks[j].Position
+		}
+		return blocks[i].StartDate.Before(blocks[j].StartDate)
+	})
+}
+
+// validateDescription limits the Markdown source, descriptions are
+// rendered to HTML for reads.
+func validateDescription(description string) error {
+	if len(description) > model.MaxDescriptionLength {
+		return fmt.Errorf("description is longer than %d characters", model.MaxDescriptionLength)
+	}
+	return nil
 }
 
 func (s *EventsService) DeleteEventBlock(blockId int) error {
-	return s.repo.Events.DeleteEventBlock(blockId)
+	block, lookupErr := s.repo.Events.GetOneBlock(blockId)
+	if err := s.repo.Events.DeleteEventBlock(blockId); err != nil {
+		return err
+	}
+	if lookupErr == nil {
+		s.bus.Publish(model.ChangeBlockDeleted, block.EventID, blockId)
+	}
+	return nil
 }
 
 func (s *EventsService) EditEventInfo(event model.Event) error {
-	return s.repo.Events.EditEventInfo(event)
+	if err := validateDescription(event.Description); err != nil {
+		return err
+	}
+	stored, err := s.repo.Events.GetOneEvent(event.ID)
+	if err != nil {
+		return err
+	}
+	if err := prepareLabels(s.repo, &event, stored.ParentID); err != nil {
+		return err
+	}
+	if err := s.repo.Events.EditEventInfo(event); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, event.ID, 0)
+	return nil
 }
 
-func (s *EventsService) EditBlockInfo(block model.EventBlock) error {
-	return s.repo.Events.EditBlockInfo(block)
+func (s *EventsService) EditBlockInfo(block model.EventBlock, opts model.SaveOptions) error {
+	blocks := []model.EventBlock{block}
+	if err := validateBlocks(blocks, s.location); err != nil {
+		return err
+	}
+	conflicts, release, err := checkConflicts(s.repo, blocks, s.location, opts)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := s.repo.Events.EditBlockInfo(blocks[0]); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceEditBlock, map[string]interface{}{
+			"block_id":  block.ID,
+			"conflicts": conflicts,
+		})
+	}
+	if stored, err := s.repo.Events.GetOneBlock(block.ID); err == nil {
+		s.bus.Publish(model.ChangeBlockUpdated, stored.EventID, block.ID)
+	}
+	return nil
 }
 
+// GetCurrentEvents returns events with a single block or an occurrence of a
+// recurring block in progress.
 func (s *EventsService) GetCurrentEvents() ([]model.Event, error) {
-	return s.repo.Events.GetCurrentEvents()
+	events, err := s.repo.Events.GetCurrentEvents()
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := s.repo.Recurrence.GetRecurringBlocks()
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		if err := s.attachments.attachTo(events); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+	recurring := []model.Event{{EventBlocks: blocks}}
+	if err := attachExceptions(s.repo, recurring); err != nil {
+		return nil, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	seen := make(map[int]bool, len(events))
+	for _, event := range events {
+		seen[event.ID] = true
+	}
+	var current []int
+	for _, block := range recurring[0].EventBlocks {
+		if seen[block.EventID] || len(expandBlock(block, holidays, s.location, now, now.Add(time.Second))) == 0 {
+			continue
+		}
+		seen[block.EventID] = true
+		current = append(current, block.EventID)
+	}
+	if len(current) > 0 {
+		recurringEvents, err := s.repo.Events.GetEvents(current)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, recurringEvents...)
+	}
+	if err := s.attachments.attachTo(events); err != nil {
+		return nil, err
+	}
+	return events, nil
 }
 
 func (s *EventsService) GetAllEvents() ([]model.Event, error) {
@@ -194,37 +548,79 @@ func (s *EventsService) GetAllEvents() ([]model.Event, error) {
 			logrus.Errorf("CLEAN EVENTS ERROR: %s", err.Error())
 		}
 	}
-	return s.repo.Events.GetAllEvents()
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return nil, err
+	}
+	if err := s.attachments.attachTo(events); err != nil {
+		return nil, err
+	}
+	return events, nil
 }
 
 func (s *EventsService) GetOneEvent(eventId int) (model.Event, error) {
-	return s.repo.Events.GetOneEvent(eventId)
+	event, err := s.repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return model.Event{}, err
+	}
+	events := []model.Event{event}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return model.Event{}, err
+	}
+	if err := s.attachments.attachTo(events); err != nil {
+		return model.Event{}, err
+	}
+	return events[0], nil
+}
+
+// SetBlockOrder puts the blocks of the event in the order of blockIds,
+// which must list each of them once.
+func (s *EventsService) SetBlockOrder(eventId int, blockIds []int) error {
+	event, err := s.repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return err
+	}
+	listed := make(map[int]bool, len(blockIds))
+	for _, id := range blockIds {
+		listed[id] = true
+	}
+	if len(listed) != len(blockIds) || len(blockIds) != len(event.EventBlocks) {
+		return fmt.Errorf("block_ids must list every block of the event once")
+	}
+	for _, block := range event.EventBlocks {
+		if !listed[block.ID] {
+			return fmt.Errorf("block_ids must list every block of the event once")
+		}
+	}
+	if err := s.repo.Events.SetBlockOrder(eventId, blockIds); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, eventId, 0)
+	return nil
 }
 
 func (s *EventsService) GetOneBlock(blockId int) (model.EventBlock, error) {
 	return s.repo.Events.GetOneBlock(blockId)
 }
 
+// RefreshToken reads the account again, so role changes apply from the
+// next refresh.
 func (s *EventsService) RefreshToken(refreshToken string) (string, string, error) {
-	parsedToken, err := s.ParseToken(refreshToken)
+	claims, err := s.ParseUser(refreshToken)
 	if err != nil {
 		return "", "", err
 	}
-	accessClaims := jwt.MapClaims{
-		"exp":   time.Now().Add(accessTTL).Unix(),
-		"email": parsedToken["email"],
+	var user model.User
+	if claims.UserID != 0 {
+		user, err = s.repo.Users.GetUser(claims.UserID)
+	} else {
+		user, err = s.repo.Users.SignIn(normalizeEmail(claims.Email), time.Now())
 	}
-	refreshClaims := jwt.MapClaims{
-		"exp":   time.Now().Add(refreshTTL).Unix(),
-		"email": parsedToken["email"],
-	}
-	accessToken, err := s.NewToken(accessClaims)
 	if err != nil {
 		return "", "", err
 	}
-	refreshToken, err = s.NewToken(refreshClaims)
-	if err != nil {
-		return "", "", err
-	}
-	return accessToken, refreshToken, nil
+	return s.newTokens(user)
 }
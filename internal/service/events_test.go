@@ -0,0 +1,77 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCodeStoreTakesCodeOnce(t *testing.T) {
+	cs := NewCodeStore()
+	cs.SetCodeWithData("key", "123456", time.Minute, "data")
+	data, ok := cs.TakeCode("key", "123456")
+	if !ok || data != "data" {
+		t.Fatalf("got %v, %v", data, ok)
+	}
+	if _, ok := cs.TakeCode("key", "123456"); ok {
+		t.Fatal("code was accepted twice")
+	}
+}
+
+func TestCodeStoreDropsCodeAfterFailedAttempts(t *testing.T) {
+	cs := NewCodeStore()
+	cs.SetCodeWithData("key", "123456", time.Minute, nil)
+	for i := 0; i < maxCodeAttempts-1; i++ {
+		if _, ok := cs.TakeCode("key", strconv.Itoa(100000+i)); ok {
+			t.Fatal("wrong code was accepted")
+		}
+	}
+	if _, ok := cs.TakeCode("key", "123456"); !ok {
+		t.Fatal("code was dropped before the attempts ran out")
+	}
+
+	cs.SetCodeWithData("key", "123456", time.Minute, nil)
+	for i := 0; i < maxCodeAttempts; i++ {
+		cs.TakeCode("key", strconv.Itoa(100000+i))
+	}
+	if _, ok := cs.TakeCode("key", "123456"); ok {
+		t.Fatal("code survived too many wrong guesses")
+	}
+}
+
+func TestCodeStoreExpires(t *testing.T) {
+	cs := NewCodeStore()
+	cs.SetCodeWithData("key", "123456", -time.Second, nil)
+	if _, ok := cs.TakeCode("key", "123456"); ok {
+		t.Fatal("expired code was accepted")
+	}
+}
+
+func TestGenerateRandomCodeHasSixDigits(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if code := generateRandomCode(); code < 100000 || code > 999999 {
+			t.Fatalf("code %d is not six digits long", code)
+		}
+	}
+}
+
+func TestSendLimiter(t *testing.T) {
+	l := NewSendLimiter(time.Hour)
+	now := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	limits := []int{2, 3}
+	if !l.Allow(now, []string{"email:a", "ip:1"}, limits) || !l.Allow(now, []string{"email:a", "ip:1"}, limits) {
+		t.Fatal("first sends were refused")
+	}
+	if l.Allow(now, []string{"email:a", "ip:2"}, limits) {
+		t.Fatal("third send to the same email was allowed")
+	}
+	if !l.Allow(now, []string{"email:b", "ip:1"}, limits) {
+		t.Fatal("send to another email was refused")
+	}
+	if l.Allow(now, []string{"email:c", "ip:1"}, limits) {
+		t.Fatal("fourth send from the same client was allowed")
+	}
+	if !l.Allow(now.Add(time.Hour+time.Second), []string{"email:a", "ip:1"}, limits) {
+		t.Fatal("send after the window was refused")
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+const (
+	feedDateLayout   = "02.01.2006 15:04"
+	feedDayLayout    = "02.01.2006"
+	defaultFeedLimit = 50
+)
+
+// feedText holds the titles of calendars and feeds in a locale.
+type feedText struct {
+	title       string
+	description string
+	stages      string
+	schedule    string
+}
+
+var feedTexts = map[string]feedText{
+	"ru": {
+		title:       "Лицей: мероприятия",
+		description: "Новые и обновлённые мероприятия лицея",
+		stages:      "Этапы: %s",
+		schedule:    "Лицей: моё расписание",
+	},
+	"en": {
+		title:       "Lyceum: events",
+		description: "New and updated events of the lyceum",
+		stages:      "Stages: %s",
+		schedule:    "Lyceum: my schedule",
+	},
+}
+
+func feedTextIn(locale string) feedText {
+	if text, ok := feedTexts[locale]; ok {
+		return text
+	}
+	return feedTexts[model.DefaultLocale]
+}
+
+type FeedService struct {
+	repo      *repository.Repository
+	siteURL   string
+	eventLink string
+	location  *time.Location
+}
+
+func NewFeedService(repo *repository.Repository, siteURL string, eventLink string, location *time.Location) *FeedService {
+	return &FeedService{
+		repo:      repo,
+		siteURL:   siteURL,
+		eventLink: eventLink,
+		location:  location,
+	}
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Summary   atomSummary `xml:"summary"`
+}
+
+type atomSummary struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (s *FeedService) RSS(limit int, loc *time.Location, locale string) (model.Feed, error) {
+	events, err := s.recentEvents(limit, locale)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	text := feedTextIn(locale)
+	return s.renderRSS(text.title, s.siteURL, text.description, events, loc)
+}
+
+func (s *FeedService) Atom(limit int, loc *time.Location, locale string) (model.Feed, error) {
+	events, err := s.recentEvents(limit, locale)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.renderAtom(feedTextIn(locale).title, s.siteURL+"/", s.siteURL, events, loc)
+}
+
+// SeriesRSS lists the parent event of the series followed by its stages
+// in the order they take place.
+func (s *FeedService) SeriesRSS(eventId int, loc *time.Location, locale string) (model.Feed, error) {
+	events, err := s.seriesEvents(eventId, locale)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	description := fmt.Sprintf(feedTextIn(locale).stages, events[0].Name)
+	return s.renderRSS(events[0].Name, s.link(events[0]), description, events, loc)
+}
+
+func (s *FeedService) SeriesAtom(eventId int, loc *time.Location, locale string) (model.Feed, error) {
+	events, err := s.seriesEvents(eventId, locale)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.renderAtom(events[0].Name, s.entryID(events[0])+"/series", s.link(events[0]), events, loc)
+}
+
+func (s *FeedService) renderRSS(title string, link string, description string, events []model.Event, loc *time.Location) (model.Feed, error) {
+	lastModified := feedLastModified(events)
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        link,
+			Description: description,
+			Items:       make([]rssItem, 0, len(events)),
+		},
+	}
+	if !lastModified.IsZero() {
+		feed.Channel.LastBuildDate = lastModified.UTC().Format(time.RFC1123Z)
+	}
+	for _, event := range events {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       event.Name,
+			Link:        s.link(event),
+			Description: summariseEvent(event.Localize(loc, s.location)),
+			GUID:        rssGUID{Value: s.entryID(event)},
+			PubDate:     event.LastModified().UTC().Format(time.RFC1123Z),
+		})
+	}
+	return encodeFeed(feed, lastModified)
+}
+
+func (s *FeedService) renderAtom(title string, id string, link string, events []model.Event, loc *time.Location) (model.Feed, error) {
+	lastModified := feedLastModified(events)
+	feed := atomFeed{
+		Title:   title,
+		ID:      id,
+		Updated: lastModified.UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: link},
+		Entries: make([]atomEntry, 0, len(events)),
+	}
+	for _, event := range events {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     event.Name,
+			ID:        s.entryID(event),
+			Link:      atomLink{Href: s.link(event)},
+			Published: event.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   event.LastModified().UTC().Format(time.RFC3339),
+			Summary:   atomSummary{Type: "text", Value: summariseEvent(event.Localize(loc, s.location))},
+		})
+	}
+	return encodeFeed(feed, lastModified)
+}
+
+// seriesEvents returns the parent of the series first, then its stages.
+func (s *FeedService) seriesEvents(eventId int, locale string) ([]model.Event, error) {
+	parent, children, err := loadSeries(s.repo, eventId)
+	if err != nil {
+		return nil, err
+	}
+	events := append([]model.Event{parent}, children...)
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		sortBlocks(event.EventBlocks)
+	}
+	return events, nil
+}
+
+// recentEvents returns events ordered by their latest change, newest first.
+func (s *FeedService) recentEvents(limit int, locale string) ([]model.Event, error) {
+	if limit <= 0 {
+		limit = defaultFeedLimit
+	}
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastModified().After(events[j].LastModified())
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		sortBlocks(event.EventBlocks)
+	}
+	return events, nil
+}
+
+func (s *FeedService) link(event model.Event) string {
+	return fmt.Sprintf(s.eventLink, event.ID)
+}
+
+func (s *FeedService) entryID(event model.Event) string {
+	return fmt.Sprintf("%s/events/%d", s.siteURL, event.ID)
+}
+
+func summariseEvent(event model.Event) string {
+	lines := make([]string, 0, len(event.EventBlocks)+1)
+	if event.Description != "" {
+		lines = append(lines, event.Description)
+	}
+	for _, block := range event.EventBlocks {
+		if block.AllDay {
+			lines = append(lines, fmt.Sprintf("%s: %s – %s", block.Name, block.StartDate.Format(feedDayLayout), block.EndDate.Add(-time.Nanosecond).Format(feedDayLayout)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s – %s", block.Name, block.StartDate.Format(feedDateLayout), block.EndDate.Format(feedDateLayout)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func feedLastModified(events []model.Event) time.Time {
+	var last time.Time
+	for _, event := range events {
+		if modified := event.LastModified(); modified.After(last) {
+			last = modified
+		}
+	}
+	return last
+}
+
+func encodeFeed(feed interface{}, lastModified time.Time) (model.Feed, error) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return model.Feed{}, err
+	}
+	body = append([]byte(xml.Header), body...)
+	return model.Feed{
+		Body:         body,
+		ETag:         bodyETag(body),
+		LastModified: lastModified.Truncate(time.Second),
+	}, nil
+}
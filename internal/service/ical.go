@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	icalProdID     = "-//it9tech.ru//liceum_backend//RU"
+	icalTimeFormat = "20060102T150405Z"
+	icalDateFormat = "20060102"
+	icalLineLimit  = 75
+)
+
+type icalWriter struct {
+	buf bytes.Buffer
+}
+
+func newICalWriter(name string, loc *time.Location) *icalWriter {
+	w := &icalWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + icalProdID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	if name != "" {
+		w.line("X-WR-CALNAME:" + icalEscape(name))
+	}
+	if loc != nil {
+		w.line("X-WR-TIMEZONE:" + loc.String())
+	}
+	return w
+}
+
+func (w *icalWriter) line(s string) {
+	limit := icalLineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		limit = icalLineLimit - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+func (w *icalWriter) prop(name string, value string) {
+	if value == "" {
+		return
+	}
+	w.line(name + ":" + value)
+}
+
+func (w *icalWriter) text(name string, value string) {
+	w.prop(name, icalEscape(value))
+}
+
+func (w *icalWriter) time(name string, value time.Time) {
+	w.prop(name, value.UTC().Format(icalTimeFormat))
+}
+
+// date writes a VALUE=DATE property for the day of value in loc.
+func (w *icalWriter) date(name string, value time.Time, loc *time.Location) {
+	w.line(name + ";VALUE=DATE:" + value.In(loc).Format(icalDateFormat))
+}
+
+func (w *icalWriter) bytes() []byte {
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var icalEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func icalEscape(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+func icalSummary(eventName string, blockName string) string {
+	if blockName == "" || blockName == eventName {
+		return eventName
+	}
+	return fmt.Sprintf("%s: %s", eventName, blockName)
+}
+
+type icalProp struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+type icalComponent struct {
+	Name  string
+	Props []icalProp
+}
+
+func (c icalComponent) get(name string) (icalProp, bool) {
+	for _, prop := range c.Props {
+		if prop.Name == name {
+			return prop, true
+		}
+	}
+	return icalProp{}, false
+}
+
+func (c icalComponent) text(name string) string {
+	prop, ok := c.get(name)
+	if !ok {
+		return ""
+	}
+	return icalUnescape(prop.Value)
+}
+
+func unfoldICal(data []byte) []string {
+	raw := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	lines := make([]string, 0, len(raw))
+	for _, l := range raw {
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func parseICalProp(l string) (icalProp, error) {
+	inQuotes := false
+	colon := -1
+	for i, r := range l {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+		if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icalProp{}, fmt.Errorf("invalid line: %s", l)
+	}
+	head := strings.Split(l[:colon], ";")
+	prop := icalProp{
+		Name:   strings.ToUpper(head[0]),
+		Params: make(map[string]string),
+		Value:  l[colon+1:],
+	}
+	for _, param := range head[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseICalEvents returns every VEVENT of the calendar with its properties,
+// nested components such as VALARM are skipped.
+func parseICalEvents(data []byte) ([]icalComponent, error) {
+	var (
+		events  []icalComponent
+		current *icalComponent
+		depth   int
+	)
+	for _, l := range unfoldICal(data) {
+		prop, err := parseICalProp(l)
+		if err != nil {
+			return nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			if strings.EqualFold(prop.Value, "VEVENT") && current == nil {
+				current = &icalComponent{Name: "VEVENT"}
+				depth = 0
+				continue
+			}
+			if current != nil {
+				depth++
+			}
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			events = append(events, *current)
+			current = nil
+		default:
+			if current != nil && depth == 0 {
+				current.Props = append(current.Props, prop)
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated VEVENT")
+	}
+	return events, nil
+}
+
+var icalUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\;`, ";",
+	`\,`, ",",
+	`\n`, "\n",
+	`\N`, "\n",
+)
+
+func icalUnescape(s string) string {
+	return icalUnescaper.Replace(s)
+}
+
+// parseICalTime understands UTC, floating and TZID date-times as well as
+// VALUE=DATE values. Floating times are read in the given location.
+func parseICalTime(prop icalProp, loc *time.Location) (time.Time, bool, error) {
+	value := prop.Value
+	if tzid, ok := prop.Params["TZID"]; ok {
+		tz, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown TZID %s", tzid)
+		}
+		loc = tz
+	}
+	if prop.Params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation(icalDateFormat, value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icalTimeFormat, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseICalDuration supports the week, day, hour, minute and second
+// designators of RFC 5545 durations.
+func parseICalDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(value, "+")
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	s = s[1:]
+	var (
+		total  time.Duration
+		number int
+		digits bool
+	)
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			number = number*10 + int(r-'0')
+			digits = true
+			continue
+		case r == 'T':
+			continue
+		}
+		if !digits {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		switch r {
+		case 'W':
+			total += time.Duration(number) * 7 * 24 * time.Hour
+		case 'D':
+			total += time.Duration(number) * 24 * time.Hour
+		case 'H':
+			total += time.Duration(number) * time.Hour
+		case 'M':
+			total += time.Duration(number) * time.Minute
+		case 'S':
+			total += time.Duration(number) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		number = 0
+		digits = false
+	}
+	return sign * total, nil
+}
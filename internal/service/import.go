@@ -0,0 +1,224 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+type ImportService struct {
+	repo     *repository.Repository
+	bus      *ChangeBus
+	location *time.Location
+}
+
+func NewImportService(repo *repository.Repository, bus *ChangeBus, location *time.Location) *ImportService {
+	return &ImportService{
+		repo:     repo,
+		bus:      bus,
+		location: location,
+	}
+}
+
+func (s *ImportService) ImportICS(data []byte, target model.ImportTarget, dryRun bool, opts model.SaveOptions) (model.ImportReport, error) {
+	vevents, err := parseICalEvents(data)
+	if err != nil {
+		return model.ImportReport{}, &model.ImportError{Err: err}
+	}
+	if len(vevents) == 0 {
+		return model.ImportReport{}, invalidImport("calendar has no events")
+	}
+	blocks := make([]model.ImportBlock, 0, len(vevents))
+	for i, vevent := range vevents {
+		// Overridden occurrences of a series share its UID and would
+		// overwrite the series block.
+		if _, ok := vevent.get("RECURRENCE-ID"); ok {
+			continue
+		}
+		item, err := importBlockFromVEvent(vevent, target, s.location)
+		if err == nil {
+			err = validateImportDescriptions(item)
+		}
+		if err != nil {
+			return model.ImportReport{}, invalidImport("event %d: %s", i+1, err.Error())
+		}
+		blocks = append(blocks, item)
+	}
+	return s.importBlocks(blocks, dryRun, opts)
+}
+
+// importBlocks writes the blocks after checking them for room conflicts.
+// Imported files carry no rooms, so only blocks matched by UID to a stored
+// block with a room can collide, they keep that room.
+func (s *ImportService) importBlocks(blocks []model.ImportBlock, dryRun bool, opts model.SaveOptions) (model.ImportReport, error) {
+	var uids []string
+	for _, item := range blocks {
+		if item.Block != nil && item.Block.UID != "" {
+			uids = append(uids, item.Block.UID)
+		}
+	}
+	var booked []model.EventBlock
+	if len(uids) > 0 {
+		stored, err := s.repo.Events.GetBlocksByUID(uids)
+		if err != nil {
+			return model.ImportReport{}, err
+		}
+		byUID := make(map[string]model.EventBlock, len(stored))
+		for _, block := range stored {
+			byUID[block.UID] = block
+		}
+		for _, item := range blocks {
+			if item.Block == nil {
+				continue
+			}
+			stored, ok := byUID[item.Block.UID]
+			if !ok || stored.LocationID == nil {
+				continue
+			}
+			block := *item.Block
+			block.ID = stored.ID
+			block.LocationID = stored.LocationID
+			if item.KeepRRule {
+				block.RRule = stored.RRule
+			}
+			booked = append(booked, block)
+		}
+	}
+	conflicts, release, err := checkConflicts(s.repo, booked, s.location, opts)
+	if err != nil {
+		return model.ImportReport{}, err
+	}
+	defer release()
+	report, err := s.repo.Import.ImportBlocks(blocks, dryRun)
+	if err != nil {
+		return model.ImportReport{}, err
+	}
+	if dryRun {
+		return report, nil
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceImport, map[string]interface{}{
+			"conflicts": conflicts,
+		})
+	}
+	s.publish(report)
+	return report, nil
+}
+
+// publish announces the events and blocks an import wrote. A created event
+// is announced once, its blocks are part of it.
+func (s *ImportService) publish(report model.ImportReport) {
+	announced := make(map[int]bool)
+	for _, result := range report.Results {
+		if result.EventCreated {
+			if !announced[result.EventID] {
+				announced[result.EventID] = true
+				s.bus.Publish(model.ChangeEventCreated, result.EventID, 0)
+			}
+			continue
+		}
+		switch result.Action {
+		case model.ImportCreated:
+			s.bus.Publish(model.ChangeBlockCreated, result.EventID, result.BlockID)
+		case model.ImportUpdated:
+			s.bus.Publish(model.ChangeBlockUpdated, result.EventID, result.BlockID)
+		default:
+			if !announced[result.EventID] {
+				announced[result.EventID] = true
+				s.bus.Publish(model.ChangeEventUpdated, result.EventID, 0)
+			}
+		}
+	}
+}
+
+// validateImportDescriptions applies the limits of the editor to imported
+// descriptions.
+func validateImportDescriptions(item model.ImportBlock) error {
+	if err := validateDescription(item.EventDescription); err != nil {
+		return fmt.Errorf("event %s", err.Error())
+	}
+	if item.Block != nil {
+		if err := validateDescription(item.Block.Description); err != nil {
+			return fmt.Errorf("block %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func invalidImport(format string, args ...interface{}) error {
+	return &model.ImportError{Err: fmt.Errorf(format, args...)}
+}
+
+// importBlockFromVEvent reads floating times and VALUE=DATE days in loc, the
+// school's time zone.
+func importBlockFromVEvent(vevent icalComponent, target model.ImportTarget, loc *time.Location) (model.ImportBlock, error) {
+	startProp, ok := vevent.get("DTSTART")
+	if !ok {
+		return model.ImportBlock{}, fmt.Errorf("DTSTART is missing")
+	}
+	start, allDay, err := parseICalTime(startProp, loc)
+	if err != nil {
+		return model.ImportBlock{}, fmt.Errorf("invalid DTSTART: %s", err.Error())
+	}
+	end := start
+	if endProp, ok := vevent.get("DTEND"); ok {
+		if end, _, err = parseICalTime(endProp, loc); err != nil {
+			return model.ImportBlock{}, fmt.Errorf("invalid DTEND: %s", err.Error())
+		}
+	} else if durationProp, ok := vevent.get("DURATION"); ok {
+		duration, err := parseICalDuration(durationProp.Value)
+		if err != nil {
+			return model.ImportBlock{}, err
+		}
+		end = start.Add(duration)
+	} else if allDay {
+		end = start.AddDate(0, 0, 1)
+	}
+	if end.Before(start) {
+		return model.ImportBlock{}, fmt.Errorf("DTEND is before DTSTART")
+	}
+
+	rrule := ""
+	if ruleProp, ok := vevent.get("RRULE"); ok {
+		if rrule, err = normalizeRRule(ruleProp.Value); err != nil {
+			return model.ImportBlock{}, fmt.Errorf("invalid RRULE: %s", err.Error())
+		}
+	}
+
+	summary := strings.TrimSpace(vevent.text("SUMMARY"))
+	eventName, blockName := target.EventName, summary
+	if target.EventID == 0 && eventName == "" {
+		eventName, blockName = splitICalSummary(summary)
+	}
+	if target.EventID == 0 && eventName == "" {
+		return model.ImportBlock{}, fmt.Errorf("SUMMARY is missing")
+	}
+	return model.ImportBlock{
+		EventID:          target.EventID,
+		EventName:        eventName,
+		EventDescription: target.EventDescription,
+		Block: &model.EventBlock{
+			UID:         vevent.text("UID"),
+			Name:        blockName,
+			Description: vevent.text("DESCRIPTION"),
+			StartDate:   start,
+			EndDate:     end,
+			AllDay:      allDay,
+			Link:        vevent.text("URL"),
+			RRule:       rrule,
+		},
+	}, nil
+}
+
+// splitICalSummary reverses icalSummary, so feeds exported by this service
+// are imported back into the same events.
+func splitICalSummary(summary string) (string, string) {
+	eventName, blockName, ok := strings.Cut(summary, ": ")
+	if !ok {
+		return summary, summary
+	}
+	return eventName, blockName
+}
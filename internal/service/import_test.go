@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func TestImportSpreadsheetLimitsDescriptions(t *testing.T) {
+	s := &ImportService{location: time.UTC}
+	long := strings.Repeat("a", model.MaxDescriptionLength+1)
+	data := "event_name,event_description,block_name,block_description,start_date,end_date\n" +
+		"Olympiad," + long + ",,,,\n" +
+		"Olympiad,,Round 1," + long + ",2026-09-01 09:00,2026-09-01 10:00\n"
+	report, err := s.ImportSpreadsheet([]byte(data), FormatCSV, true, model.SaveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Row != 2 || report.Errors[1].Row != 3 {
+		t.Fatalf("errors %+v", report.Errors)
+	}
+	if !strings.HasPrefix(report.Errors[0].Error, "event description") || !strings.HasPrefix(report.Errors[1].Error, "block description") {
+		t.Errorf("errors %+v", report.Errors)
+	}
+}
+
+func TestImportICSLimitsDescriptions(t *testing.T) {
+	s := &ImportService{location: time.UTC}
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:a@b\r\nDTSTART:20260901T090000Z\r\nDTEND:20260901T100000Z\r\nSUMMARY:Round 1\r\n" +
+		"DESCRIPTION:" + strings.Repeat("a", model.MaxDescriptionLength+1) + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	_, err := s.ImportICS([]byte(data), model.ImportTarget{EventName: "Olympiad"}, true, model.SaveOptions{})
+	var importErr *model.ImportError
+	if !errors.As(err, &importErr) || !strings.Contains(err.Error(), "description is longer") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestImportBlockFromRowReadsRRule(t *testing.T) {
+	row := map[string]string{
+		"event_name": "Chess club",
+		"block_name": "Lesson",
+		"start_date": "2026-09-01 15:00",
+		"end_date":   "2026-09-01 16:00",
+		"rrule":      "FREQ=WEEKLY;BYDAY=TU",
+	}
+	cell := func(name string) string { return row[name] }
+	item, err := importBlockFromRow(cell, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := normalizeRRule(row["rrule"])
+	if item.Block.RRule == "" || item.Block.RRule != want {
+		t.Errorf("rrule %q, want %q", item.Block.RRule, want)
+	}
+	row["rrule"] = "FREQ=SOMETIMES"
+	if _, err := importBlockFromRow(cell, time.UTC); err == nil || !strings.HasPrefix(err.Error(), "rrule") {
+		t.Errorf("invalid rule: got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails through the configured SMTP server.
+type Mailer struct {
+	auth smtp.Auth
+	from string
+	host string
+	port string
+}
+
+func NewMailer(auth smtp.Auth, from string, host string, port string) *Mailer {
+	return &Mailer{
+		auth: auth,
+		from: from,
+		host: host,
+		port: port,
+	}
+}
+
+func (m *Mailer) Send(to string, subject string, body string) error {
+	return m.send(to, subject, body, nil)
+}
+
+// SendUnsubscribable adds a List-Unsubscribe header, so mail clients offer
+// their own unsubscribe button, and the link at the end of the body.
+func (m *Mailer) SendUnsubscribable(to string, subject string, body string, unsubscribeLink string) error {
+	body = fmt.Sprintf("%s\n\n--\nОтписаться от этих писем: %s", body, unsubscribeLink)
+	return m.send(to, subject, body, map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeLink + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	})
+}
+
+func (m *Mailer) send(to string, subject string, body string, headers map[string]string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	for name, value := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(m.host+":"+m.port, m.auth, m.from, []string{to}, []byte(msg.String()))
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+const (
+	defaultUpcomingDays = 14
+	maxUpcomingDays     = 366
+)
+
+type RecurrenceService struct {
+	repo     *repository.Repository
+	bus      *ChangeBus
+	location *time.Location
+}
+
+func NewRecurrenceService(repo *repository.Repository, bus *ChangeBus, location *time.Location) *RecurrenceService {
+	return &RecurrenceService{
+		repo:     repo,
+		bus:      bus,
+		location: location,
+	}
+}
+
+// GetUpcomingEvents returns events with the occurrences of their blocks in
+// the next days, ordered by the first occurrence.
+func (s *RecurrenceService) GetUpcomingEvents(days int) ([]model.Event, error) {
+	if days <= 0 {
+		days = defaultUpcomingDays
+	}
+	if days > maxUpcomingDays {
+		days = maxUpcomingDays
+	}
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return nil, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	to := from.AddDate(0, 0, days)
+	return expandEvents(events, holidays, s.location, from, to), nil
+}
+
+func expandEvents(events []model.Event, holidays []model.AcademicPeriod, loc *time.Location, from time.Time, to time.Time) []model.Event {
+	result := make([]model.Event, 0, len(events))
+	for _, event := range events {
+		var occurrences []model.EventBlock
+		for _, block := range event.EventBlocks {
+			occurrences = append(occurrences, expandBlock(block, holidays, loc, from, to)...)
+		}
+		if len(occurrences) == 0 {
+			continue
+		}
+		sort.Slice(occurrences, func(i, j int) bool {
+			return occurrences[i].StartDate.Before(occurrences[j].StartDate)
+		})
+		event.EventBlocks = occurrences
+		result = append(result, event)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].EventBlocks[0].StartDate.Before(result[j].EventBlocks[0].StartDate)
+	})
+	return result
+}
+
+func (s *RecurrenceService) EditOccurrence(edit model.OccurrenceEdit, opts model.SaveOptions) error {
+	block, err := s.repo.Events.GetOneBlock(edit.BlockID)
+	if err != nil {
+		return err
+	}
+	conflicts, err := s.editOccurrence(block, edit, opts)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, opts, model.AuditForceEditBlock, map[string]interface{}{
+			"block_id":  block.ID,
+			"conflicts": conflicts,
+		})
+	}
+	s.bus.Publish(model.ChangeOccurrenceUpdated, block.EventID, block.ID)
+	return nil
+}
+
+// editOccurrence checks the blocks the edit writes for room conflicts, the
+// stored series they replace is left out. It returns the conflicts of a
+// forced edit.
+func (s *RecurrenceService) editOccurrence(block model.EventBlock, edit model.OccurrenceEdit, opts model.SaveOptions) ([]model.BlockConflict, error) {
+	if block.RRule == "" {
+		return nil, fmt.Errorf("block is not recurring")
+	}
+	if edit.Description != nil {
+		if err := validateDescription(*edit.Description); err != nil {
+			return nil, err
+		}
+	}
+	rule, err := parseRecurrenceRule(block.RRule)
+	if err != nil {
+		return nil, err
+	}
+	block.StartDate = block.StartDate.In(s.location)
+	block.EndDate = block.EndDate.In(s.location)
+	recurrenceId := edit.RecurrenceID.In(s.location)
+	matches := rule.occurrences(block.StartDate, recurrenceId, recurrenceId.Add(time.Second))
+	if len(matches) == 0 || !matches[0].Equal(recurrenceId) {
+		return nil, fmt.Errorf("block has no occurrence at %s", edit.RecurrenceID.Format(time.RFC3339))
+	}
+	if edit.Scope == model.ScopeFollowing && recurrenceId.Equal(block.StartDate) {
+		edit.Scope = model.ScopeAll
+	}
+
+	switch edit.Scope {
+	case model.ScopeThis:
+		exception := model.BlockException{
+			BlockID:      block.ID,
+			RecurrenceID: recurrenceId,
+			Cancelled:    edit.Cancel,
+			Name:         edit.Name,
+			Description:  edit.Description,
+			StartDate:    edit.StartDate,
+			EndDate:      edit.EndDate,
+			Link:         edit.Link,
+		}
+		if edit.Cancel {
+			return nil, s.repo.Recurrence.SaveBlockException(exception)
+		}
+		occurrence := block
+		occurrence.RRule = ""
+		occurrence.StartDate = recurrenceId
+		occurrence.EndDate = occurrenceEnd(block, recurrenceId)
+		applyException(&occurrence, exception)
+		conflicts, release, err := checkConflicts(s.repo, []model.EventBlock{occurrence}, s.location, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return conflicts, s.repo.Recurrence.SaveBlockException(exception)
+	case model.ScopeAll:
+		if edit.Cancel {
+			return nil, s.repo.Events.DeleteEventBlock(block.ID)
+		}
+		shifted := applySeriesEdit(&block, recurrenceId, edit)
+		conflicts, release, err := checkConflicts(s.repo, []model.EventBlock{block}, s.location, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		if err := s.repo.Events.EditBlockInfo(block); err != nil {
+			return nil, err
+		}
+		if shifted {
+			return conflicts, s.repo.Recurrence.DeleteBlockExceptions(block.ID)
+		}
+		return conflicts, nil
+	case model.ScopeFollowing:
+		head := rule
+		head.Count = 0
+		head.Until = recurrenceId.Add(-time.Second)
+		if edit.Cancel {
+			_, err := s.repo.Recurrence.SplitRecurringBlock(block.ID, head.String(), recurrenceId, nil)
+			return nil, err
+		}
+		tail := rule
+		if tail.Count > 0 {
+			tail.Count -= rule.countBefore(block.StartDate, recurrenceId)
+		}
+		next := block
+		next.ID = 0
+		next.UID = ""
+		next.StartDate = recurrenceId
+		next.EndDate = occurrenceEnd(block, recurrenceId)
+		next.RRule = tail.String()
+		applySeriesEdit(&next, recurrenceId, edit)
+		ending := block
+		ending.RRule = head.String()
+		conflicts, release, err := checkConflicts(s.repo, []model.EventBlock{ending, next}, s.location, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		_, err = s.repo.Recurrence.SplitRecurringBlock(block.ID, head.String(), recurrenceId, &next)
+		return conflicts, err
+	}
+	return nil, fmt.Errorf("unknown scope %s", edit.Scope)
+}
+
+// applySeriesEdit applies the edit of the occurrence at recurrenceId to the
+// whole series of block and reports whether the series moved in time.
+func applySeriesEdit(block *model.EventBlock, recurrenceId time.Time, edit model.OccurrenceEdit) bool {
+	if edit.Name != nil {
+		block.Name = *edit.Name
+	}
+	if edit.Description != nil {
+		block.Description = *edit.Description
+	}
+	if edit.Link != nil {
+		block.Link = *edit.Link
+	}
+	duration := block.EndDate.Sub(block.StartDate)
+	start := recurrenceId
+	if edit.StartDate != nil {
+		start = *edit.StartDate
+	}
+	end := start.Add(duration)
+	if edit.EndDate != nil {
+		end = *edit.EndDate
+	}
+	shift := start.Sub(recurrenceId)
+	if shift == 0 && end.Sub(start) == duration {
+		return false
+	}
+	block.StartDate = block.StartDate.Add(shift)
+	block.EndDate = block.StartDate.Add(end.Sub(start))
+	return shift != 0
+}
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// recurrenceRule is the subset of RFC 5545 RRULE the admin panel produces:
+// FREQ with INTERVAL, COUNT or UNTIL, BYMONTH, BYDAY and BYMONTHDAY.
+type recurrenceRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByMonth    []time.Month
+	ByDay      []weekdayNum
+	ByMonthDay []int
+}
+
+type weekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+const maxRecurrenceIterations = 100000
+
+var icalWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+func parseRecurrenceRule(value string) (recurrenceRule, error) {
+	rule := recurrenceRule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return recurrenceRule{}, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key = strings.ToUpper(key)
+		val = strings.ToUpper(val)
+		switch key {
+		case "FREQ":
+			switch val {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				rule.Freq = val
+			default:
+				return recurrenceRule{}, fmt.Errorf("unsupported FREQ %s", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return recurrenceRule{}, fmt.Errorf("invalid INTERVAL %s", val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return recurrenceRule{}, fmt.Errorf("invalid COUNT %s", val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, _, err := parseICalTime(icalProp{Value: val}, time.UTC)
+			if err != nil {
+				return recurrenceRule{}, fmt.Errorf("invalid UNTIL %s", val)
+			}
+			if len(val) == 8 {
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			rule.Until = until
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(month)
+				if err != nil || n < 1 || n > 12 {
+					return recurrenceRule{}, fmt.Errorf("invalid BYMONTH %s", month)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(n))
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				if len(day) < 2 {
+					return recurrenceRule{}, fmt.Errorf("invalid BYDAY %s", day)
+				}
+				weekday, ok := icalWeekdays[day[len(day)-2:]]
+				if !ok {
+					return recurrenceRule{}, fmt.Errorf("invalid BYDAY %s", day)
+				}
+				n := 0
+				if prefix := day[:len(day)-2]; prefix != "" {
+					parsed, err := strconv.Atoi(prefix)
+					if err != nil || parsed == 0 || parsed < -53 || parsed > 53 {
+						return recurrenceRule{}, fmt.Errorf("invalid BYDAY %s", day)
+					}
+					n = parsed
+				}
+				rule.ByDay = append(rule.ByDay, weekdayNum{N: n, Weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return recurrenceRule{}, fmt.Errorf("invalid BYMONTHDAY %s", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			if val != "MO" {
+				return recurrenceRule{}, fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			return recurrenceRule{}, fmt.Errorf("unsupported rrule part %s", key)
+		}
+	}
+	if rule.Freq == "" {
+		return recurrenceRule{}, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return recurrenceRule{}, fmt.Errorf("COUNT and UNTIL can not be combined")
+	}
+	for _, day := range rule.ByDay {
+		if day.N == 0 {
+			continue
+		}
+		if rule.Freq != "MONTHLY" && rule.Freq != "YEARLY" {
+			return recurrenceRule{}, fmt.Errorf("numbered BYDAY requires FREQ=MONTHLY or YEARLY")
+		}
+		// Only a yearly rule without BYMONTH counts weekdays through the
+		// whole year, everywhere else they are counted within the month.
+		if (rule.Freq == "MONTHLY" || len(rule.ByMonth) > 0) && (day.N < -5 || day.N > 5) {
+			return recurrenceRule{}, fmt.Errorf("invalid BYDAY %d", day.N)
+		}
+	}
+	return rule, nil
+}
+
+func (r recurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(icalTimeFormat))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, 0, len(r.ByMonth))
+		for _, month := range r.ByMonth {
+			months = append(months, strconv.Itoa(int(month)))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			name := ""
+			for key, weekday := range icalWeekdays {
+				if weekday == day.Weekday {
+					name = key
+				}
+			}
+			if day.N != 0 {
+				name = strconv.Itoa(day.N) + name
+			}
+			days = append(days, name)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// occurrences returns the start times of the series beginning at dtstart
+// that fall into [from, to). Dates are computed in dtstart's location, so
+// wall-clock times survive daylight saving changes.
+func (r recurrenceRule) occurrences(dtstart time.Time, from time.Time, to time.Time) []time.Time {
+	var result []time.Time
+	count := 0
+	for period := 0; period < maxRecurrenceIterations; period++ {
+		candidates := r.period(dtstart, period)
+		if len(candidates) == 0 {
+			start := r.periodStart(dtstart, period)
+			if start.After(to) || (!r.Until.IsZero() && start.After(r.Until)) {
+				break
+			}
+		}
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return result
+			}
+			if r.Count > 0 && count >= r.Count {
+				return result
+			}
+			count++
+			if !t.Before(to) {
+				return result
+			}
+			if !t.Before(from) {
+				result = append(result, t)
+			}
+		}
+	}
+	return result
+}
+
+func (r recurrenceRule) periodStart(dtstart time.Time, period int) time.Time {
+	switch r.Freq {
+	case "DAILY":
+		return dtstart.AddDate(0, 0, period*r.Interval)
+	case "WEEKLY":
+		return dtstart.AddDate(0, 0, period*r.Interval*7)
+	case "MONTHLY":
+		return time.Date(dtstart.Year(), dtstart.Month()+time.Month(period*r.Interval), 1, 0, 0, 0, 0, dtstart.Location())
+	default:
+		return time.Date(dtstart.Year()+period*r.Interval, 1, 1, 0, 0, 0, 0, dtstart.Location())
+	}
+}
+
+// period returns the sorted candidate start times of the n-th period.
+func (r recurrenceRule) period(dtstart time.Time, n int) []time.Time {
+	loc := dtstart.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+	}
+	var result []time.Time
+	switch r.Freq {
+	case "DAILY":
+		t := dtstart.AddDate(0, 0, n*r.Interval)
+		if r.matchesByMonth(t) && r.matchesByDay(t) && r.matchesByMonthDay(t) {
+			result = append(result, t)
+		}
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			if t := dtstart.AddDate(0, 0, n*r.Interval*7); r.matchesByMonth(t) {
+				result = append(result, t)
+			}
+			return result
+		}
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := dtstart.AddDate(0, 0, n*r.Interval*7-offset)
+		for _, day := range r.ByDay {
+			t := monday.AddDate(0, 0, (int(day.Weekday)+6)%7)
+			if r.matchesByMonth(t) {
+				result = append(result, at(t.Year(), t.Month(), t.Day()))
+			}
+		}
+	case "MONTHLY":
+		first := r.periodStart(dtstart, n)
+		if r.matchesByMonth(first) {
+			result = r.monthDays(first.Year(), first.Month(), dtstart, at)
+		}
+	case "YEARLY":
+		result = r.yearDays(dtstart.Year()+n*r.Interval, dtstart, at)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Before(result[j])
+	})
+	return result
+}
+
+// yearDays expands a yearly period. BYMONTH picks the months, BYDAY
+// without BYMONTH counts weekdays through the whole year and BYMONTHDAY
+// alone repeats in every month.
+func (r recurrenceRule) yearDays(year int, dtstart time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	var result []time.Time
+	switch {
+	case len(r.ByMonth) > 0:
+		for _, month := range r.ByMonth {
+			result = append(result, r.monthDays(year, month, dtstart, at)...)
+		}
+	case len(r.ByDay) > 0:
+		daysInYear := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		for day := 1; day <= daysInYear; day++ {
+			t := at(year, time.January, day)
+			if len(r.ByMonthDay) > 0 && !r.matchesByMonthDay(t) {
+				continue
+			}
+			if !r.matchesYearlyByDay(t, daysInYear) {
+				continue
+			}
+			result = append(result, t)
+		}
+	case len(r.ByMonthDay) > 0:
+		for month := time.January; month <= time.December; month++ {
+			result = append(result, r.monthDays(year, month, dtstart, at)...)
+		}
+	default:
+		t := at(year, dtstart.Month(), dtstart.Day())
+		if t.Day() == dtstart.Day() {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (r recurrenceRule) monthDays(year int, month time.Month, dtstart time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	var result []time.Time
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if dtstart.Day() <= daysInMonth {
+			result = append(result, at(year, month, dtstart.Day()))
+		}
+		return result
+	}
+	for day := 1; day <= daysInMonth; day++ {
+		t := at(year, month, day)
+		if len(r.ByMonthDay) > 0 && !r.matchesByMonthDay(t) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !r.matchesMonthlyByDay(t, daysInMonth) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+func (r recurrenceRule) matchesByDay(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r recurrenceRule) matchesByMonth(t time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, month := range r.ByMonth {
+		if month == t.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r recurrenceRule) matchesYearlyByDay(t time.Time, daysInYear int) bool {
+	for _, day := range r.ByDay {
+		if day.Weekday != t.Weekday() {
+			continue
+		}
+		if day.N == 0 {
+			return true
+		}
+		if day.N > 0 && (t.YearDay()-1)/7+1 == day.N {
+			return true
+		}
+		if day.N < 0 && (daysInYear-t.YearDay())/7+1 == -day.N {
+			return true
+		}
+	}
+	return false
+}
+
+func (r recurrenceRule) matchesMonthlyByDay(t time.Time, daysInMonth int) bool {
+	for _, day := range r.ByDay {
+		if day.Weekday != t.Weekday() {
+			continue
+		}
+		if day.N == 0 {
+			return true
+		}
+		if day.N > 0 && (t.Day()-1)/7+1 == day.N {
+			return true
+		}
+		if day.N < 0 && (daysInMonth-t.Day())/7+1 == -day.N {
+			return true
+		}
+	}
+	return false
+}
+
+func (r recurrenceRule) matchesByMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range r.ByMonthDay {
+		if day == t.Day() || (day < 0 && daysInMonth+day+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// countBefore returns how many occurrences of the series start before t.
+func (r recurrenceRule) countBefore(dtstart time.Time, t time.Time) int {
+	unbounded := r
+	unbounded.Count = 0
+	return len(unbounded.occurrences(dtstart, dtstart, t))
+}
+
+// normalizeRRule validates a block's rule and returns its canonical form.
+func normalizeRRule(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	rule, err := parseRecurrenceRule(value)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+// expandBlock returns the occurrences of a block that overlap [from, to)
+// with cancelled occurrences dropped and overrides applied. Occurrences on
+// holidays are skipped unless an admin edited them. Single blocks are
+// returned as they are when they overlap the range. Recurrence is computed
+// in loc, the school's time zone.
+func expandBlock(block model.EventBlock, holidays []model.AcademicPeriod, loc *time.Location, from time.Time, to time.Time) []model.EventBlock {
+	if block.RRule == "" {
+		if block.StartDate.Before(to) && block.EndDate.After(from) {
+			return []model.EventBlock{block}
+		}
+		return nil
+	}
+	rule, err := parseRecurrenceRule(block.RRule)
+	if err != nil {
+		logrus.Errorf("BLOCK %d RRULE ERROR: %s", block.ID, err.Error())
+		return nil
+	}
+	exceptions := make(map[int64]model.BlockException, len(block.Exceptions))
+	for _, exception := range block.Exceptions {
+		exceptions[exception.RecurrenceID.Unix()] = exception
+	}
+	dtstart := block.StartDate.In(loc)
+	duration := block.EndDate.Sub(block.StartDate)
+	var result []model.EventBlock
+	for _, start := range rule.occurrences(dtstart, from.Add(-duration), to) {
+		recurrenceId := start
+		occurrence := block
+		occurrence.Exceptions = nil
+		occurrence.RecurrenceID = &recurrenceId
+		occurrence.StartDate = start
+		occurrence.EndDate = occurrenceEnd(block, start)
+		exception, ok := exceptions[start.Unix()]
+		if ok && exception.Cancelled {
+			continue
+		}
+		if ok {
+			applyException(&occurrence, exception)
+		} else if onHoliday(start, holidays) {
+			continue
+		}
+		if occurrence.StartDate.Before(to) && occurrence.EndDate.After(from) {
+			result = append(result, occurrence)
+		}
+	}
+	return result
+}
+
+// occurrenceEnd keeps all-day occurrences on whole days across daylight
+// saving changes.
+func occurrenceEnd(block model.EventBlock, start time.Time) time.Time {
+	duration := block.EndDate.Sub(block.StartDate)
+	if block.AllDay {
+		days := int((duration + 12*time.Hour) / (24 * time.Hour))
+		return start.AddDate(0, 0, days)
+	}
+	return start.Add(duration)
+}
+
+func onHoliday(t time.Time, holidays []model.AcademicPeriod) bool {
+	for _, holiday := range holidays {
+		if holiday.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// holidayExdates returns the occurrences of a recurring block that fall on
+// holidays and were not edited by an admin.
+func holidayExdates(block model.EventBlock, holidays []model.AcademicPeriod, loc *time.Location) []time.Time {
+	if block.RRule == "" || len(holidays) == 0 {
+		return nil
+	}
+	rule, err := parseRecurrenceRule(block.RRule)
+	if err != nil {
+		return nil
+	}
+	edited := make(map[int64]bool, len(block.Exceptions))
+	for _, exception := range block.Exceptions {
+		edited[exception.RecurrenceID.Unix()] = true
+	}
+	dtstart := block.StartDate.In(loc)
+	var result []time.Time
+	for _, holiday := range holidays {
+		from := holiday.StartDate.In(loc)
+		to := holiday.EndDate.In(loc).AddDate(0, 0, 1)
+		if to.Before(dtstart) {
+			continue
+		}
+		for _, start := range rule.occurrences(dtstart, from, to) {
+			if !edited[start.Unix()] {
+				result = append(result, start)
+			}
+		}
+	}
+	return result
+}
+
+func applyException(block *model.EventBlock, exception model.BlockException) {
+	if exception.Name != nil {
+		block.Name = *exception.Name
+	}
+	if exception.Description != nil {
+		block.Description = *exception.Description
+	}
+	if exception.StartDate != nil {
+		block.StartDate = *exception.StartDate
+	}
+	if exception.EndDate != nil {
+		block.EndDate = *exception.EndDate
+	}
+	if exception.Link != nil {
+		block.Link = *exception.Link
+	}
+}
+
+// attachExceptions loads the exceptions of every recurring block in events.
+func attachExceptions(repo *repository.Repository, events []model.Event) error {
+	var blockIds []int
+	for _, event := range events {
+		for _, block := range event.EventBlocks {
+			if block.RRule != "" {
+				blockIds = append(blockIds, block.ID)
+			}
+		}
+	}
+	if len(blockIds) == 0 {
+		return nil
+	}
+	exceptions, err := repo.Recurrence.GetBlockExceptions(blockIds)
+	if err != nil {
+		return err
+	}
+	byBlock := make(map[int][]model.BlockException)
+	for _, exception := range exceptions {
+		byBlock[exception.BlockID] = append(byBlock[exception.BlockID], exception)
+	}
+	for i := range events {
+		for j := range events[i].EventBlocks {
+			events[i].EventBlocks[j].Exceptions = byBlock[events[i].EventBlocks[j].ID]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func mustRule(t *testing.T, value string) recurrenceRule {
+	t.Helper()
+	rule, err := parseRecurrenceRule(value)
+	if err != nil {
+		t.Fatalf("parseRecurrenceRule(%q): %s", value, err)
+	}
+	return rule
+}
+
+func dates(times []time.Time) []string {
+	result := make([]string, len(times))
+	for i, t := range times {
+		result[i] = t.Format("2006-01-02 15:04")
+	}
+	return result
+}
+
+func assertDates(t *testing.T, got []time.Time, want ...string) {
+	t.Helper()
+	gotDates := dates(got)
+	if len(gotDates) != len(want) {
+		t.Fatalf("got %v, want %v", gotDates, want)
+	}
+	for i := range want {
+		if gotDates[i] != want[i] {
+			t.Fatalf("got %v, want %v", gotDates, want)
+		}
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	dtstart := time.Date(2025, time.September, 1, 9, 0, 0, 0, moscow)
+	from := dtstart
+	to := time.Date(2027, time.February, 1, 0, 0, 0, 0, moscow)
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		{"FREQ=DAILY;COUNT=3", []string{"2025-09-01 09:00", "2025-09-02 09:00", "2025-09-03 09:00"}},
+		{"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", []string{"2025-09-01 09:00", "2025-09-03 09:00", "2025-09-08 09:00", "2025-09-10 09:00"}},
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=3", []string{"2025-09-01 09:00", "2025-09-15 09:00", "2025-09-29 09:00"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", []string{"2025-09-26 09:00", "2025-10-31 09:00", "2025-11-28 09:00"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", []string{"2025-10-31 09:00", "2025-12-31 09:00", "2026-01-31 09:00"}},
+		{"FREQ=DAILY;BYMONTH=10;UNTIL=20251003T235959Z", []string{"2025-10-01 09:00", "2025-10-02 09:00", "2025-10-03 09:00"}},
+		// BYDAY of a yearly rule without BYMONTH runs through the whole
+		// year, not only through dtstart's month.
+		{"FREQ=YEARLY;BYDAY=1MO;COUNT=2", []string{"2026-01-05 09:00", "2027-01-04 09:00"}},
+		{"FREQ=YEARLY;BYDAY=-1MO;COUNT=2", []string{"2025-12-29 09:00", "2026-12-28 09:00"}},
+		{"FREQ=YEARLY;BYMONTH=3,10;BYDAY=2TU", []string{"2025-10-14 09:00", "2026-03-10 09:00", "2026-10-13 09:00"}},
+		{"FREQ=YEARLY;BYMONTH=5;BYMONTHDAY=25", []string{"2026-05-25 09:00"}},
+		{"FREQ=YEARLY;BYMONTHDAY=1;COUNT=3", []string{"2025-09-01 09:00", "2025-10-01 09:00", "2025-11-01 09:00"}},
+		{"FREQ=YEARLY;BYMONTH=9", []string{"2025-09-01 09:00", "2026-09-01 09:00"}},
+		{"FREQ=YEARLY", []string{"2025-09-01 09:00", "2026-09-01 09:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			assertDates(t, mustRule(t, tt.rule).occurrences(dtstart, from, to), tt.want...)
+		})
+	}
+}
+
+func TestRecurrenceYearlyByDayWholeYear(t *testing.T) {
+	dtstart := time.Date(2026, time.January, 1, 10, 0, 0, 0, time.UTC)
+	got := mustRule(t, "FREQ=YEARLY;BYDAY=SU").occurrences(dtstart, dtstart, time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if len(got) != 52 {
+		t.Fatalf("got %d sundays in 2026, want 52", len(got))
+	}
+	if got[len(got)-1].Month() != time.December {
+		t.Fatalf("last occurrence is %s", got[len(got)-1])
+	}
+}
+
+func TestRecurrenceKeepsWallClockAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	dtstart := time.Date(2026, time.March, 27, 9, 0, 0, 0, berlin)
+	got := mustRule(t, "FREQ=DAILY;COUNT=3").occurrences(dtstart, dtstart, dtstart.AddDate(0, 0, 10))
+	for _, occurrence := range got {
+		if occurrence.Hour() != 9 {
+			t.Fatalf("occurrence %s moved off 09:00", occurrence)
+		}
+	}
+	if got[2].Sub(got[1]) != 23*time.Hour {
+		t.Fatalf("the day of the change should be 23 hours long, got %s", got[2].Sub(got[1]))
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20260101",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=YEARLY;BYMONTH=1;BYDAY=20MO",
+		"FREQ=YEARLY;BYDAY=54MO",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;WKST=SU",
+		"FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := parseRecurrenceRule(value); err == nil {
+			t.Errorf("parseRecurrenceRule(%q) accepted an invalid rule", value)
+		}
+	}
+}
+
+func TestNormalizeRRule(t *testing.T) {
+	tests := map[string]string{
+		"RRULE:freq=weekly;byday=mo,fr;interval=1": "FREQ=WEEKLY;BYDAY=MO,FR",
+		"FREQ=YEARLY;BYDAY=20MO":                   "FREQ=YEARLY;BYDAY=20MO",
+		"FREQ=YEARLY;BYMONTH=3,10;BYDAY=-1SU":      "FREQ=YEARLY;BYMONTH=3,10;BYDAY=-1SU",
+		"FREQ=DAILY;UNTIL=20260101":                "FREQ=DAILY;UNTIL=20260101T235959Z",
+	}
+	for value, want := range tests {
+		got, err := normalizeRRule(value)
+		if err != nil {
+			t.Fatalf("normalizeRRule(%q): %s", value, err)
+		}
+		if got != want {
+			t.Errorf("normalizeRRule(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestExpandBlockAppliesExceptionsAndHolidays(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	moved := start.AddDate(0, 0, 2).Add(3 * time.Hour)
+	name := "Moved"
+	block := model.EventBlock{
+		ID:        1,
+		StartDate: start,
+		EndDate:   start.Add(time.Hour),
+		RRule:     "FREQ=DAILY;COUNT=5",
+		Exceptions: []model.BlockException{
+			{RecurrenceID: start.AddDate(0, 0, 1), Cancelled: true},
+			{RecurrenceID: start.AddDate(0, 0, 2), StartDate: &moved, Name: &name},
+		},
+	}
+	holidays := []model.AcademicPeriod{{
+		StartDate: model.DateOf(time.Date(2026, time.March, 5, 0, 0, 0, 0, time.UTC)),
+		EndDate:   model.DateOf(time.Date(2026, time.March, 5, 0, 0, 0, 0, time.UTC)),
+	}}
+	got := expandBlock(block, holidays, time.UTC, start, start.AddDate(0, 0, 10))
+	var starts []time.Time
+	for _, occurrence := range got {
+		starts = append(starts, occurrence.StartDate)
+	}
+	assertDates(t, starts, "2026-03-02 09:00", "2026-03-04 12:00", "2026-03-06 09:00")
+	if got[1].Name != "Moved" || got[1].RecurrenceID == nil || !got[1].RecurrenceID.Equal(start.AddDate(0, 0, 2)) {
+		t.Fatalf("override was not applied: %+v", got[1])
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	registrationCodeTTL = 10 * time.Minute
+	offerTTL            = 24 * time.Hour
+
+	maxRegistrationCodesPerEmail  = 5
+	maxRegistrationCodesPerClient = 20
+)
+
+type RegistrationService struct {
+	repo             *repository.Repository
+	mailer           *Mailer
+	codeStore        *CodeStore
+	registrationLink string
+	location         *time.Location
+	codeLimits       *SendLimiter
+}
+
+func NewRegistrationService(repo *repository.Repository, mailer *Mailer, codeStore *CodeStore, registrationLink string, location *time.Location) *RegistrationService {
+	return &RegistrationService{
+		repo:             repo,
+		mailer:           mailer,
+		codeStore:        codeStore,
+		registrationLink: registrationLink,
+		location:         location,
+		codeLimits:       NewSendLimiter(authCodeWindow),
+	}
+}
+
+func registrationKey(blockId int, email string) string {
+	return fmt.Sprintf("register:%d:%s", blockId, email)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateRegistration(registration model.Registration) error {
+	if registration.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if registration.Grade < 1 || registration.Grade > 11 {
+		return fmt.Errorf("grade must be between 1 and 11")
+	}
+	if registration.Class == "" || len(registration.Class) > 16 {
+		return fmt.Errorf("invalid class")
+	}
+	address, err := mail.ParseAddress(registration.Email)
+	if err != nil || address.Address != registration.Email {
+		return fmt.Errorf("invalid email")
+	}
+	return nil
+}
+
+// RequestRegistration checks that the block takes registrations and emails
+// a confirmation code. The registration is saved once the code comes back.
+// Codes are limited per email and per client ip.
+func (s *RegistrationService) RequestRegistration(registration model.Registration, ip string) error {
+	registration.Name = strings.TrimSpace(registration.Name)
+	registration.Class = strings.TrimSpace(registration.Class)
+	registration.Email = normalizeEmail(registration.Email)
+	if err := validateRegistration(registration); err != nil {
+		return &model.RegistrationError{Err: err}
+	}
+	status, err := s.repo.Registrations.GetRegistrationStatus(registration.BlockID)
+	if err != nil {
+		return err
+	}
+	if err := status.Check(time.Now()); err != nil {
+		return err
+	}
+	block, err := s.repo.Events.GetOneBlock(registration.BlockID)
+	if err != nil {
+		return err
+	}
+	if !s.codeLimits.Allow(time.Now(), []string{"email:" + registration.Email, "ip:" + ip}, []int{maxRegistrationCodesPerEmail, maxRegistrationCodesPerClient}) {
+		return model.ErrTooManyCodes
+	}
+	code := strconv.Itoa(generateRandomCode())
+	body := fmt.Sprintf("Код подтверждения записи на «%s»: %s\nКод действует %d минут.", block.Name, code, int(registrationCodeTTL.Minutes()))
+	if err := s.mailer.Send(registration.Email, fmt.Sprintf("Код подтверждения записи: %s", code), body); err != nil {
+		return err
+	}
+	s.codeStore.SetCodeWithData(registrationKey(registration.BlockID, registration.Email), code, registrationCodeTTL, registration)
+	return nil
+}
+
+// ConfirmRegistration saves a requested registration. Students who find
+// the block full join its waitlist.
+func (s *RegistrationService) ConfirmRegistration(blockId int, email string, code string) (model.Registration, error) {
+	data, ok := s.codeStore.TakeCode(registrationKey(blockId, normalizeEmail(email)), code)
+	if !ok {
+		return model.Registration{}, &model.RegistrationError{Err: fmt.Errorf("wrongcode")}
+	}
+	registration, err := s.repo.Registrations.CreateRegistration(data.(model.Registration), time.Now())
+	if err != nil {
+		return model.Registration{}, err
+	}
+	block, err := s.repo.Events.GetOneBlock(blockId)
+	if err != nil {
+		logrus.Errorf("REGISTRATION EMAIL ERROR: %s", err.Error())
+		return registration, nil
+	}
+	var subject, body string
+	if registration.Status == model.RegistrationWaitlisted {
+		subject = "Вы в листе ожидания"
+		body = fmt.Sprintf("Мест на «%s» пока нет, вы %d-й в листе ожидания. Если место освободится, мы пришлём письмо.", block.Name, registration.Position)
+	} else {
+		subject = "Вы записаны на мероприятие"
+		body = fmt.Sprintf("Вы записаны на «%s», начало %s.", block.Name, block.StartDate.In(s.location).Format(feedDateLayout))
+	}
+	body += "\nУправлять записью: " + s.link(registration)
+	if err := s.mailer.Send(registration.Email, subject, body); err != nil {
+		logrus.Errorf("REGISTRATION EMAIL ERROR: %s", err.Error())
+	}
+	return registration, nil
+}
+
+func (s *RegistrationService) link(registration model.Registration) string {
+	return fmt.Sprintf(s.registrationLink, registration.Token)
+}
+
+func (s *RegistrationService) GetRegistrationStatus(blockId int) (model.RegistrationStatus, error) {
+	return s.repo.Registrations.GetRegistrationStatus(blockId)
+}
+
+func (s *RegistrationService) GetRegistrations(blockId int) ([]model.Registration, error) {
+	return s.repo.Registrations.GetRegistrations(blockId)
+}
+
+func (s *RegistrationService) GetRegistration(token string) (model.Registration, error) {
+	return s.repo.Registrations.GetRegistrationByToken(token)
+}
+
+func (s *RegistrationService) DeleteRegistration(registrationId int) error {
+	promoted, err := s.repo.Registrations.DeleteRegistration(registrationId, time.Now(), offerTTL)
+	if err != nil {
+		return err
+	}
+	s.notifyOffers(promoted)
+	return nil
+}
+
+func (s *RegistrationService) CancelRegistration(token string) error {
+	promoted, err := s.repo.Registrations.CancelRegistration(token, time.Now(), offerTTL)
+	if err != nil {
+		return err
+	}
+	s.notifyOffers(promoted)
+	return nil
+}
+
+func (s *RegistrationService) AcceptOffer(token string) (model.Registration, error) {
+	return s.repo.Registrations.AcceptOffer(token, time.Now())
+}
+
+// RunWaitlistSweeper releases expired offers and promotes waitlists every
+// interval until ctx is done.
+func (s *RegistrationService) RunWaitlistSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, promoted, err := s.repo.Registrations.ExpireOffers(time.Now(), offerTTL)
+			if err != nil {
+				logrus.Errorf("WAITLIST SWEEPER ERROR: %s", err.Error())
+				continue
+			}
+			for _, registration := range expired {
+				s.sendRegistrationMail(registration, "Место освобождено", "Вы не подтвердили участие вовремя, место передано следующему в листе ожидания.")
+			}
+			s.notifyOffers(promoted)
+		}
+	}
+}
+
+func (s *RegistrationService) notifyOffers(promoted []model.Registration) {
+	for _, registration := range promoted {
+		body := fmt.Sprintf("Для вас освободилось место. Подтвердите участие до %s: %s", registration.OfferExpiresAt.In(s.location).Format(feedDateLayout), s.link(registration))
+		s.sendRegistrationMail(registration, "Освободилось место", body)
+	}
+}
+
+// sendRegistrationMail prefixes body with the block name. Failures are
+// logged, the registration change has already been saved.
+func (s *RegistrationService) sendRegistrationMail(registration model.Registration, subject string, body string) {
+	if block, err := s.repo.Events.GetOneBlock(registration.BlockID); err == nil {
+		body = fmt.Sprintf("«%s»\n%s", block.Name, body)
+	}
+	if err := s.mailer.Send(registration.Email, subject, body); err != nil {
+		logrus.Errorf("REGISTRATION EMAIL ERROR: %s", err.Error())
+	}
+}
+
+func (s *RegistrationService) ExportRegistrations(blockId int, format string) (model.ExportFile, error) {
+	registrations, err := s.repo.Registrations.GetRegistrations(blockId)
+	if err != nil {
+		return model.ExportFile{}, err
+	}
+	rows := [][]string{{"name", "grade", "class", "email", "status", "registered_at"}}
+	for _, registration := range registrations {
+		rows = append(rows, []string{
+			registration.Name,
+			strconv.Itoa(registration.Grade),
+			registration.Class,
+			registration.Email,
+			registration.Status,
+			registration.CreatedAt.In(s.location).Format(feedDateLayout),
+		})
+	}
+	return exportRows(fmt.Sprintf("registrations-%d", blockId), rows, format)
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	digestWeekday    = time.Monday
+	digestHour       = 8
+	digestDays       = 7
+	maxReminderHours = 168
+)
+
+type RemindersService struct {
+	repo      *repository.Repository
+	schedule  *ScheduleService
+	channels  []Channel
+	eventLink string
+	location  *time.Location
+}
+
+func NewRemindersService(repo *repository.Repository, schedule *ScheduleService, channels []Channel, eventLink string, location *time.Location) *RemindersService {
+	return &RemindersService{
+		repo:      repo,
+		schedule:  schedule,
+		channels:  channels,
+		eventLink: eventLink,
+		location:  location,
+	}
+}
+
+func (s *RemindersService) GetNotificationSettings(userId int) (model.NotificationSettings, error) {
+	user, err := s.repo.Users.GetUser(userId)
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	return user.NotificationSettings, nil
+}
+
+func (s *RemindersService) EditNotificationSettings(userId int, settings model.NotificationSettings) error {
+	if settings.ReminderHours < 1 || settings.ReminderHours > maxReminderHours {
+		return fmt.Errorf("reminder_hours must be between 1 and %d", maxReminderHours)
+	}
+	return s.repo.Users.EditNotificationSettings(userId, settings)
+}
+
+// Unsubscribe turns off one kind of email, reminders or digest, or all of
+// them when kind is empty.
+func (s *RemindersService) Unsubscribe(token string, kind string) error {
+	switch kind {
+	case "", model.DeliveryReminder, model.DeliveryDigest:
+	default:
+		return fmt.Errorf("unknown kind %s", kind)
+	}
+	return s.repo.Users.Unsubscribe(token, kind)
+}
+
+// RunReminders sends due reminders and, on Monday mornings, the weekly
+// digest every interval until ctx is done.
+func (s *RemindersService) RunReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sendDue(time.Now()); err != nil {
+				logrus.Errorf("REMINDERS ERROR: %s", err.Error())
+			}
+		}
+	}
+}
+
+// sendDue loads the events once and sends each user the reminders and the
+// digest that are due.
+func (s *RemindersService) sendDue(now time.Time) error {
+	users, err := s.repo.Users.GetUsers("")
+	if err != nil {
+		return err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return err
+	}
+	local := now.In(s.location)
+	digestDue := local.Weekday() == digestWeekday && local.Hour() >= digestHour
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return err
+	}
+	if err := attachExceptions(s.repo, events); err != nil {
+		return err
+	}
+	var upcoming []model.Event
+	if digestDue {
+		upcoming = expandEvents(events, holidays, s.location, now, now.AddDate(0, 0, digestDays))
+	}
+	for _, user := range users {
+		if user.RemindersEnabled {
+			if err := s.sendReminders(user, events, holidays, now); err != nil {
+				logrus.Errorf("USER %d REMINDERS ERROR: %s", user.ID, err.Error())
+			}
+		}
+		if digestDue && user.DigestEnabled && len(upcoming) > 0 {
+			if err := s.sendDigest(user, upcoming, local); err != nil {
+				logrus.Errorf("USER %d DIGEST ERROR: %s", user.ID, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// sendReminders reminds about each occurrence of the user's events that
+// starts within the user's reminder hours, picked from all stored events.
+func (s *RemindersService) sendReminders(user model.User, all []model.Event, holidays []model.AcademicPeriod, now time.Time) error {
+	favorites, statuses, err := s.schedule.userSelection(user)
+	if err != nil {
+		return err
+	}
+	if len(favorites) == 0 && len(statuses) == 0 {
+		return nil
+	}
+	events := pickUserEvents(all, favorites, statuses)
+	to := now.Add(time.Duration(user.ReminderHours) * time.Hour)
+	for _, event := range events {
+		for _, block := range event.EventBlocks {
+			for _, occurrence := range expandBlock(block, holidays, s.location, now, to) {
+				if occurrence.StartDate.Before(now) {
+					continue
+				}
+				key := fmt.Sprintf("%d:%d", block.ID, occurrence.StartDate.Unix())
+				body := fmt.Sprintf("Напоминаем: «%s» начнётся %s.\n%s",
+					icalSummary(event.Name, occurrence.Name),
+					occurrence.StartDate.In(s.location).Format(feedDateLayout),
+					fmt.Sprintf(s.eventLink, event.ID))
+				if err := s.deliver(user, model.DeliveryReminder, key, "Напоминание о мероприятии", body); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RemindersService) sendDigest(user model.User, upcoming []model.Event, local time.Time) error {
+	year, week := local.ISOWeek()
+	var body strings.Builder
+	body.WriteString("Мероприятия лицея на неделю:\n")
+	for _, event := range upcoming {
+		fmt.Fprintf(&body, "\n%s\n%s\n", event.Name, fmt.Sprintf(s.eventLink, event.ID))
+		for _, block := range event.EventBlocks {
+			fmt.Fprintf(&body, "  %s  %s\n", block.StartDate.In(s.location).Format(feedDateLayout), block.Name)
+		}
+	}
+	return s.deliver(user, model.DeliveryDigest, fmt.Sprintf("%d-W%02d", year, week), "Мероприятия на неделю", body.String())
+}
+
+// deliver sends the message through every channel linked to the user. Each
+// channel's delivery is claimed before sending, so a message is never sent
+// twice. A failed send releases the claim and is retried on the next run.
+func (s *RemindersService) deliver(user model.User, kind string, key string, subject string, body string) error {
+	notification := model.Notification{Kind: kind, Subject: subject, Body: body}
+	for _, channel := range s.channels {
+		if !channel.Linked(user) {
+			continue
+		}
+		channelKey := key
+		if channel.Name() != channelEmail {
+			channelKey = channel.Name() + ":" + key
+		}
+		claimed, err := s.repo.Deliveries.ClaimDelivery(user.ID, kind, channelKey)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := channel.Send(user, notification); err != nil {
+			if releaseErr := s.repo.Deliveries.ReleaseDelivery(user.ID, kind, channelKey); releaseErr != nil {
+				logrus.Errorf("DELIVERY RELEASE ERROR: %s", releaseErr.Error())
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// conflictHorizon bounds how far ahead of now occurrences of a recurring
+// block are checked for room conflicts.
+const conflictHorizon = 365 * 24 * time.Hour
+
+type RoomsService struct {
+	repo *repository.Repository
+}
+
+func NewRoomsService(repo *repository.Repository) *RoomsService {
+	return &RoomsService{
+		repo: repo,
+	}
+}
+
+func validateRoom(room model.Room) error {
+	if strings.TrimSpace(room.Name) == "" {
+		return fmt.Errorf("room name is empty")
+	}
+	if room.Capacity < 0 {
+		return fmt.Errorf("room capacity is negative")
+	}
+	return nil
+}
+
+func (s *RoomsService) CreateRoom(room model.Room) (int, error) {
+	if err := validateRoom(room); err != nil {
+		return 0, err
+	}
+	return s.repo.Rooms.CreateRoom(room)
+}
+
+func (s *RoomsService) EditRoom(room model.Room) error {
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+	return s.repo.Rooms.EditRoom(room)
+}
+
+func (s *RoomsService) DeleteRoom(roomId int) error {
+	return s.repo.Rooms.DeleteRoom(roomId)
+}
+
+func (s *RoomsService) GetRooms() ([]model.Room, error) {
+	return s.repo.Rooms.GetRooms()
+}
+
+func (s *RoomsService) GetAuditLog(limit int) ([]model.AuditEntry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return s.repo.Audit.GetAuditLog(limit)
+}
+
+type bookedOccurrence struct {
+	key   int
+	block model.EventBlock
+}
+
+// findConflicts returns the blocks that share a room with one of blocks at
+// the same time, including blocks of the same batch. Blocks that already
+// exist are not compared with their stored versions.
+func findConflicts(repo *repository.Repository, blocks []model.EventBlock, loc *time.Location) ([]model.BlockConflict, error) {
+	return findConflictsIgnoring(repo, blocks, nil, loc)
+}
+
+// findConflictsIgnoring leaves out the stored blocks in ignored, such as
+// blocks about to be deleted.
+func findConflictsIgnoring(repo *repository.Repository, blocks []model.EventBlock, ignored []int, loc *time.Location) ([]model.BlockConflict, error) {
+	var (
+		roomIds  []int
+		from, to time.Time
+		rooms    = make(map[int]bool)
+		editing  = make(map[int]bool)
+	)
+	for _, id := range ignored {
+		editing[id] = true
+	}
+	now := time.Now()
+	for _, block := range blocks {
+		if block.LocationID == nil {
+			continue
+		}
+		if !rooms[*block.LocationID] {
+			rooms[*block.LocationID] = true
+			roomIds = append(roomIds, *block.LocationID)
+		}
+		start, end := block.StartDate, block.EndDate
+		if block.RRule != "" {
+			// Past occurrences of a series can not collide any more, an old
+			// series is checked from now on.
+			if start.Before(now) {
+				start = now
+			}
+			end = start.Add(conflictHorizon)
+		}
+		if from.IsZero() || start.Before(from) {
+			from = start
+		}
+		if end.After(to) {
+			to = end
+		}
+		if block.ID != 0 {
+			editing[block.ID] = true
+		}
+	}
+	if len(roomIds) == 0 {
+		return nil, nil
+	}
+	existing, err := repo.Rooms.GetRoomBlocks(roomIds, from, to)
+	if err != nil {
+		return nil, err
+	}
+	booked := []model.Event{{EventBlocks: existing}}
+	if err := attachExceptions(repo, booked); err != nil {
+		return nil, err
+	}
+	holidays, err := repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return nil, err
+	}
+	byRoom := make(map[int][]bookedOccurrence)
+	for _, block := range booked[0].EventBlocks {
+		if editing[block.ID] {
+			continue
+		}
+		for _, occurrence := range expandBlock(block, holidays, loc, from, to) {
+			byRoom[*block.LocationID] = append(byRoom[*block.LocationID], bookedOccurrence{key: block.ID, block: occurrence})
+		}
+	}
+
+	var conflicts []model.BlockConflict
+	for i, block := range blocks {
+		if block.LocationID == nil {
+			continue
+		}
+		room := *block.LocationID
+		others := append([]bookedOccurrence{}, byRoom[room]...)
+		for j := i + 1; j < len(blocks); j++ {
+			if blocks[j].LocationID == nil || *blocks[j].LocationID != room {
+				continue
+			}
+			for _, occurrence := range expandBlock(blocks[j], holidays, loc, from, to) {
+				others = append(others, bookedOccurrence{key: -j - 1, block: occurrence})
+			}
+		}
+		reported := make(map[int]bool)
+		for _, occurrence := range expandBlock(block, holidays, loc, from, to) {
+			for _, other := range others {
+				if reported[other.key] {
+					continue
+				}
+				if occurrence.StartDate.Before(other.block.EndDate) && other.block.StartDate.Before(occurrence.EndDate) {
+					reported[other.key] = true
+					conflicts = append(conflicts, model.BlockConflict{
+						RoomID:        room,
+						Block:         occurrence,
+						ConflictsWith: other.block,
+					})
+				}
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// checkConflicts fails with a ConflictError when blocks collide in a room
+// and the write is not forced. Conflicts of a forced write are returned to
+// be recorded once the write succeeds.
+//
+// The rooms of blocks stay locked until release is called, the caller
+// writes the blocks first so that a concurrent write to the same rooms is
+// checked against them.
+func checkConflicts(repo *repository.Repository, blocks []model.EventBlock, loc *time.Location, opts model.SaveOptions) ([]model.BlockConflict, func(), error) {
+	return checkConflictsIgnoring(repo, blocks, nil, loc, opts)
+}
+
+func checkConflictsIgnoring(repo *repository.Repository, blocks []model.EventBlock, ignored []int, loc *time.Location, opts model.SaveOptions) ([]model.BlockConflict, func(), error) {
+	release, err := lockRooms(repo, blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflicts, err := findConflictsIgnoring(repo, blocks, ignored, loc)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	if len(conflicts) > 0 && !opts.Force {
+		release()
+		return nil, nil, &model.ConflictError{Conflicts: conflicts}
+	}
+	return conflicts, release, nil
+}
+
+// lockRooms locks the rooms booked by blocks, see checkConflicts.
+func lockRooms(repo *repository.Repository, blocks []model.EventBlock) (func(), error) {
+	var roomIds []int
+	for _, block := range blocks {
+		if block.LocationID != nil {
+			roomIds = append(roomIds, *block.LocationID)
+		}
+	}
+	return repo.Rooms.LockRooms(roomIds)
+}
+
+// recordOverride writes a forced write to the audit log. The write itself
+// has succeeded, so failures are only logged.
+func recordOverride(repo *repository.Repository, opts model.SaveOptions, action string, details map[string]interface{}) {
+	data, err := json.Marshal(details)
+	if err == nil {
+		err = repo.Audit.AddAuditEntry(model.AuditEntry{
+			Actor:   opts.Actor,
+			Action:  action,
+			Details: data,
+		})
+	}
+	if err != nil {
+		logrus.Errorf("AUDIT LOG ERROR: %s", err.Error())
+	}
+}
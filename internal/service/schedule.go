@@ -0,0 +1,194 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+const (
+	defaultScheduleDays = 30
+	maxScheduleDays     = 366
+)
+
+type ScheduleService struct {
+	repo         *repository.Repository
+	calendar     *CalendarService
+	calendarLink string
+	location     *time.Location
+}
+
+func NewScheduleService(repo *repository.Repository, calendarLink string, location *time.Location) *ScheduleService {
+	return &ScheduleService{
+		repo:         repo,
+		calendar:     NewCalendarService(repo, location),
+		calendarLink: calendarLink,
+		location:     location,
+	}
+}
+
+func (s *ScheduleService) AddFavorite(userId int, eventId int) error {
+	if _, err := s.repo.Events.GetOneEvent(eventId); err != nil {
+		return err
+	}
+	return s.repo.Favorites.AddFavorite(userId, eventId)
+}
+
+func (s *ScheduleService) RemoveFavorite(userId int, eventId int) error {
+	return s.repo.Favorites.RemoveFavorite(userId, eventId)
+}
+
+func (s *ScheduleService) GetFavorites(userId int) ([]int, error) {
+	return s.repo.Favorites.GetFavoriteEventIds(userId)
+}
+
+// userEvents returns the user's favourite events with all their blocks and
+// the events of registered blocks with just those blocks. statuses maps
+// registered blocks to the registration status.
+func (s *ScheduleService) userEvents(user model.User) ([]model.Event, map[int]bool, map[int]string, error) {
+	favorites, statuses, err := s.userSelection(user)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(favorites) == 0 && len(statuses) == 0 {
+		return []model.Event{}, favorites, statuses, nil
+	}
+	all, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	events := pickUserEvents(all, favorites, statuses)
+	if err := attachExceptions(s.repo, events); err != nil {
+		return nil, nil, nil, err
+	}
+	return events, favorites, statuses, nil
+}
+
+// userSelection returns the user's favourite events and the statuses of
+// their registered blocks.
+func (s *ScheduleService) userSelection(user model.User) (map[int]bool, map[int]string, error) {
+	favoriteIds, err := s.repo.Favorites.GetFavoriteEventIds(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	registrations, err := s.repo.Favorites.GetUserRegistrations(user.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	favorites := make(map[int]bool, len(favoriteIds))
+	for _, id := range favoriteIds {
+		favorites[id] = true
+	}
+	statuses := make(map[int]string, len(registrations))
+	for _, registration := range registrations {
+		statuses[registration.BlockID] = registration.Status
+	}
+	return favorites, statuses, nil
+}
+
+// pickUserEvents keeps the favourite events of all and, of other events,
+// the registered blocks. all is not changed.
+func pickUserEvents(all []model.Event, favorites map[int]bool, statuses map[int]string) []model.Event {
+	events := make([]model.Event, 0, len(favorites))
+	for _, event := range all {
+		if favorites[event.ID] {
+			events = append(events, event)
+			continue
+		}
+		var blocks []model.EventBlock
+		for _, block := range event.EventBlocks {
+			if _, ok := statuses[block.ID]; ok {
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) > 0 {
+			event.EventBlocks = blocks
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// GetSchedule returns the occurrences of the user's events in the next
+// days in chronological order.
+func (s *ScheduleService) GetSchedule(userId int, days int) ([]model.ScheduleItem, error) {
+	if days <= 0 {
+		days = defaultScheduleDays
+	}
+	if days > maxScheduleDays {
+		days = maxScheduleDays
+	}
+	user, err := s.repo.Users.GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	events, favorites, statuses, err := s.userEvents(user)
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	to := from.AddDate(0, 0, days)
+	items := []model.ScheduleItem{}
+	for _, event := range events {
+		for _, block := range event.EventBlocks {
+			for _, occurrence := range expandBlock(block, holidays, s.location, from, to) {
+				items = append(items, model.ScheduleItem{
+					EventName:          event.Name,
+					Block:              occurrence,
+					Favorite:           favorites[event.ID],
+					RegistrationStatus: statuses[block.ID],
+				})
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Block.StartDate.Before(items[j].Block.StartDate)
+	})
+	return items, nil
+}
+
+// GetCalendarLink returns the link to the user's private calendar, making
+// a token on first use. Renewing replaces the token and the old link stops
+// working.
+func (s *ScheduleService) GetCalendarLink(userId int, renew bool) (string, error) {
+	user, err := s.repo.Users.GetUser(userId)
+	if err != nil {
+		return "", err
+	}
+	token := ""
+	if user.CalendarToken != nil {
+		token = *user.CalendarToken
+	}
+	if token == "" || renew {
+		if token, err = s.repo.Users.SetCalendarToken(userId); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf(s.calendarLink, token), nil
+}
+
+func (s *ScheduleService) UserICS(token string, loc *time.Location, locale string) (model.Feed, error) {
+	user, err := s.repo.Users.GetUserByCalendarToken(token)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	events, _, _, err := s.userEvents(user)
+	if err != nil {
+		return model.Feed{}, err
+	}
+	if err := translateEvents(s.repo, events, locale); err != nil {
+		return model.Feed{}, err
+	}
+	holidays, err := s.repo.Academic.GetNonSchoolPeriods()
+	if err != nil {
+		return model.Feed{}, err
+	}
+	return s.calendar.renderCalendar(feedTextIn(locale).schedule, events, holidays, loc)
+}
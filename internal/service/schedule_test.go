@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+func TestPickUserEvents(t *testing.T) {
+	all := []model.Event{
+		{ID: 1, EventBlocks: []model.EventBlock{{ID: 10}, {ID: 11}}},
+		{ID: 2, EventBlocks: []model.EventBlock{{ID: 20}, {ID: 21}}},
+		{ID: 3, EventBlocks: []model.EventBlock{{ID: 30}}},
+	}
+	events := pickUserEvents(all, map[int]bool{1: true}, map[int]string{21: model.RegistrationConfirmed})
+	if len(events) != 2 || events[0].ID != 1 || events[1].ID != 2 {
+		t.Fatalf("got %+v", events)
+	}
+	if len(events[0].EventBlocks) != 2 {
+		t.Errorf("favourite event lost blocks: %+v", events[0].EventBlocks)
+	}
+	if len(events[1].EventBlocks) != 1 || events[1].EventBlocks[0].ID != 21 {
+		t.Errorf("registered event has blocks %+v", events[1].EventBlocks)
+	}
+	if len(all[1].EventBlocks) != 2 {
+		t.Errorf("all was changed: %+v", all[1].EventBlocks)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/lib/pq"
+)
+
+// validateParent checks that the event may become a stage of the parent.
+// Series are one level deep: the parent can not be a stage itself and an
+// event that has stages can not join another series. The repository
+// checks again under lock when it writes the link, this gives early
+// errors, per operation in batches.
+func validateParent(repo *repository.Repository, eventId int, parentId *int) error {
+	if parentId == nil {
+		return nil
+	}
+	if *parentId == eventId {
+		return model.ErrOwnParent
+	}
+	parent, err := repo.Events.GetOneEvent(*parentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil {
+		return model.ErrParentIsStage
+	}
+	if eventId == 0 {
+		return nil
+	}
+	hasChildren, err := repo.Events.HasChildEvents(eventId)
+	if err != nil {
+		return err
+	}
+	if hasChildren {
+		return model.ErrHasStages
+	}
+	return nil
+}
+
+const (
+	maxLabels      = 20
+	maxLabelLength = 64
+)
+
+// cleanLabels trims the tags or audience of an event and drops empty and
+// repeated labels. nil stays nil, saving it keeps the stored labels.
+func cleanLabels(field string, labels pq.StringArray) (pq.StringArray, error) {
+	if labels == nil {
+		return nil, nil
+	}
+	cleaned := make(pq.StringArray, 0, len(labels))
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || seen[label] {
+			continue
+		}
+		if len(label) > maxLabelLength {
+			return nil, fmt.Errorf("%s %q is longer than %d characters", field, label, maxLabelLength)
+		}
+		seen[label] = true
+		cleaned = append(cleaned, label)
+	}
+	if len(cleaned) > maxLabels {
+		return nil, fmt.Errorf("too many %s, at most %d", field, maxLabels)
+	}
+	return cleaned, nil
+}
+
+// prepareLabels cleans the tags and audience of the event. A stage given
+// the labels of its parent stores none, so it keeps following the parent.
+func prepareLabels(repo *repository.Repository, event *model.Event, parentId *int) error {
+	var err error
+	if event.Tags, err = cleanLabels("tags", event.Tags); err != nil {
+		return err
+	}
+	if event.Audience, err = cleanLabels("audience", event.Audience); err != nil {
+		return err
+	}
+	if parentId == nil || (event.Tags == nil && event.Audience == nil) {
+		return nil
+	}
+	parent, err := repo.Events.GetOneEvent(*parentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	inheritLabels(event, parent)
+	return nil
+}
+
+// inheritLabels clears the labels of a stage that equal its parent's.
+func inheritLabels(stage *model.Event, parent model.Event) {
+	if stage.Tags != nil && sameLabels(stage.Tags, parent.Tags) {
+		stage.Tags = pq.StringArray{}
+	}
+	if stage.Audience != nil && sameLabels(stage.Audience, parent.Audience) {
+		stage.Audience = pq.StringArray{}
+	}
+}
+
+func sameLabels(a, b pq.StringArray) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadSeries returns the series the event belongs to, the event being
+// either its parent or one of its stages. Stages come ordered by their
+// earliest block, stages without blocks go last.
+func loadSeries(repo *repository.Repository, eventId int) (model.Event, []model.Event, error) {
+	parent, err := repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return model.Event{}, nil, err
+	}
+	if parent.ParentID != nil {
+		parent, err = repo.Events.GetOneEvent(*parent.ParentID)
+		if err != nil {
+			return model.Event{}, nil, err
+		}
+	}
+	children, err := repo.Events.GetChildEvents(parent.ID)
+	if err != nil {
+		return model.Event{}, nil, err
+	}
+	sortStages(children)
+	return parent, children, nil
+}
+
+func sortStages(events []model.Event) {
+	starts := make(map[int]time.Time, len(events))
+	for _, event := range events {
+		for _, block := range event.EventBlocks {
+			if start, ok := starts[event.ID]; !ok || block.StartDate.Before(start) {
+				starts[event.ID] = block.StartDate
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, aok := starts[events[i].ID]
+		b, bok := starts[events[j].ID]
+		if aok != bok {
+			return aok
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+// GetSeries returns the parent event of the series and its stages.
+func (s *EventsService) GetSeries(eventId int) (model.Event, []model.Event, error) {
+	parent, children, err := loadSeries(s.repo, eventId)
+	if err != nil {
+		return model.Event{}, nil, err
+	}
+	events := append([]model.Event{parent}, children...)
+	if err := attachExceptions(s.repo, events); err != nil {
+		return model.Event{}, nil, err
+	}
+	if err := s.attachments.attachTo(events); err != nil {
+		return model.Event{}, nil, err
+	}
+	return events[0], events[1:], nil
+}
+
+// SetEventParent adds the event to the series of parentId, or takes it
+// out of its series when parentId is nil.
+func (s *EventsService) SetEventParent(eventId int, parentId *int) error {
+	if err := validateParent(s.repo, eventId, parentId); err != nil {
+		return err
+	}
+	if err := s.repo.Events.SetEventParent(eventId, parentId); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, eventId, 0)
+	return nil
+}
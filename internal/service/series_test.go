@@ -0,0 +1,50 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lib/pq"
+)
+
+func TestCleanLabels(t *testing.T) {
+	labels, err := cleanLabels("tags", pq.StringArray{" olympiad ", "", "math", "olympiad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (pq.StringArray{"olympiad", "math"}); !reflect.DeepEqual(labels, want) {
+		t.Errorf("got %v, want %v", labels, want)
+	}
+	if labels, err := cleanLabels("tags", nil); err != nil || labels != nil {
+		t.Errorf("nil: got %v, %v, want nil to keep the stored tags", labels, err)
+	}
+	if _, err := cleanLabels("tags", pq.StringArray{strings.Repeat("a", maxLabelLength+1)}); err == nil {
+		t.Error("long label: want error")
+	}
+	many := make(pq.StringArray, maxLabels+1)
+	for i := range many {
+		many[i] = strings.Repeat("a", i+1)
+	}
+	if _, err := cleanLabels("audience", many); err == nil || !strings.Contains(err.Error(), "too many audience") {
+		t.Errorf("too many labels: got %v", err)
+	}
+}
+
+func TestInheritLabels(t *testing.T) {
+	parent := model.Event{Tags: pq.StringArray{"olympiad", "math"}, Audience: pq.StringArray{"9", "10"}}
+	stage := model.Event{Tags: pq.StringArray{"olympiad", "math"}, Audience: pq.StringArray{"10"}}
+	inheritLabels(&stage, parent)
+	if len(stage.Tags) != 0 || stage.Tags == nil {
+		t.Errorf("tags of the parent: got %#v, want an empty list to follow the parent", stage.Tags)
+	}
+	if want := (pq.StringArray{"10"}); !reflect.DeepEqual(stage.Audience, want) {
+		t.Errorf("own audience: got %v, want %v", stage.Audience, want)
+	}
+	kept := model.Event{}
+	inheritLabels(&kept, parent)
+	if kept.Tags != nil || kept.Audience != nil {
+		t.Errorf("missing labels: got %v and %v, want them kept nil", kept.Tags, kept.Audience)
+	}
+}
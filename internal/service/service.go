@@ -1,7 +1,10 @@
 package service
 
 import (
+	"context"
+	"io"
 	"net/smtp"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/lavatee/liceum_backend/internal/model"
@@ -9,29 +12,286 @@ import (
 )
 
 type Events interface {
-	SendAuthCode(email string) error
+	SendAuthCode(email string, ip string, locale string) error
 	VerifyCode(code string, email string) (string, string, error)
 	CheckIsAdmin(email string) bool
-	CreateEvent(event model.Event) (int, error)
+	CreateEvent(event model.Event, opts model.SaveOptions) (int, error)
 	DeleteEvent(eventId int) error
-	CreateEventBlocks(blocks []model.EventBlock) error
+	CreateEventBlocks(blocks []model.EventBlock, opts model.SaveOptions) error
 	DeleteEventBlock(blockId int) error
 	EditEventInfo(event model.Event) error
-	EditBlockInfo(block model.EventBlock) error
+	EditBlockInfo(block model.EventBlock, opts model.SaveOptions) error
 	GetCurrentEvents() ([]model.Event, error)
 	GetAllEvents() ([]model.Event, error)
 	ParseToken(token string) (jwt.MapClaims, error)
+	ParseUser(token string) (model.UserClaims, error)
 	GetOneEvent(eventId int) (model.Event, error)
 	GetOneBlock(blockId int) (model.EventBlock, error)
+	GetSeries(eventId int) (model.Event, []model.Event, error)
+	SetEventParent(eventId int, parentId *int) error
+	SetBlockOrder(eventId int, blockIds []int) error
 	RefreshToken(refreshToken string) (string, string, error)
 }
 
+type Calendar interface {
+	EventsICS(loc *time.Location, locale string) (model.Feed, error)
+	EventICS(eventId int, loc *time.Location, locale string) (model.Feed, error)
+	SeriesICS(eventId int, loc *time.Location, locale string) (model.Feed, error)
+}
+
+type Import interface {
+	ImportICS(data []byte, target model.ImportTarget, dryRun bool, opts model.SaveOptions) (model.ImportReport, error)
+	ImportSpreadsheet(data []byte, format string, dryRun bool, opts model.SaveOptions) (model.ImportReport, error)
+	ExportEvents(format string) (model.ExportFile, error)
+}
+
+type Feed interface {
+	RSS(limit int, loc *time.Location, locale string) (model.Feed, error)
+	Atom(limit int, loc *time.Location, locale string) (model.Feed, error)
+	SeriesRSS(eventId int, loc *time.Location, locale string) (model.Feed, error)
+	SeriesAtom(eventId int, loc *time.Location, locale string) (model.Feed, error)
+}
+
+type Backup interface {
+	Backup(w io.Writer) error
+	Restore(r io.Reader, mode string, opts model.SaveOptions) (model.RestoreReport, error)
+}
+
+type Recurrence interface {
+	GetUpcomingEvents(days int) ([]model.Event, error)
+	EditOccurrence(edit model.OccurrenceEdit, opts model.SaveOptions) error
+}
+
+type Academic interface {
+	CreatePeriod(period model.AcademicPeriod) (int, error)
+	EditPeriod(period model.AcademicPeriod) error
+	DeletePeriod(periodId int) error
+	GetAcademicCalendar() ([]model.AcademicPeriod, error)
+	ScheduleWarnings(blocks []model.EventBlock) ([]string, error)
+}
+
+type Rooms interface {
+	CreateRoom(room model.Room) (int, error)
+	EditRoom(room model.Room) error
+	DeleteRoom(roomId int) error
+	GetRooms() ([]model.Room, error)
+	GetAuditLog(limit int) ([]model.AuditEntry, error)
+}
+
+type Registrations interface {
+	RequestRegistration(registration model.Registration, ip string) error
+	ConfirmRegistration(blockId int, email string, code string) (model.Registration, error)
+	GetRegistrationStatus(blockId int) (model.RegistrationStatus, error)
+	GetRegistrations(blockId int) ([]model.Registration, error)
+	GetRegistration(token string) (model.Registration, error)
+	DeleteRegistration(registrationId int) error
+	CancelRegistration(token string) error
+	AcceptOffer(token string) (model.Registration, error)
+	RunWaitlistSweeper(ctx context.Context, interval time.Duration)
+	ExportRegistrations(blockId int, format string) (model.ExportFile, error)
+}
+
+type Attendance interface {
+	GetCheckInCode(blockId int) (model.CheckInCode, error)
+	CheckIn(attendance model.Attendance, code string, ip string) (int, error)
+	MarkAttendance(attendance model.Attendance, occurrence *time.Time, present bool) error
+	GetBlockAttendance(blockId int) ([]model.Attendance, error)
+	EventAttendanceReport(eventId int, format string) (model.ExportFile, error)
+	StudentAttendanceReport(email string, format string) (model.ExportFile, error)
+}
+
+type Users interface {
+	GetUser(userId int) (model.User, error)
+	EditProfile(user model.User) error
+	GetUsers(role string) ([]model.User, error)
+	DeleteUser(userId int) error
+}
+
+type Schedule interface {
+	AddFavorite(userId int, eventId int) error
+	RemoveFavorite(userId int, eventId int) error
+	GetFavorites(userId int) ([]int, error)
+	GetSchedule(userId int, days int) ([]model.ScheduleItem, error)
+	GetCalendarLink(userId int, renew bool) (string, error)
+	UserICS(token string, loc *time.Location, locale string) (model.Feed, error)
+}
+
+type Reminders interface {
+	GetNotificationSettings(userId int) (model.NotificationSettings, error)
+	EditNotificationSettings(userId int, settings model.NotificationSettings) error
+	Unsubscribe(token string, kind string) error
+	RunReminders(ctx context.Context, interval time.Duration)
+}
+
+type Telegram interface {
+	CreateTelegramLink(userId int) (model.TelegramLink, error)
+	UnlinkTelegram(userId int) error
+	RunTelegramBot(ctx context.Context)
+}
+
+type Webhooks interface {
+	CreateWebhook(webhook model.Webhook) (model.Webhook, error)
+	EditWebhook(webhook model.Webhook) error
+	DeleteWebhook(webhookId int) error
+	GetWebhook(webhookId int) (model.Webhook, error)
+	GetWebhooks() ([]model.Webhook, error)
+	GetDeliveries(webhookId int) ([]model.WebhookDelivery, error)
+	TestWebhook(webhookId int) (model.WebhookDelivery, error)
+	RunWebhookDispatcher(ctx context.Context, interval time.Duration)
+}
+
+type Stream interface {
+	Subscribe(lastEventId int64) (*StreamSubscription, error)
+	Unsubscribe(sub *StreamSubscription)
+	RunStreamListener(ctx context.Context, dsn string)
+}
+
+type Attachments interface {
+	UploadAttachment(eventId int, fileName string, data []byte) (model.Attachment, error)
+	GetAttachments(eventId int) ([]model.Attachment, error)
+	OpenAttachment(attachmentId int, thumbnail bool) (model.Attachment, io.ReadCloser, int64, error)
+	DeleteAttachment(attachmentId int) error
+	RunAttachmentSweeper(ctx context.Context, interval time.Duration)
+}
+
+type Translations interface {
+	GetTranslations(eventId int) ([]model.Translation, error)
+	SaveEventTranslation(translation model.Translation) error
+	SaveBlockTranslation(translation model.Translation) error
+	DeleteEventTranslation(eventId int, locale string) error
+	DeleteBlockTranslation(blockId int, locale string) error
+	TranslateEvents(events []model.Event, locale string) error
+	TranslateSchedule(items []model.ScheduleItem, locale string) error
+}
+
+type Templates interface {
+	CloneEvent(eventId int, opts model.CloneOptions, save model.SaveOptions) (model.Event, error)
+	GetTemplates() ([]model.EventTemplate, error)
+	GetTemplate(templateId int) (model.EventTemplate, error)
+	CreateTemplate(template model.EventTemplate, eventId int) (int, error)
+	EditTemplate(template model.EventTemplate) error
+	DeleteTemplate(templateId int) error
+	InstantiateTemplate(templateId int, instance model.TemplateInstance, save model.SaveOptions) (model.Event, error)
+}
+
+type Batch interface {
+	RunBatch(mode string, ops []model.BatchOperation, save model.SaveOptions) ([]model.BatchResult, error)
+}
+
 type Service struct {
 	Events
+	Calendar
+	Import
+	Feed
+	Backup
+	Recurrence
+	Academic
+	Rooms
+	Registrations
+	Attendance
+	Users
+	Schedule
+	Reminders
+	Telegram
+	Webhooks
+	Stream
+	Attachments
+	Translations
+	Templates
+	Batch
+}
+
+// SiteConfig holds the public addresses used in feeds and emails. Links
+// are format strings taking an event or attachment id or a registration,
+// private calendar or unsubscribe token.
+type SiteConfig struct {
+	URL              string
+	EventLink        string
+	RegistrationLink string
+	CalendarLink     string
+	UnsubscribeLink  string
+	AttachmentLink   string
+}
+
+// Config collects the settings of all services. Location is the school's
+// time zone used for all-day blocks, recurrence and calendar days.
+type Config struct {
+	SMTPAuth smtp.Auth
+	Gmail    string
+	SMTPHost string
+	SMTPPort string
+	Site     SiteConfig
+	Location *time.Location
+	Telegram TelegramConfig
+	Storage  StorageConfig
+
+	AttendanceSecret string
 }
 
-func NewService(repo *repository.Repository, smtpAuth smtp.Auth, gmail string, smtpHost string, smtpPort string) *Service {
+// TelegramConfig configures the bot. An empty Token disables it, BaseURL
+// defaults to the public Bot API.
+type TelegramConfig struct {
+	Token   string
+	BaseURL string
+	BotName string
+}
+
+// StorageConfig picks where attachments are kept: Driver "s3" uses S3,
+// anything else the local directory Dir.
+type StorageConfig struct {
+	Driver string
+	Dir    string
+	S3     S3Config
+}
+
+func NewService(repo *repository.Repository, cfg Config) *Service {
+	mailer := NewMailer(cfg.SMTPAuth, cfg.Gmail, cfg.SMTPHost, cfg.SMTPPort)
+	codeStore := NewCodeStore()
+	site, location := cfg.Site, cfg.Location
+	bus := NewChangeBus()
+	var storage Storage = NewLocalStorage(cfg.Storage.Dir)
+	if cfg.Storage.Driver == "s3" {
+		storage = NewS3Storage(cfg.Storage.S3)
+	}
+	attachments := NewAttachmentsService(repo, storage, bus, site.AttachmentLink)
+	events := NewEventsService(repo, mailer, codeStore, bus, attachments, location)
+	recurrence := NewRecurrenceService(repo, bus, location)
+	schedule := NewScheduleService(repo, site.CalendarLink, location)
+	var telegramClient *TelegramClient
+	if cfg.Telegram.Token != "" {
+		baseURL := cfg.Telegram.BaseURL
+		if baseURL == "" {
+			baseURL = "https://api.telegram.org"
+		}
+		telegramClient = NewTelegramClient(baseURL, cfg.Telegram.Token)
+	}
+	telegram := NewTelegramService(repo, telegramClient, codeStore, events, recurrence, cfg.Telegram.BotName, site.EventLink, location)
+	bus.Subscribe(telegram.onChange)
+	webhooks := NewWebhooksService(repo, location)
+	bus.Subscribe(webhooks.onChange)
+	stream := NewStreamService(repo)
+	bus.Subscribe(stream.onChange)
+	channels := []Channel{NewEmailChannel(mailer, site.UnsubscribeLink), telegram}
 	return &Service{
-		Events: NewEventsService(repo, smtpAuth, gmail, smtpHost, smtpPort),
+		Events:        events,
+		Calendar:      NewCalendarService(repo, location),
+		Import:        NewImportService(repo, bus, location),
+		Feed:          NewFeedService(repo, site.URL, site.EventLink, location),
+		Backup:        NewBackupService(repo, bus, location),
+		Recurrence:    recurrence,
+		Academic:      NewAcademicService(repo, location),
+		Rooms:         NewRoomsService(repo),
+		Registrations: NewRegistrationService(repo, mailer, codeStore, site.RegistrationLink, location),
+		Attendance:    NewAttendanceService(repo, cfg.AttendanceSecret, site.URL, location),
+		Users:         NewUsersService(repo),
+		Schedule:      schedule,
+		Reminders:     NewRemindersService(repo, schedule, channels, site.EventLink, location),
+		Telegram:      telegram,
+		Webhooks:      webhooks,
+		Stream:        stream,
+		Attachments:   attachments,
+		Translations:  NewTranslationsService(repo, bus),
+		Templates:     NewTemplatesService(repo, bus, location),
+		Batch:         NewBatchService(repo, bus, location),
 	}
 }
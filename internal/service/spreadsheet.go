@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var spreadsheetColumns = []string{
+	"event_name",
+	"event_description",
+	"block_uid",
+	"block_name",
+	"block_description",
+	"start_date",
+	"end_date",
+	"all_day",
+	"link",
+	"rrule",
+}
+
+var spreadsheetDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"2006-01-02",
+	"02.01.2006",
+}
+
+const spreadsheetDateLayout = "2006-01-02"
+
+// excelEpoch is the zero day of spreadsheet serial dates.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+func (s *ImportService) ExportEvents(format string) (model.ExportFile, error) {
+	events, err := s.repo.Events.GetAllEvents()
+	if err != nil {
+		return model.ExportFile{}, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	rows := [][]string{spreadsheetColumns}
+	for _, event := range events {
+		if len(event.EventBlocks) == 0 {
+			rows = append(rows, []string{event.Name, event.Description, "", "", "", "", "", "", "", ""})
+			continue
+		}
+		sortBlocks(event.EventBlocks)
+		for _, block := range event.EventBlocks {
+			start := block.StartDate.In(s.location).Format(time.RFC3339)
+			end := block.EndDate.In(s.location).Format(time.RFC3339)
+			if block.AllDay {
+				start = block.StartDate.In(s.location).Format(spreadsheetDateLayout)
+				end = block.EndDate.In(s.location).Add(-time.Nanosecond).Format(spreadsheetDateLayout)
+			}
+			rows = append(rows, []string{
+				event.Name,
+				event.Description,
+				block.UID,
+				block.Name,
+				block.Description,
+				start,
+				end,
+				strconv.FormatBool(block.AllDay),
+				block.Link,
+				block.RRule,
+			})
+		}
+	}
+	return exportRows("events", rows, format)
+}
+
+// exportRows writes rows as name.csv or name.xlsx.
+func exportRows(name string, rows [][]string, format string) (model.ExportFile, error) {
+	switch format {
+	case FormatCSV, "":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.WriteAll(rows); err != nil {
+			return model.ExportFile{}, err
+		}
+		return model.ExportFile{Name: name + ".csv", ContentType: "text/csv; charset=utf-8", Body: buf.Bytes()}, nil
+	case FormatXLSX:
+		body, err := writeXLSX(name, rows)
+		if err != nil {
+			return model.ExportFile{}, err
+		}
+		return model.ExportFile{Name: name + ".xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Body: body}, nil
+	}
+	return model.ExportFile{}, fmt.Errorf("%w %s", model.ErrUnsupportedFormat, format)
+}
+
+// ImportSpreadsheet validates every row before touching the database. When
+// any row is invalid nothing is written and the report lists the errors.
+func (s *ImportService) ImportSpreadsheet(data []byte, format string, dryRun bool, opts model.SaveOptions) (model.ImportReport, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+	switch format {
+	case FormatCSV:
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		r.FieldsPerRecord = -1
+		rows, err = r.ReadAll()
+	case FormatXLSX:
+		rows, err = readXLSX(data)
+	default:
+		return model.ImportReport{}, invalidImport("unsupported format %s", format)
+	}
+	if err != nil {
+		return model.ImportReport{}, &model.ImportError{Err: err}
+	}
+	if len(rows) == 0 {
+		return model.ImportReport{}, invalidImport("file is empty")
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["event_name"]; !ok {
+		return model.ImportReport{}, invalidImport("event_name column is missing")
+	}
+
+	report := model.ImportReport{DryRun: dryRun}
+	blocks := make([]model.ImportBlock, 0, len(rows)-1)
+	seenUIDs := make(map[string]int)
+	for i, row := range rows[1:] {
+		rowNumber := i + 2
+		cell := func(name string) string {
+			index, ok := columns[name]
+			if !ok || index >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[index])
+		}
+		if isBlankRow(row) {
+			continue
+		}
+		item, err := importBlockFromRow(cell, s.location)
+		if err == nil {
+			err = validateImportDescriptions(item)
+		}
+		// Files without the column, exported before it was added, must not
+		// turn recurring blocks into single ones.
+		if _, ok := columns["rrule"]; !ok {
+			item.KeepRRule = true
+		}
+		if err == nil && item.Block != nil && item.Block.UID != "" {
+			if previous, ok := seenUIDs[item.Block.UID]; ok {
+				err = fmt.Errorf("block_uid duplicates row %d", previous)
+			}
+			seenUIDs[item.Block.UID] = rowNumber
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, model.ImportRowError{Row: rowNumber, Error: err.Error()})
+			continue
+		}
+		item.Row = rowNumber
+		blocks = append(blocks, item)
+	}
+	if len(report.Errors) > 0 {
+		return report, nil
+	}
+	if len(blocks) == 0 {
+		return model.ImportReport{}, invalidImport("file has no rows")
+	}
+	return s.importBlocks(blocks, dryRun, opts)
+}
+
+// importBlockFromRow reads dates in loc, the school's time zone. The end
+// date of an all-day row is the last day of the block.
+func importBlockFromRow(cell func(name string) string, loc *time.Location) (model.ImportBlock, error) {
+	item := model.ImportBlock{
+		EventName:        cell("event_name"),
+		EventDescription: cell("event_description"),
+	}
+	if item.EventName == "" {
+		return model.ImportBlock{}, fmt.Errorf("event_name is empty")
+	}
+	blockFields := []string{"block_uid", "block_name", "block_description", "start_date", "end_date", "all_day", "link", "rrule"}
+	hasBlock := false
+	for _, name := range blockFields {
+		if cell(name) != "" {
+			hasBlock = true
+			break
+		}
+	}
+	if !hasBlock {
+		return item, nil
+	}
+	allDay, err := parseSpreadsheetBool(cell("all_day"))
+	if err != nil {
+		return model.ImportBlock{}, fmt.Errorf("all_day: %s", err.Error())
+	}
+	start, err := parseSpreadsheetDate(cell("start_date"), loc)
+	if err != nil {
+		return model.ImportBlock{}, fmt.Errorf("start_date: %s", err.Error())
+	}
+	end, err := parseSpreadsheetDate(cell("end_date"), loc)
+	if err != nil {
+		return model.ImportBlock{}, fmt.Errorf("end_date: %s", err.Error())
+	}
+	if allDay {
+		start = model.DateOf(start).In(loc)
+		end = model.DateOf(end).In(loc).AddDate(0, 0, 1)
+	}
+	if end.Before(start) {
+		return model.ImportBlock{}, fmt.Errorf("end_date is before start_date")
+	}
+	rrule, err := normalizeRRule(cell("rrule"))
+	if err != nil {
+		return model.ImportBlock{}, fmt.Errorf("rrule: %s", err.Error())
+	}
+	item.Block = &model.EventBlock{
+		UID:         cell("block_uid"),
+		Name:        cell("block_name"),
+		Description: cell("block_description"),
+		StartDate:   start,
+		EndDate:     end,
+		AllDay:      allDay,
+		Link:        cell("link"),
+		RRule:       rrule,
+	}
+	return item, nil
+}
+
+func parseSpreadsheetBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no", "нет":
+		return false, nil
+	case "1", "true", "yes", "да":
+		return true, nil
+	}
+	return false, fmt.Errorf("unrecognised value %q", value)
+}
+
+func parseSpreadsheetDate(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("is empty")
+	}
+	for _, layout := range spreadsheetDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		days, fraction := math.Modf(serial)
+		t := excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round(fraction*86400)) * time.Second)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3Stub is an in-memory stand-in for an S3 server. It checks that
+// requests are signed and that the payload hash matches the body.
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newS3Stub() *s3Stub {
+	return &s3Stub{objects: make(map[string][]byte), types: make(map[string]string)}
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Date") == "" ||
+		r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+		s.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", s.types[key])
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Storage(t *testing.T, handler http.Handler) *S3Storage {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewS3Storage(S3Config{
+		Endpoint:  server.URL + "/",
+		Bucket:    "files",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+}
+
+func TestS3StoragePutGetDelete(t *testing.T) {
+	stub := newS3Stub()
+	storage := newTestS3Storage(t, stub)
+	key := "attachments/1/афиша 1.png"
+	if err := storage.Put(key, "image/png", []byte("png data")); err != nil {
+		t.Fatal(err)
+	}
+	stored := "/files/attachments/1/%D0%B0%D1%84%D0%B8%D1%88%D0%B0%201.png"
+	if string(stub.objects[stored]) != "png data" || stub.types[stored] != "image/png" {
+		t.Fatalf("stored %v", stub.objects)
+	}
+	file, size, err := storage.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != "png data" || size != int64(len(data)) {
+		t.Errorf("got %q, size %d", data, size)
+	}
+	if err := storage.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := storage.Get(key); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("get after delete: %v", err)
+	}
+}
+
+func TestS3StorageErrors(t *testing.T) {
+	storage := newTestS3Storage(t, newS3Stub())
+	storage.cfg.AccessKey = "wrong"
+	err := storage.Put("key", "text/csv", []byte("a,b"))
+	if err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestS3StorageStreamsDownloads(t *testing.T) {
+	release := make(chan struct{})
+	storage := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	file, _, err := storage.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(file, buf); err != nil || string(buf) != "first " {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(file)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("got %q, %v", rest, err)
+	}
+	if storage.client.Timeout != 0 {
+		t.Errorf("client timeout %s would cut long downloads", storage.client.Timeout)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	storage := NewS3Storage(S3Config{Endpoint: "https://s3.example.com", Bucket: "files"})
+	target, err := storage.objectURL("a/b c.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.String() != "https://files.s3.example.com/a/b%20c.pdf" {
+		t.Errorf("got %s", target)
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	streamBuffer        = 64
+	streamBatch         = 500
+	maxStreamBacklog    = 1000
+	streamPollInterval  = 10 * time.Second
+	streamRetryDelay    = 5 * time.Second
+	changeLogRetention  = 7 * 24 * time.Hour
+	changeLogCleanEvery = time.Hour
+)
+
+// StreamSubscription is a client's view of the change stream. Backlog holds
+// the changes after the id the client resumed from. When those changes are
+// no longer all in the log, Reset is sent instead, a ChangeReset entry with
+// the id to resume from. C is closed when the client falls too far behind
+// and has to resume with a new subscription.
+type StreamSubscription struct {
+	Backlog []model.ChangeLogEntry
+	Reset   *model.ChangeLogEntry
+	C       <-chan model.ChangeLogEntry
+
+	ch chan model.ChangeLogEntry
+}
+
+// StreamService writes changes to the change log and streams the log to
+// subscribers. Every replica listens for the log's notifications, so
+// clients see changes made through any of them.
+type StreamService struct {
+	repo *repository.Repository
+	wake chan struct{}
+
+	mu          sync.Mutex
+	lastId      int64
+	subscribers map[*StreamSubscription]struct{}
+}
+
+func NewStreamService(repo *repository.Repository) *StreamService {
+	return &StreamService{
+		repo:        repo,
+		wake:        make(chan struct{}, 1),
+		subscribers: make(map[*StreamSubscription]struct{}),
+	}
+}
+
+func (s *StreamService) onChange(change model.EventChange) {
+	if _, err := s.repo.ChangeLog.AddChange(change); err != nil {
+		logrus.Errorf("CHANGE LOG ERROR: %s", err.Error())
+	}
+}
+
+// Subscribe starts a subscription. A positive lastEventId resumes after
+// that change. Clients too far behind, or behind changes already cleaned
+// from the log, get a reset instead of a backlog with a gap.
+func (s *StreamService) Subscribe(lastEventId int64) (*StreamSubscription, error) {
+	ch := make(chan model.ChangeLogEntry, streamBuffer)
+	sub := &StreamSubscription{C: ch, ch: ch}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+	if lastEventId <= 0 {
+		return sub, nil
+	}
+	backlog, err := s.repo.ChangeLog.GetChangesAfter(lastEventId, maxStreamBacklog+1)
+	if err != nil {
+		s.Unsubscribe(sub)
+		return nil, err
+	}
+	first, err := s.repo.ChangeLog.GetFirstChangeID()
+	if err != nil {
+		s.Unsubscribe(sub)
+		return nil, err
+	}
+	last, err := s.repo.ChangeLog.GetLastChangeID()
+	if err != nil {
+		s.Unsubscribe(sub)
+		return nil, err
+	}
+	if len(backlog) > maxStreamBacklog || first > lastEventId+1 || last < lastEventId {
+		sub.Reset = &model.ChangeLogEntry{ID: last, Kind: model.ChangeReset, CreatedAt: time.Now()}
+		return sub, nil
+	}
+	sub.Backlog = backlog
+	return sub, nil
+}
+
+func (s *StreamService) Unsubscribe(sub *StreamSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// RunStreamListener listens for change notifications on dsn and passes new
+// changes to subscribers until ctx is done. The log is also polled, in
+// case the listener misses notifications.
+func (s *StreamService) RunStreamListener(ctx context.Context, dsn string) {
+	lastId, err := s.repo.ChangeLog.GetLastChangeID()
+	if err != nil {
+		logrus.Errorf("CHANGE LOG ERROR: %s", err.Error())
+	}
+	s.mu.Lock()
+	s.lastId = lastId
+	s.mu.Unlock()
+	go func() {
+		for ctx.Err() == nil {
+			err := s.repo.ChangeLog.ListenChanges(ctx, dsn, func() {
+				select {
+				case s.wake <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				logrus.Errorf("CHANGE LISTENER ERROR: %s", err.Error())
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(streamRetryDelay):
+			}
+		}
+	}()
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	clean := time.NewTicker(changeLogCleanEvery)
+	defer clean.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clean.C:
+			if err := s.repo.ChangeLog.DeleteChangesBefore(time.Now().Add(-changeLogRetention)); err != nil {
+				logrus.Errorf("CHANGE LOG CLEAN ERROR: %s", err.Error())
+			}
+			continue
+		case <-s.wake:
+		case <-poll.C:
+		}
+		if err := s.catchUp(); err != nil {
+			logrus.Errorf("CHANGE LOG ERROR: %s", err.Error())
+		}
+	}
+}
+
+// catchUp passes the changes after the last one seen to subscribers. Ids
+// commit in order, so no change can appear later below the last one seen.
+// Subscribers whose buffer is full are dropped.
+func (s *StreamService) catchUp() error {
+	for {
+		s.mu.Lock()
+		lastId := s.lastId
+		s.mu.Unlock()
+		entries, err := s.repo.ChangeLog.GetChangesAfter(lastId, streamBatch)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		s.mu.Lock()
+		for _, entry := range entries {
+			for sub := range s.subscribers {
+				select {
+				case sub.ch <- entry:
+				default:
+					delete(s.subscribers, sub)
+					close(sub.ch)
+				}
+			}
+		}
+		s.lastId = entries[len(entries)-1].ID
+		s.mu.Unlock()
+		if len(entries) < streamBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	channelTelegram      = "telegram"
+	telegramLinkTTL      = 10 * time.Minute
+	telegramPollTimeout  = 30
+	telegramRetryDelay   = 5 * time.Second
+	telegramUpcomingDays = 7
+	telegramNoticeDelay  = 30 * time.Second
+)
+
+var errTelegramDisabled = errors.New("telegram bot is not configured")
+
+// TelegramClient calls the Telegram Bot API at baseURL, which is
+// https://api.telegram.org unless a stub server stands in for it.
+type TelegramClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewTelegramClient(baseURL string, token string) *TelegramClient {
+	return &TelegramClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second},
+	}
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+func (c *TelegramClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/%s", c.baseURL, url.PathEscape(c.token), method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var response telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("telegram %s: %s", method, resp.Status)
+	}
+	if !response.OK {
+		return fmt.Errorf("telegram %s: %s", method, response.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func (c *TelegramClient) SendMessage(ctx context.Context, chatId int64, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":                  chatId,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// GetUpdates long-polls for messages after offset.
+func (c *TelegramClient) GetUpdates(ctx context.Context, offset int64) ([]telegramUpdate, error) {
+	var updates []telegramUpdate
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         telegramPollTimeout,
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// TelegramService is the Telegram notification channel and the bot behind
+// it. Without a bot token it stays disabled and reaches nobody.
+type TelegramService struct {
+	repo       *repository.Repository
+	client     *TelegramClient
+	codeStore  *CodeStore
+	events     *EventsService
+	recurrence *RecurrenceService
+	botName    string
+	eventLink  string
+	location   *time.Location
+
+	noticeDelay time.Duration
+	noticesMu   sync.Mutex
+	notices     map[int]*telegramNotice
+}
+
+// telegramNotice collects the changes of one event until its message is
+// sent.
+type telegramNotice struct {
+	created bool
+	deleted bool
+}
+
+func NewTelegramService(repo *repository.Repository, client *TelegramClient, codeStore *CodeStore, events *EventsService, recurrence *RecurrenceService, botName string, eventLink string, location *time.Location) *TelegramService {
+	return &TelegramService{
+		repo:       repo,
+		client:     client,
+		codeStore:  codeStore,
+		events:     events,
+		recurrence: recurrence,
+		botName:    botName,
+		eventLink:  eventLink,
+		location:   location,
+
+		noticeDelay: telegramNoticeDelay,
+		notices:     make(map[int]*telegramNotice),
+	}
+}
+
+func (s *TelegramService) Name() string {
+	return channelTelegram
+}
+
+func (s *TelegramService) Linked(user model.User) bool {
+	return s.client != nil && user.TelegramChatID != nil
+}
+
+func (s *TelegramService) Send(user model.User, notification model.Notification) error {
+	if !s.Linked(user) {
+		return errTelegramDisabled
+	}
+	return s.client.SendMessage(context.Background(), *user.TelegramChatID, notification.Subject+"\n\n"+notification.Body)
+}
+
+func telegramCodeKey(code string) string {
+	return "telegram:" + code
+}
+
+// CreateTelegramLink makes a one-time code the user sends to the bot to
+// link their chat. The code is long enough not to be guessed.
+func (s *TelegramService) CreateTelegramLink(userId int) (model.TelegramLink, error) {
+	if s.client == nil {
+		return model.TelegramLink{}, errTelegramDisabled
+	}
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return model.TelegramLink{}, err
+	}
+	code := hex.EncodeToString(buf)
+	s.codeStore.SetCodeWithData(telegramCodeKey(code), code, telegramLinkTTL, userId)
+	return model.TelegramLink{
+		Code:      code,
+		URL:       fmt.Sprintf("https://t.me/%s?start=%s", s.botName, code),
+		ExpiresAt: time.Now().Add(telegramLinkTTL),
+	}, nil
+}
+
+func (s *TelegramService) UnlinkTelegram(userId int) error {
+	return s.repo.Users.SetTelegramChat(userId, nil)
+}
+
+// RunTelegramBot answers bot commands until ctx is done.
+func (s *TelegramService) RunTelegramBot(ctx context.Context) {
+	if s.client == nil {
+		return
+	}
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := s.client.GetUpdates(ctx, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.Errorf("TELEGRAM UPDATES ERROR: %s", err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(telegramRetryDelay):
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil {
+				continue
+			}
+			reply := s.handleCommand(update.Message.Chat.ID, update.Message.Text)
+			if err := s.client.SendMessage(ctx, update.Message.Chat.ID, reply); err != nil {
+				logrus.Errorf("TELEGRAM SEND ERROR: %s", err.Error())
+			}
+		}
+	}
+}
+
+const telegramHelp = `Команды:
+/today — что идёт сегодня
+/upcoming — мероприятия на неделю
+/stop — отвязать аккаунт
+
+Чтобы получать напоминания, привяжите аккаунт по ссылке из профиля на сайте.`
+
+func (s *TelegramService) handleCommand(chatId int64, text string) string {
+	command, argument, _ := strings.Cut(strings.TrimSpace(text), " ")
+	// Commands in groups come as /command@botname.
+	command, _, _ = strings.Cut(command, "@")
+	var (
+		reply string
+		err   error
+	)
+	switch command {
+	case "/start", "/link":
+		if argument == "" {
+			return "Привет! Я присылаю напоминания о мероприятиях лицея.\n\n" + telegramHelp
+		}
+		reply, err = s.link(chatId, strings.TrimSpace(argument))
+	case "/today":
+		reply, err = s.today()
+	case "/upcoming":
+		reply, err = s.upcoming()
+	case "/stop":
+		reply, err = s.unlinkChat(chatId)
+	default:
+		return telegramHelp
+	}
+	if err != nil {
+		logrus.Errorf("TELEGRAM COMMAND %s ERROR: %s", command, err.Error())
+		return "Что-то пошло не так, попробуйте позже."
+	}
+	return reply
+}
+
+func (s *TelegramService) link(chatId int64, code string) (string, error) {
+	data, ok := s.codeStore.TakeCode(telegramCodeKey(code), code)
+	if !ok {
+		return "Код не подошёл или устарел. Получите новую ссылку в профиле на сайте.", nil
+	}
+	if err := s.repo.Users.SetTelegramChat(data.(int), &chatId); err != nil {
+		return "", err
+	}
+	return "Аккаунт привязан. Напоминания о ваших мероприятиях будут приходить сюда.", nil
+}
+
+func (s *TelegramService) unlinkChat(chatId int64) (string, error) {
+	user, err := s.repo.Users.GetUserByTelegramChat(chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "Этот чат не привязан к аккаунту.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.Users.SetTelegramChat(user.ID, nil); err != nil {
+		return "", err
+	}
+	return "Аккаунт отвязан, уведомления больше не придут.", nil
+}
+
+// today lists events in progress and the rest of today's occurrences.
+func (s *TelegramService) today() (string, error) {
+	current, err := s.events.GetCurrentEvents()
+	if err != nil {
+		return "", err
+	}
+	upcoming, err := s.recurrence.GetUpcomingEvents(1)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().In(s.location)
+	tomorrow := model.DateOf(now).In(s.location).AddDate(0, 0, 1)
+	var text strings.Builder
+	if len(current) > 0 {
+		text.WriteString("Сейчас идут:\n")
+		for _, event := range current {
+			fmt.Fprintf(&text, "• %s\n  %s\n", event.Name, fmt.Sprintf(s.eventLink, event.ID))
+		}
+	}
+	later := false
+	for _, event := range upcoming {
+		for _, block := range event.EventBlocks {
+			if !block.StartDate.After(now) || !block.StartDate.Before(tomorrow) {
+				continue
+			}
+			if !later {
+				text.WriteString("\nПозже сегодня:\n")
+				later = true
+			}
+			fmt.Fprintf(&text, "• %s %s\n", block.StartDate.In(s.location).Format("15:04"), icalSummary(event.Name, block.Name))
+		}
+	}
+	if text.Len() == 0 {
+		return "Сегодня мероприятий нет.", nil
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+func (s *TelegramService) upcoming() (string, error) {
+	events, err := s.recurrence.GetUpcomingEvents(telegramUpcomingDays)
+	if err != nil {
+		return "", err
+	}
+	if len(events) == 0 {
+		return "На этой неделе мероприятий нет.", nil
+	}
+	var text strings.Builder
+	text.WriteString("Мероприятия на неделю:\n")
+	for _, event := range events {
+		fmt.Fprintf(&text, "\n%s\n%s\n", event.Name, fmt.Sprintf(s.eventLink, event.ID))
+		for _, block := range event.EventBlocks {
+			fmt.Fprintf(&text, "• %s %s\n", block.StartDate.In(s.location).Format(feedDateLayout), block.Name)
+		}
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// onChange collects the changes of an event for noticeDelay and then
+// sends one message for all of them, so a batch or an import does not
+// repeat the same message for every block it touches.
+func (s *TelegramService) onChange(change model.EventChange) {
+	if s.client == nil || change.Kind == model.ChangeReset {
+		return
+	}
+	s.noticesMu.Lock()
+	defer s.noticesMu.Unlock()
+	notice, ok := s.notices[change.EventID]
+	if !ok {
+		notice = &telegramNotice{}
+		s.notices[change.EventID] = notice
+		time.AfterFunc(s.noticeDelay, func() {
+			s.sendNotice(change.EventID)
+		})
+	}
+	switch change.Kind {
+	case model.ChangeEventCreated:
+		notice.created = true
+	case model.ChangeEventDeleted:
+		notice.deleted = true
+	}
+}
+
+// sendNotice tells linked users about a new event and followers of an
+// event about its changes. Deleted events have nobody left to tell.
+func (s *TelegramService) sendNotice(eventId int) {
+	s.noticesMu.Lock()
+	notice, ok := s.notices[eventId]
+	delete(s.notices, eventId)
+	s.noticesMu.Unlock()
+	if !ok || notice.deleted {
+		return
+	}
+	event, err := s.repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return
+	}
+	var (
+		users []model.User
+		text  string
+	)
+	link := fmt.Sprintf(s.eventLink, event.ID)
+	if notice.created {
+		users, err = s.repo.Users.GetTelegramUsers()
+		text = fmt.Sprintf("Новое мероприятие: %s\n%s", event.Name, link)
+	} else {
+		users, err = s.repo.Favorites.GetEventFollowers(event.ID)
+		text = fmt.Sprintf("Изменения в мероприятии «%s», проверьте расписание.\n%s", event.Name, link)
+	}
+	if err != nil {
+		logrus.Errorf("TELEGRAM CHANGE ERROR: %s", err.Error())
+		return
+	}
+	for _, user := range users {
+		if user.TelegramChatID == nil {
+			continue
+		}
+		if err := s.client.SendMessage(context.Background(), *user.TelegramChatID, text); err != nil {
+			logrus.Errorf("TELEGRAM SEND ERROR: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+// telegramStub stands in for the Bot API, recording each call and
+// answering with respond.
+type telegramStub struct {
+	paths   []string
+	params  []map[string]interface{}
+	respond func(method string) string
+}
+
+func (s *telegramStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params map[string]interface{}
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.paths = append(s.paths, r.URL.Path)
+	s.params = append(s.params, params)
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(s.respond(method)))
+}
+
+func TestTelegramClientSendMessage(t *testing.T) {
+	stub := &telegramStub{respond: func(string) string {
+		return `{"ok":true,"result":{"message_id":1}}`
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := NewTelegramClient(server.URL+"/", "123:abc")
+	if err := client.SendMessage(context.Background(), 42, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.paths) != 1 || stub.paths[0] != "/bot123:abc/sendMessage" {
+		t.Fatalf("called %v", stub.paths)
+	}
+	params := stub.params[0]
+	if params["chat_id"] != float64(42) || params["text"] != "hello" || params["disable_web_page_preview"] != true {
+		t.Errorf("sent %v", params)
+	}
+}
+
+func TestTelegramClientGetUpdates(t *testing.T) {
+	stub := &telegramStub{respond: func(string) string {
+		return `{"ok":true,"result":[
+			{"update_id":7,"message":{"chat":{"id":42},"text":"/start abc"}},
+			{"update_id":8}
+		]}`
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := NewTelegramClient(server.URL, "token")
+	updates, err := client.GetUpdates(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].UpdateID != 7 || updates[1].UpdateID != 8 {
+		t.Fatalf("got %+v", updates)
+	}
+	if updates[0].Message == nil || updates[0].Message.Chat.ID != 42 || updates[0].Message.Text != "/start abc" {
+		t.Errorf("first message %+v", updates[0].Message)
+	}
+	if updates[1].Message != nil {
+		t.Errorf("second update has message %+v", updates[1].Message)
+	}
+	if stub.params[0]["offset"] != float64(7) || stub.params[0]["timeout"] != float64(telegramPollTimeout) {
+		t.Errorf("sent %v", stub.params[0])
+	}
+}
+
+func TestTelegramClientErrors(t *testing.T) {
+	stub := &telegramStub{respond: func(string) string {
+		return `{"ok":false,"description":"Forbidden: bot was blocked by the user"}`
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	err := NewTelegramClient(server.URL, "token").SendMessage(context.Background(), 1, "hi")
+	if err == nil || !strings.Contains(err.Error(), "bot was blocked") {
+		t.Errorf("got %v", err)
+	}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	err = NewTelegramClient(broken.URL, "token").SendMessage(context.Background(), 1, "hi")
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewTelegramClient(server.URL, "token").GetUpdates(ctx, 0); err == nil {
+		t.Error("cancelled poll succeeded")
+	}
+}
+
+// noticeEvents serves the reads sendNotice makes: every event exists, chat
+// 7 is linked and chat 42 follows every event.
+type noticeEvents struct{ repository.Events }
+
+func (noticeEvents) GetOneEvent(eventId int) (model.Event, error) {
+	return model.Event{ID: eventId, Name: "Olympiad"}, nil
+}
+
+type noticeUsers struct{ repository.Users }
+
+func (noticeUsers) GetTelegramUsers() ([]model.User, error) {
+	chat := int64(7)
+	return []model.User{{TelegramChatID: &chat}}, nil
+}
+
+type noticeFollowers struct{ repository.Favorites }
+
+func (noticeFollowers) GetEventFollowers(eventId int) ([]model.User, error) {
+	chat := int64(42)
+	return []model.User{{TelegramChatID: &chat}}, nil
+}
+
+func TestTelegramNoticesCombineChanges(t *testing.T) {
+	stub := &telegramStub{respond: func(string) string {
+		return `{"ok":true,"result":{"message_id":1}}`
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	repo := &repository.Repository{Events: noticeEvents{}, Users: noticeUsers{}, Favorites: noticeFollowers{}}
+	s := NewTelegramService(repo, NewTelegramClient(server.URL, "token"), nil, nil, nil, "bot", "https://school/event/%d", time.UTC)
+	s.noticeDelay = time.Hour
+	for _, change := range []model.EventChange{
+		{Kind: model.ChangeEventUpdated, EventID: 1},
+		{Kind: model.ChangeBlockUpdated, EventID: 1, BlockID: 10},
+		{Kind: model.ChangeBlockUpdated, EventID: 1, BlockID: 10},
+		{Kind: model.ChangeEventCreated, EventID: 2},
+		{Kind: model.ChangeBlockCreated, EventID: 2, BlockID: 20},
+		{Kind: model.ChangeEventCreated, EventID: 3},
+		{Kind: model.ChangeEventDeleted, EventID: 3},
+	} {
+		s.onChange(change)
+	}
+	for eventId := 1; eventId <= 3; eventId++ {
+		s.sendNotice(eventId)
+	}
+	if len(stub.params) != 2 {
+		t.Fatalf("sent %d messages: %v", len(stub.params), stub.params)
+	}
+	if stub.params[0]["chat_id"] != float64(42) || !strings.Contains(stub.params[0]["text"].(string), "Изменения") {
+		t.Errorf("follower got %v", stub.params[0])
+	}
+	if stub.params[1]["chat_id"] != float64(7) || !strings.Contains(stub.params[1]["text"].(string), "Новое мероприятие") {
+		t.Errorf("linked user got %v", stub.params[1])
+	}
+	s.sendNotice(1)
+	if len(stub.params) != 2 {
+		t.Errorf("sent a notice twice")
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+// copyNameSuffix names clones when the admin gives neither a name nor a
+// suffix, event names are unique.
+const copyNameSuffix = "(копия)"
+
+type TemplatesService struct {
+	repo     *repository.Repository
+	bus      *ChangeBus
+	location *time.Location
+}
+
+func NewTemplatesService(repo *repository.Repository, bus *ChangeBus, location *time.Location) *TemplatesService {
+	return &TemplatesService{
+		repo:     repo,
+		bus:      bus,
+		location: location,
+	}
+}
+
+// dateShift moves times by calendar years and days in the school's time
+// zone, so blocks keep their time of day across daylight saving changes,
+// and then by delta.
+type dateShift struct {
+	years int
+	days  int
+	delta time.Duration
+}
+
+func (d dateShift) apply(t time.Time, loc *time.Location) time.Time {
+	return t.In(loc).AddDate(d.years, 0, d.days).Add(d.delta)
+}
+
+// shiftBlocks moves the blocks in place. Recurrence rules end as much later
+// as the blocks start, exceptions are not copied since holidays differ
+// from year to year.
+func shiftBlocks(blocks []model.EventBlock, shift dateShift, loc *time.Location) error {
+	for i := range blocks {
+		block := &blocks[i]
+		block.StartDate = shift.apply(block.StartDate, loc)
+		block.EndDate = shift.apply(block.EndDate, loc)
+		if block.RegistrationDeadline != nil {
+			deadline := shift.apply(*block.RegistrationDeadline, loc)
+			block.RegistrationDeadline = &deadline
+		}
+		if block.RRule != "" {
+			rule, err := parseRecurrenceRule(block.RRule)
+			if err != nil {
+				return fmt.Errorf("invalid rrule: %s", err.Error())
+			}
+			if !rule.Until.IsZero() {
+				rule.Until = shift.apply(rule.Until, loc).UTC()
+			}
+			block.RRule = rule.String()
+		}
+		block.UID = ""
+		block.EventID = 0
+		block.Exceptions = nil
+		block.RecurrenceID = nil
+	}
+	return nil
+}
+
+func earliestStart(blocks []model.EventBlock) (time.Time, bool) {
+	var earliest time.Time
+	for i, block := range blocks {
+		if i == 0 || block.StartDate.Before(earliest) {
+			earliest = block.StartDate
+		}
+	}
+	return earliest, len(blocks) > 0
+}
+
+// shiftTo returns the shift that moves from to target. A bare date only
+// changes the day.
+func shiftTo(from time.Time, target model.DateTime, loc *time.Location) dateShift {
+	from = from.In(loc)
+	to := target.In(loc)
+	if target.DateOnly {
+		to = time.Date(target.Year(), target.Month(), target.Day(), from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), loc)
+	}
+	days := int(model.DateOf(to).Sub(model.DateOf(from).Time).Hours() / 24)
+	return dateShift{
+		days:  days,
+		delta: to.Sub(from.AddDate(0, 0, days)),
+	}
+}
+
+// CloneEvent copies the event with its blocks and translations, moved by
+// opts. The copy does not join the source's series unless opts.ParentID
+// says so, attachments stay with the source.
+func (s *TemplatesService) CloneEvent(eventId int, opts model.CloneOptions, save model.SaveOptions) (model.Event, error) {
+	if opts.OffsetDays != 0 && opts.StartDate != nil {
+		return model.Event{}, fmt.Errorf("offset_days and start_date can not be combined")
+	}
+	source, err := s.repo.Events.GetOneEvent(eventId)
+	if err != nil {
+		return model.Event{}, err
+	}
+	shift := dateShift{days: opts.OffsetDays}
+	if earliest, ok := earliestStart(source.EventBlocks); ok && opts.StartDate != nil {
+		shift = shiftTo(earliest, *opts.StartDate, s.location)
+	}
+	if err := shiftBlocks(source.EventBlocks, shift, s.location); err != nil {
+		return model.Event{}, err
+	}
+	event := model.Event{
+		Name:        opts.Name,
+		Description: source.Description,
+		EventBlocks: source.EventBlocks,
+		ParentID:    opts.ParentID,
+		Tags:        source.Tags,
+		Audience:    source.Audience,
+	}
+	if event.Name == "" {
+		suffix := opts.NameSuffix
+		if suffix == "" {
+			suffix = copyNameSuffix
+		}
+		event.Name = source.Name + " " + suffix
+	}
+	return s.create(event, source.ID, save)
+}
+
+func (s *TemplatesService) GetTemplates() ([]model.EventTemplate, error) {
+	return s.repo.Templates.GetTemplates()
+}
+
+func (s *TemplatesService) GetTemplate(templateId int) (model.EventTemplate, error) {
+	return s.repo.Templates.GetTemplate(templateId)
+}
+
+// CreateTemplate saves the template, or a snapshot of the event when
+// eventId is set.
+func (s *TemplatesService) CreateTemplate(template model.EventTemplate, eventId int) (int, error) {
+	if eventId != 0 {
+		event, err := s.repo.Events.GetOneEvent(eventId)
+		if err != nil {
+			return 0, err
+		}
+		template.Event = templateOf(event)
+	}
+	if err := s.validateTemplate(&template); err != nil {
+		return 0, err
+	}
+	return s.repo.Templates.CreateTemplate(template)
+}
+
+func (s *TemplatesService) EditTemplate(template model.EventTemplate) error {
+	if err := s.validateTemplate(&template); err != nil {
+		return err
+	}
+	return s.repo.Templates.EditTemplate(template)
+}
+
+func (s *TemplatesService) DeleteTemplate(templateId int) error {
+	return s.repo.Templates.DeleteTemplate(templateId)
+}
+
+// InstantiateTemplate creates an event from the template, its blocks moved
+// to instance.Year when it is set.
+func (s *TemplatesService) InstantiateTemplate(templateId int, instance model.TemplateInstance, save model.SaveOptions) (model.Event, error) {
+	template, err := s.repo.Templates.GetTemplate(templateId)
+	if err != nil {
+		return model.Event{}, err
+	}
+	blocks := eventBlocksOf(template.Event)
+	var shift dateShift
+	if earliest, ok := earliestStart(blocks); ok && instance.Year != 0 {
+		shift.years = instance.Year - earliest.In(s.location).Year()
+	}
+	if err := shiftBlocks(blocks, shift, s.location); err != nil {
+		return model.Event{}, err
+	}
+	suffix := instance.NameSuffix
+	if suffix == "" && instance.Year != 0 {
+		suffix = strconv.Itoa(instance.Year)
+	}
+	event := model.Event{
+		Name:        strings.TrimSpace(template.Event.Name + " " + suffix),
+		Description: template.Event.Description,
+		EventBlocks: blocks,
+		ParentID:    instance.ParentID,
+		Tags:        template.Event.Tags,
+		Audience:    template.Event.Audience,
+	}
+	return s.create(event, 0, save)
+}
+
+func (s *TemplatesService) validateTemplate(template *model.EventTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if len(template.Name) > 255 {
+		return fmt.Errorf("name is too long")
+	}
+	if strings.TrimSpace(template.Event.Name) == "" {
+		return fmt.Errorf("event name is empty")
+	}
+	if err := validateDescription(template.Event.Description); err != nil {
+		return err
+	}
+	var err error
+	if template.Event.Tags, err = cleanLabels("tags", template.Event.Tags); err != nil {
+		return err
+	}
+	if template.Event.Audience, err = cleanLabels("audience", template.Event.Audience); err != nil {
+		return err
+	}
+	return validateBlocks(eventBlocksOf(template.Event), s.location)
+}
+
+// create checks the event like EventsService.CreateEvent and writes it in
+// one transaction.
+func (s *TemplatesService) create(event model.Event, sourceId int, save model.SaveOptions) (model.Event, error) {
+	if err := validateDescription(event.Description); err != nil {
+		return model.Event{}, err
+	}
+	if err := validateParent(s.repo, 0, event.ParentID); err != nil {
+		return model.Event{}, err
+	}
+	if err := prepareLabels(s.repo, &event, event.ParentID); err != nil {
+		return model.Event{}, err
+	}
+	if err := validateBlocks(event.EventBlocks, s.location); err != nil {
+		return model.Event{}, err
+	}
+	conflicts, release, err := checkConflicts(s.repo, event.EventBlocks, s.location, save)
+	if err != nil {
+		return model.Event{}, err
+	}
+	defer release()
+	id, err := s.repo.Events.CopyEvent(event, sourceId)
+	if err != nil {
+		return model.Event{}, err
+	}
+	if len(conflicts) > 0 {
+		recordOverride(s.repo, save, model.AuditForceCreateEvent, map[string]interface{}{
+			"event_id":  id,
+			"conflicts": conflicts,
+		})
+	}
+	s.bus.Publish(model.ChangeEventCreated, id, 0)
+	event.ID = id
+	return event, nil
+}
+
+func templateOf(event model.Event) model.TemplateEvent {
+	template := model.TemplateEvent{
+		Name:        event.Name,
+		Description: event.Description,
+		Tags:        event.Tags,
+		Audience:    event.Audience,
+		Blocks:      make([]model.TemplateBlock, len(event.EventBlocks)),
+	}
+	for i, block := range event.EventBlocks {
+		template.Blocks[i] = model.TemplateBlock{
+			Name:                 block.Name,
+			Description:          block.Description,
+			StartDate:            block.StartDate,
+			EndDate:              block.EndDate,
+			AllDay:               block.AllDay,
+			Link:                 block.Link,
+			RRule:                block.RRule,
+			LocationID:           block.LocationID,
+			Capacity:             block.Capacity,
+			RegistrationDeadline: block.RegistrationDeadline,
+		}
+	}
+	return template
+}
+
+func eventBlocksOf(template model.TemplateEvent) []model.EventBlock {
+	blocks := make([]model.EventBlock, len(template.Blocks))
+	for i, block := range template.Blocks {
+		blocks[i] = model.EventBlock{
+			Name:                 block.Name,
+			Description:          block.Description,
+			StartDate:            block.StartDate,
+			EndDate:              block.EndDate,
+			AllDay:               block.AllDay,
+			Link:                 block.Link,
+			RRule:                block.RRule,
+			LocationID:           block.LocationID,
+			Capacity:             block.Capacity,
+			RegistrationDeadline: block.RegistrationDeadline,
+		}
+	}
+	return blocks
+}
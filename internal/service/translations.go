@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+type TranslationsService struct {
+	repo *repository.Repository
+	bus  *ChangeBus
+}
+
+func NewTranslationsService(repo *repository.Repository, bus *ChangeBus) *TranslationsService {
+	return &TranslationsService{
+		repo: repo,
+		bus:  bus,
+	}
+}
+
+func validateTranslation(translation *model.Translation) error {
+	if !model.IsLocale(translation.Locale) || translation.Locale == model.DefaultLocale {
+		return fmt.Errorf("unsupported locale %s", translation.Locale)
+	}
+	translation.Name = strings.TrimSpace(translation.Name)
+	if len(translation.Name) > 255 {
+		return fmt.Errorf("name is too long")
+	}
+	if translation.Name == "" && translation.Description == "" {
+		return fmt.Errorf("translation is empty")
+	}
+	return validateDescription(translation.Description)
+}
+
+func (s *TranslationsService) GetTranslations(eventId int) ([]model.Translation, error) {
+	return s.repo.Translations.GetEventTranslations(eventId)
+}
+
+func (s *TranslationsService) SaveEventTranslation(translation model.Translation) error {
+	if err := validateTranslation(&translation); err != nil {
+		return err
+	}
+	if _, err := s.repo.Events.GetOneEvent(*translation.EventID); err != nil {
+		return err
+	}
+	if err := s.repo.Translations.SaveEventTranslation(translation); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, *translation.EventID, 0)
+	return nil
+}
+
+func (s *TranslationsService) SaveBlockTranslation(translation model.Translation) error {
+	if err := validateTranslation(&translation); err != nil {
+		return err
+	}
+	block, err := s.repo.Events.GetOneBlock(*translation.BlockID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Translations.SaveBlockTranslation(translation); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeBlockUpdated, block.EventID, block.ID)
+	return nil
+}
+
+func (s *TranslationsService) DeleteEventTranslation(eventId int, locale string) error {
+	if err := s.repo.Translations.DeleteEventTranslation(eventId, locale); err != nil {
+		return err
+	}
+	s.bus.Publish(model.ChangeEventUpdated, eventId, 0)
+	return nil
+}
+
+func (s *TranslationsService) DeleteBlockTranslation(blockId int, locale string) error {
+	if err := s.repo.Translations.DeleteBlockTranslation(blockId, locale); err != nil {
+		return err
+	}
+	if block, err := s.repo.Events.GetOneBlock(blockId); err == nil {
+		s.bus.Publish(model.ChangeBlockUpdated, block.EventID, block.ID)
+	}
+	return nil
+}
+
+// TranslateEvents replaces names and descriptions of the events and their
+// blocks in place. Untranslated fields keep the default locale.
+func (s *TranslationsService) TranslateEvents(events []model.Event, locale string) error {
+	return translateEvents(s.repo, events, locale)
+}
+
+// translateEvents is TranslateEvents for services that render events
+// themselves, calendars and feeds.
+func translateEvents(repo *repository.Repository, events []model.Event, locale string) error {
+	if locale == model.DefaultLocale || len(events) == 0 {
+		return nil
+	}
+	var eventIds, blockIds []int
+	for _, event := range events {
+		eventIds = append(eventIds, event.ID)
+		for _, block := range event.EventBlocks {
+			blockIds = append(blockIds, block.ID)
+		}
+	}
+	translations, err := repo.Translations.GetTranslations(locale, eventIds, blockIds)
+	if err != nil {
+		return err
+	}
+	if len(translations) == 0 {
+		return nil
+	}
+	byEvent := make(map[int]model.Translation)
+	byBlock := make(map[int]model.Translation)
+	for _, translation := range translations {
+		if translation.EventID != nil {
+			byEvent[*translation.EventID] = translation
+		} else {
+			byBlock[*translation.BlockID] = translation
+		}
+	}
+	for i := range events {
+		translate(&events[i].Name, &events[i].Description, byEvent[events[i].ID])
+		for j := range events[i].EventBlocks {
+			block := &events[i].EventBlocks[j]
+			translate(&block.Name, &block.Description, byBlock[block.ID])
+		}
+	}
+	return nil
+}
+
+// TranslateSchedule translates the blocks of the items and the names of
+// their events.
+func (s *TranslationsService) TranslateSchedule(items []model.ScheduleItem, locale string) error {
+	if locale == model.DefaultLocale || len(items) == 0 {
+		return nil
+	}
+	events := make([]model.Event, len(items))
+	for i, item := range items {
+		events[i] = model.Event{
+			ID:          item.Block.EventID,
+			Name:        item.EventName,
+			EventBlocks: []model.EventBlock{item.Block},
+		}
+	}
+	if err := s.TranslateEvents(events, locale); err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].EventName = events[i].Name
+		items[i].Block = events[i].EventBlocks[0]
+	}
+	return nil
+}
+
+func translate(name *string, description *string, translation model.Translation) {
+	if translation.Name != "" {
+		*name = translation.Name
+	}
+	if translation.Description != "" {
+		*description = translation.Description
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+)
+
+type UsersService struct {
+	repo *repository.Repository
+}
+
+func NewUsersService(repo *repository.Repository) *UsersService {
+	return &UsersService{
+		repo: repo,
+	}
+}
+
+func validateUser(user model.User) error {
+	switch user.Role {
+	case model.RoleStudent, model.RoleParent, model.RoleTeacher:
+	default:
+		return fmt.Errorf("role must be student, parent or teacher")
+	}
+	if len(user.Name) > 255 {
+		return fmt.Errorf("name is too long")
+	}
+	if user.Grade != nil && (*user.Grade < 1 || *user.Grade > 11) {
+		return fmt.Errorf("grade must be between 1 and 11")
+	}
+	if user.Class != nil && (*user.Class == "" || len(*user.Class) > 16) {
+		return fmt.Errorf("invalid class")
+	}
+	return nil
+}
+
+// normalizeUser trims the profile and drops the grade and class of anyone
+// who is not a student.
+func normalizeUser(user model.User) model.User {
+	user.Name = strings.TrimSpace(user.Name)
+	if user.Class != nil {
+		class := strings.TrimSpace(*user.Class)
+		user.Class = &class
+	}
+	if user.Role != model.RoleStudent {
+		user.Grade, user.Class = nil, nil
+	}
+	return user
+}
+
+func (s *UsersService) GetUser(userId int) (model.User, error) {
+	return s.repo.Users.GetUser(userId)
+}
+
+// EditProfile changes the user's own name, role, grade and class. The
+// email is the account's identity and stays as it is.
+func (s *UsersService) EditProfile(user model.User) error {
+	user = normalizeUser(user)
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	return s.repo.Users.EditUser(user)
+}
+
+func (s *UsersService) GetUsers(role string) ([]model.User, error) {
+	return s.repo.Users.GetUsers(role)
+}
+
+func (s *UsersService) DeleteUser(userId int) error {
+	return s.repo.Users.DeleteUser(userId)
+}
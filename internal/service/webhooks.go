@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+	"github.com/lavatee/liceum_backend/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	webhookTimeout      = 10 * time.Second
+	webhookBatch        = 5
+	webhookLease        = webhookBatch*webhookTimeout + time.Minute
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	maxWebhookAttempts  = 8
+	webhookDeliveryList = 100
+	maxWebhookError     = 1000
+)
+
+// webhookEventTypes are the changes webhooks can subscribe to.
+var webhookEventTypes = map[string]bool{
+	model.ChangeEventCreated:      true,
+	model.ChangeEventUpdated:      true,
+	model.ChangeEventDeleted:      true,
+	model.ChangeBlockCreated:      true,
+	model.ChangeBlockUpdated:      true,
+	model.ChangeBlockDeleted:      true,
+	model.ChangeOccurrenceUpdated: true,
+	model.ChangeReset:             true,
+}
+
+type WebhooksService struct {
+	repo     *repository.Repository
+	client   *http.Client
+	wake     chan struct{}
+	location *time.Location
+}
+
+func NewWebhooksService(repo *repository.Repository, location *time.Location) *WebhooksService {
+	return &WebhooksService{
+		repo:     repo,
+		client:   &http.Client{Timeout: webhookTimeout},
+		wake:     make(chan struct{}, 1),
+		location: location,
+	}
+}
+
+func validateWebhook(webhook model.Webhook) error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an http or https address")
+	}
+	if len(webhook.EventTypes) == 0 {
+		return fmt.Errorf("event_types is empty")
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !webhookEventTypes[eventType] {
+			return fmt.Errorf("unknown event type %s", eventType)
+		}
+	}
+	return nil
+}
+
+// CreateWebhook generates a secret when none is given and returns the
+// webhook with it, the only time the secret is shown.
+func (s *WebhooksService) CreateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return model.Webhook{}, err
+	}
+	if webhook.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return model.Webhook{}, err
+		}
+		webhook.Secret = hex.EncodeToString(buf)
+	}
+	id, err := s.repo.Webhooks.CreateWebhook(webhook)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	return s.repo.Webhooks.GetWebhook(id)
+}
+
+func (s *WebhooksService) EditWebhook(webhook model.Webhook) error {
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	return s.repo.Webhooks.EditWebhook(webhook)
+}
+
+func (s *WebhooksService) DeleteWebhook(webhookId int) error {
+	return s.repo.Webhooks.DeleteWebhook(webhookId)
+}
+
+func (s *WebhooksService) GetWebhook(webhookId int) (model.Webhook, error) {
+	webhook, err := s.repo.Webhooks.GetWebhook(webhookId)
+	webhook.Secret = ""
+	return webhook, err
+}
+
+func (s *WebhooksService) GetWebhooks() ([]model.Webhook, error) {
+	webhooks, err := s.repo.Webhooks.GetWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *WebhooksService) GetDeliveries(webhookId int) ([]model.WebhookDelivery, error) {
+	if _, err := s.repo.Webhooks.GetWebhook(webhookId); err != nil {
+		return nil, err
+	}
+	return s.repo.Webhooks.GetDeliveries(webhookId, webhookDeliveryList)
+}
+
+// onChange queues the change for subscribed webhooks. The payload carries
+// the event as it is right after the change.
+func (s *WebhooksService) onChange(change model.EventChange) {
+	payload := model.WebhookPayload{
+		Type:      change.Kind,
+		EventID:   change.EventID,
+		BlockID:   change.BlockID,
+		CreatedAt: change.At,
+	}
+	if change.Kind != model.ChangeEventDeleted && change.Kind != model.ChangeReset {
+		if event, err := s.repo.Events.GetOneEvent(change.EventID); err == nil {
+			event = event.Localize(s.location, s.location)
+			payload.Event = &event
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logrus.Errorf("WEBHOOK PAYLOAD ERROR: %s", err.Error())
+		return
+	}
+	queued, err := s.repo.Webhooks.EnqueueDeliveries(change.Kind, body)
+	if err != nil {
+		logrus.Errorf("WEBHOOK ENQUEUE ERROR: %s", err.Error())
+		return
+	}
+	if queued > 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// RunWebhookDispatcher sends due deliveries every interval and right after
+// changes are queued, until ctx is done.
+func (s *WebhooksService) RunWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		if err := s.dispatch(ctx); err != nil {
+			logrus.Errorf("WEBHOOK DISPATCH ERROR: %s", err.Error())
+		}
+	}
+}
+
+// dispatch sends due deliveries a few at a time. A claim is leased for
+// longer than its deliveries can take, so other replicas do not claim
+// them again while they are being sent.
+func (s *WebhooksService) dispatch(ctx context.Context) error {
+	for ctx.Err() == nil {
+		deliveries, err := s.repo.Webhooks.ClaimDueDeliveries(time.Now(), webhookLease, webhookBatch)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		webhooks := make(map[int]model.Webhook)
+		for _, delivery := range deliveries {
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				if webhook, err = s.repo.Webhooks.GetWebhook(delivery.WebhookID); err != nil {
+					logrus.Errorf("WEBHOOK %d ERROR: %s", delivery.WebhookID, err.Error())
+					failDelivery(&delivery, err)
+					if err := s.repo.Webhooks.SaveDeliveryAttempt(delivery); err != nil {
+						logrus.Errorf("WEBHOOK DELIVERY %d ERROR: %s", delivery.ID, err.Error())
+					}
+					continue
+				}
+				webhooks[webhook.ID] = webhook
+			}
+			s.attempt(ctx, webhook, &delivery)
+			if err := s.repo.Webhooks.SaveDeliveryAttempt(delivery); err != nil {
+				logrus.Errorf("WEBHOOK DELIVERY %d ERROR: %s", delivery.ID, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// failDelivery gives up on a delivery whose webhook can not be loaded.
+func failDelivery(delivery *model.WebhookDelivery, err error) {
+	delivery.Status = model.WebhookFailed
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxWebhookError {
+		delivery.LastError = delivery.LastError[:maxWebhookError]
+	}
+}
+
+// signWebhook signs "timestamp.body", so receivers can reject replayed
+// payloads by their age.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// attempt posts the delivery once and updates it with the outcome. Failed
+// attempts are retried with exponential backoff until maxWebhookAttempts.
+func (s *WebhooksService) attempt(ctx context.Context, webhook model.Webhook, delivery *model.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	status, err := s.post(ctx, webhook, *delivery, now)
+	if status != 0 {
+		delivery.ResponseStatus = &status
+	}
+	if err == nil {
+		delivery.Status = model.WebhookDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxWebhookError {
+		delivery.LastError = delivery.LastError[:maxWebhookError]
+	}
+	if delivery.Attempts >= maxWebhookAttempts {
+		delivery.Status = model.WebhookFailed
+		return
+	}
+	backoff := webhookBaseBackoff << (delivery.Attempts - 1)
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	delivery.Status = model.WebhookPending
+	delivery.NextAttemptAt = now.Add(backoff)
+}
+
+func (s *WebhooksService) post(ctx context.Context, webhook model.Webhook, delivery model.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "liceum-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(webhook.Secret, timestamp, delivery.Payload))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// TestWebhook sends a test payload right away and returns the recorded
+// delivery. Failed tests are not retried.
+func (s *WebhooksService) TestWebhook(webhookId int) (model.WebhookDelivery, error) {
+	webhook, err := s.repo.Webhooks.GetWebhook(webhookId)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	body, err := json.Marshal(model.WebhookPayload{Type: model.WebhookTest, CreatedAt: time.Now()})
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	delivery, err := s.repo.Webhooks.CreateDelivery(webhook.ID, model.WebhookTest, body)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	s.attempt(context.Background(), webhook, &delivery)
+	if delivery.Status == model.WebhookPending {
+		delivery.Status = model.WebhookFailed
+	}
+	if err := s.repo.Webhooks.SaveDeliveryAttempt(delivery); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
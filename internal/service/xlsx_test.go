@@ -0,0 +1,144 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavatee/liceum_backend/internal/model"
+)
+
+// buildXLSX packs a workbook with the given sheet XML as its only sheet.
+func buildXLSX(t *testing.T, sheet string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(sheet)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sheetXML(rows string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+func TestXLSXRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"event_name", "block_name"},
+		{"Олимпиада <1>", "Тур & финал"},
+		{"", "", "", "last"},
+	}
+	data, err := writeXLSX("events", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readXLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Fatalf("got %q, want %q", got, rows)
+	}
+}
+
+func TestReadXLSXSparseCells(t *testing.T) {
+	data := buildXLSX(t, sheetXML(
+		`<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c><c r="C1"><v>45000</v></c></row>`+
+			`<row r="3"><c r="B3" t="inlineStr"><is><r><t>b</t></r><r><t>c</t></r></is></c></row>`,
+	))
+	got, err := readXLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"a", "", "45000"}, nil, {"", "bc"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXRejectsInvalidReferences(t *testing.T) {
+	tests := map[string]string{
+		"no column":       `<row r="1"><c r="1"><v>x</v></c></row>`,
+		"lowercase":       `<row r="1"><c r="a1"><v>x</v></c></row>`,
+		"column too wide": `<row r="1"><c r="XFE1"><v>x</v></c></row>`,
+		"huge column":     `<row r="1"><c r="ZZZZZZZZZZZZZZ1"><v>x</v></c></row>`,
+		"row too far":     `<row r="1048577"><c r="A1048577"><v>x</v></c></row>`,
+		"shared string":   `<row r="1"><c r="A1" t="s"><v>3</v></c></row>`,
+	}
+	for name, rows := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readXLSX(buildXLSX(t, sheetXML(rows))); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadXLSXLastColumn(t *testing.T) {
+	got, err := readXLSX(buildXLSX(t, sheetXML(`<row r="1"><c r="XFD1"><v>x</v></c></row>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got[0]) != xlsxMaxColumns || got[0][xlsxMaxColumns-1] != "x" {
+		t.Fatalf("unexpected row of %d cells", len(got[0]))
+	}
+}
+
+func TestReadXLSXLimitsSheetSize(t *testing.T) {
+	var wide strings.Builder
+	for i := 1; i <= xlsxReadMaxCells/xlsxMaxColumns+1; i++ {
+		fmt.Fprintf(&wide, `<row r="%d"><c r="XFD%d"/></row>`, i, i)
+	}
+	tests := map[string]string{
+		"cells": wide.String(),
+		"rows":  fmt.Sprintf(`<row r="%d"><c r="A%d"><v>x</v></c></row>`, xlsxReadMaxRows+1, xlsxReadMaxRows+1),
+	}
+	for name, rows := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readXLSX(buildXLSX(t, sheetXML(rows)))
+			if err == nil || !strings.Contains(err.Error(), "sheet has more than") {
+				t.Fatalf("got %v, want a size error", err)
+			}
+		})
+	}
+}
+
+func TestReadXLSXNotAZip(t *testing.T) {
+	if _, err := readXLSX([]byte("event_name,block_name\n")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for index, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 16383: "XFD"} {
+		if got := xlsxColumnName(index); got != name {
+			t.Errorf("xlsxColumnName(%d) = %s, want %s", index, got, name)
+		}
+		if got := xlsxColumnIndex(name + "1"); got != index {
+			t.Errorf("xlsxColumnIndex(%s1) = %d, want %d", name, got, index)
+		}
+	}
+}
+
+func TestImportSpreadsheetReportsParseErrors(t *testing.T) {
+	s := &ImportService{location: time.UTC}
+	data := buildXLSX(t, sheetXML(`<row r="1"><c r="1"><v>event_name</v></c></row>`))
+	_, err := s.ImportSpreadsheet(data, FormatXLSX, true, model.SaveOptions{})
+	var importErr *model.ImportError
+	if !errors.As(err, &importErr) {
+		t.Fatalf("got %v, want an import error", err)
+	}
+}
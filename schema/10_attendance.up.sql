@@ -0,0 +1,16 @@
+CREATE TABLE attendance (
+    id SERIAL PRIMARY KEY,
+    block_id INT NOT NULL REFERENCES event_blocks(id) ON DELETE CASCADE,
+    registration_id INT REFERENCES registrations(id) ON DELETE SET NULL,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    grade INT,
+    class VARCHAR(16),
+    email VARCHAR(255) NOT NULL,
+    method VARCHAR(16) NOT NULL CHECK (method IN ('code', 'manual')),
+    marked_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (block_id, occurrence_start, email)
+);
+
+CREATE INDEX attendance_email_idx ON attendance (email);
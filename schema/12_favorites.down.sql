@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS calendar_token;
+DROP TABLE IF EXISTS favorites;
@@ -0,0 +1,8 @@
+CREATE TABLE favorites (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_id INT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, event_id)
+);
+
+ALTER TABLE users ADD COLUMN calendar_token VARCHAR(64) UNIQUE;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS deliveries;
+ALTER TABLE users DROP COLUMN IF EXISTS unsubscribe_token;
+ALTER TABLE users DROP COLUMN IF EXISTS digest_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS reminder_hours;
+ALTER TABLE users DROP COLUMN IF EXISTS reminders_enabled;
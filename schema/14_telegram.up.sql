@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN telegram_chat_id BIGINT UNIQUE;
@@ -0,0 +1,9 @@
+CREATE TABLE change_log (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    event_id INT NOT NULL,
+    block_id INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX change_log_created_at_idx ON change_log (created_at);
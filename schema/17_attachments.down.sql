@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS attachments_queue_files ON attachments;
+DROP FUNCTION IF EXISTS queue_attachment_files();
+DROP TABLE IF EXISTS orphaned_files;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,34 @@
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    event_id INT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(128) NOT NULL,
+    size BIGINT NOT NULL,
+    width INT,
+    height INT,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX attachments_event_id_idx ON attachments (event_id);
+
+-- Files of deleted attachments, including those removed together with
+-- their event, wait here until the sweeper deletes them from storage.
+CREATE TABLE orphaned_files (
+    storage_key VARCHAR(255) PRIMARY KEY,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE FUNCTION queue_attachment_files() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO orphaned_files (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO orphaned_files (storage_key) VALUES (OLD.thumbnail_key) ON CONFLICT DO NOTHING;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_queue_files AFTER DELETE ON attachments
+    FOR EACH ROW EXECUTE FUNCTION queue_attachment_files();
@@ -0,0 +1,3 @@
+ALTER TABLE event_block_exceptions ALTER COLUMN description TYPE VARCHAR(500) USING LEFT(description, 500);
+ALTER TABLE event_blocks ALTER COLUMN description TYPE VARCHAR(500) USING LEFT(description, 500);
+ALTER TABLE events ALTER COLUMN description TYPE VARCHAR(500) USING LEFT(description, 500);
@@ -0,0 +1,3 @@
+ALTER TABLE events ALTER COLUMN description TYPE TEXT;
+ALTER TABLE event_blocks ALTER COLUMN description TYPE TEXT;
+ALTER TABLE event_block_exceptions ALTER COLUMN description TYPE TEXT;
@@ -0,0 +1,14 @@
+CREATE TABLE translations (
+    id SERIAL PRIMARY KEY,
+    event_id INT REFERENCES events(id) ON DELETE CASCADE,
+    block_id INT REFERENCES event_blocks(id) ON DELETE CASCADE,
+    locale VARCHAR(8) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((event_id IS NULL) <> (block_id IS NULL)),
+    UNIQUE (event_id, locale),
+    UNIQUE (block_id, locale)
+);
+
+CREATE INDEX translations_block_id_idx ON translations (block_id);
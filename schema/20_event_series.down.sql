@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS events_parent_id_idx;
+ALTER TABLE events DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE events ADD COLUMN parent_id INT REFERENCES events(id) ON DELETE SET NULL;
+
+CREATE INDEX events_parent_id_idx ON events (parent_id);
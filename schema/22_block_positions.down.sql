@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS event_blocks_event_id_position_idx;
+ALTER TABLE event_blocks DROP COLUMN IF EXISTS position;
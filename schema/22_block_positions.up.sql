@@ -0,0 +1,10 @@
+ALTER TABLE event_blocks ADD COLUMN position INT NOT NULL DEFAULT 0;
+
+UPDATE event_blocks b SET position = o.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY event_id ORDER BY start_date, id) - 1 AS position
+    FROM event_blocks
+) o
+WHERE b.id = o.id;
+
+CREATE INDEX event_blocks_event_id_position_idx ON event_blocks (event_id, position);
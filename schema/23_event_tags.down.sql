@@ -0,0 +1,2 @@
+ALTER TABLE events DROP COLUMN IF EXISTS audience;
+ALTER TABLE events DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE events ADD COLUMN audience TEXT[] NOT NULL DEFAULT '{}';
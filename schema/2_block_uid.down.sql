@@ -0,0 +1 @@
+ALTER TABLE event_blocks DROP COLUMN uid;
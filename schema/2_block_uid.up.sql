@@ -0,0 +1,6 @@
+ALTER TABLE event_blocks ADD COLUMN uid VARCHAR(255);
+
+UPDATE event_blocks SET uid = 'block-' || id || '@it9tech.ru';
+
+ALTER TABLE event_blocks ALTER COLUMN uid SET NOT NULL;
+ALTER TABLE event_blocks ADD CONSTRAINT event_blocks_uid_key UNIQUE (uid);
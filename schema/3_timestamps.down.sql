@@ -0,0 +1,5 @@
+ALTER TABLE event_blocks DROP COLUMN updated_at;
+ALTER TABLE event_blocks DROP COLUMN created_at;
+
+ALTER TABLE events DROP COLUMN updated_at;
+ALTER TABLE events DROP COLUMN created_at;
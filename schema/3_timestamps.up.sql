@@ -0,0 +1,5 @@
+ALTER TABLE events ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE events ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+ALTER TABLE event_blocks ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE event_blocks ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,3 @@
+DROP TABLE event_block_exceptions;
+
+ALTER TABLE event_blocks DROP COLUMN rrule;
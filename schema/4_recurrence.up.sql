@@ -0,0 +1,14 @@
+ALTER TABLE event_blocks ADD COLUMN rrule VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE event_block_exceptions (
+    id SERIAL PRIMARY KEY,
+    block_id INT NOT NULL REFERENCES event_blocks(id) ON DELETE CASCADE,
+    recurrence_id TIMESTAMPTZ NOT NULL,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    name VARCHAR(255),
+    description VARCHAR(500),
+    start_date TIMESTAMPTZ,
+    end_date TIMESTAMPTZ,
+    link VARCHAR(255),
+    UNIQUE (block_id, recurrence_id)
+);
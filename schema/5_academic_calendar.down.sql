@@ -0,0 +1 @@
+DROP TABLE academic_periods;
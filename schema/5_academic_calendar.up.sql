@@ -0,0 +1,8 @@
+CREATE TABLE academic_periods (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(32) NOT NULL CHECK (kind IN ('term', 'holiday', 'exam', 'non_school_day')),
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    CHECK (end_date >= start_date)
+);
@@ -0,0 +1 @@
+ALTER TABLE event_blocks ADD COLUMN all_day BOOLEAN NOT NULL DEFAULT FALSE;
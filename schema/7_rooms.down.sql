@@ -0,0 +1,4 @@
+DROP TABLE audit_log;
+DROP INDEX event_blocks_location_id_idx;
+ALTER TABLE event_blocks DROP COLUMN location_id;
+DROP TABLE rooms;
@@ -0,0 +1,16 @@
+CREATE TABLE rooms (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    capacity INT NOT NULL DEFAULT 0 CHECK (capacity >= 0)
+);
+
+ALTER TABLE event_blocks ADD COLUMN location_id INT REFERENCES rooms(id) ON DELETE SET NULL;
+CREATE INDEX event_blocks_location_id_idx ON event_blocks (location_id);
+
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP TABLE registrations;
+ALTER TABLE event_blocks DROP COLUMN registration_deadline;
+ALTER TABLE event_blocks DROP COLUMN capacity;
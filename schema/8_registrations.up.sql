@@ -0,0 +1,13 @@
+ALTER TABLE event_blocks ADD COLUMN capacity INT CHECK (capacity > 0);
+ALTER TABLE event_blocks ADD COLUMN registration_deadline TIMESTAMPTZ;
+
+CREATE TABLE registrations (
+    id SERIAL PRIMARY KEY,
+    block_id INT NOT NULL REFERENCES event_blocks(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    grade INT NOT NULL CHECK (grade BETWEEN 1 AND 11),
+    class VARCHAR(16) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (block_id, email)
+);
@@ -0,0 +1,6 @@
+DROP INDEX registrations_block_status_idx;
+DELETE FROM registrations WHERE status <> 'confirmed';
+ALTER TABLE registrations DROP CONSTRAINT registrations_token_key;
+ALTER TABLE registrations DROP COLUMN token;
+ALTER TABLE registrations DROP COLUMN offer_expires_at;
+ALTER TABLE registrations DROP COLUMN status;
@@ -0,0 +1,7 @@
+ALTER TABLE registrations ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'confirmed' CHECK (status IN ('confirmed', 'waitlisted', 'offered'));
+ALTER TABLE registrations ADD COLUMN offer_expires_at TIMESTAMPTZ;
+ALTER TABLE registrations ADD COLUMN token VARCHAR(64);
+UPDATE registrations SET token = md5(random()::text || id::text) WHERE token IS NULL;
+ALTER TABLE registrations ALTER COLUMN token SET NOT NULL;
+ALTER TABLE registrations ADD CONSTRAINT registrations_token_key UNIQUE (token);
+CREATE INDEX registrations_block_status_idx ON registrations (block_id, status, created_at);